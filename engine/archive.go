@@ -0,0 +1,293 @@
+package engine
+
+import (
+	"bufio"
+	"cmp"
+	"fmt"
+	"hash/crc32"
+	"io"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+)
+
+// A sealed segment of the log is archived as a copy of its complete entries
+// named after the LSNs of its first and last entry, so the archive sorts in
+// LSN order and records where numbering continues when the live log has just
+// been reused
+const archiveSegmentExt = ".wal"
+
+// archivedSegment is a segment of the log copied into the archive directory
+type archivedSegment struct {
+	path     string
+	firstLSN uint64
+	lastLSN  uint64
+}
+
+func archiveSegmentName(firstLSN, lastLSN uint64) string {
+	return fmt.Sprintf("%020d-%020d%s", firstLSN, lastLSN, archiveSegmentExt)
+}
+
+// archivedSegments lists the segments in an archive directory in LSN order.
+// A missing directory holds no segments
+func archivedSegments(dir string) ([]archivedSegment, error) {
+	names, err := os.ReadDir(dir)
+	if os.IsNotExist(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("unable to list archive `%s`: %w", dir, err)
+	}
+	var segments []archivedSegment
+	for _, entry := range names {
+		name, ok := strings.CutSuffix(entry.Name(), archiveSegmentExt)
+		if !ok || entry.IsDir() {
+			continue
+		}
+		var segment archivedSegment
+		if _, err := fmt.Sscanf(name, "%020d-%020d", &segment.firstLSN, &segment.lastLSN); err != nil {
+			continue
+		}
+		segment.path = filepath.Join(dir, entry.Name())
+		segments = append(segments, segment)
+	}
+	slices.SortFunc(segments, func(a, b archivedSegment) int {
+		return cmp.Compare(a.firstLSN, b.firstLSN)
+	})
+	return segments, nil
+}
+
+// Rotate seals the current segment of the log: every entry is flushed, the
+// complete entries are copied into the archive directory, and only once the
+// copy is durable is the log file emptied for reuse. LSNs carry on from the
+// sealed segment. Rotation needs an ArchiveDir, and fails while any
+// transaction is active since undoing it would need the sealed entries.
+//
+// Recovery only reads the live segment, so the pages changed by the sealed
+// entries must already be on disk, as they are right after a Checkpoint
+func (wal *WriteAheadLog) Rotate() error {
+	wal.mutex.Lock()
+	defer wal.mutex.Unlock()
+	return wal.rotate()
+}
+
+// rotate is Rotate without locking; the caller must hold wal.mutex
+func (wal *WriteAheadLog) rotate() error {
+	if len(wal.archiveDir) == 0 {
+		return fmt.Errorf("unable to rotate log: no archive directory configured")
+	}
+	if len(wal.active) > 0 {
+		return fmt.Errorf("unable to rotate log: %d transactions are still active", len(wal.active))
+	}
+	if err := wal.flushLocked(); err != nil {
+		return err
+	}
+
+	info, err := wal.File.Stat()
+	if err != nil {
+		return fmt.Errorf("unable to get log file info: %w", err)
+	}
+	complete := info.Size() / int64(ENTRY_SIZE)
+	if complete == 0 {
+		return nil
+	}
+	first, err := readEntryAt(wal.File, 0)
+	if err != nil {
+		return fmt.Errorf("unable to read first log entry: %w", err)
+	}
+	last, err := readEntryAt(wal.File, (complete-1)*int64(ENTRY_SIZE))
+	if err != nil {
+		return fmt.Errorf("unable to read last log entry: %w", err)
+	}
+	if err := wal.archive(complete, first.LSN, last.LSN); err != nil {
+		return err
+	}
+
+	if err := wal.File.Truncate(0); err != nil {
+		return fmt.Errorf("unable to reuse log file: %w", err)
+	}
+	if err := wal.File.Sync(); err != nil {
+		return fmt.Errorf("unable to sync log file: %w", err)
+	}
+	return nil
+}
+
+// sealIfIdle rotates the log if it is archived and no transaction is active,
+// for a checkpoint that has just made every logged change durable
+func (wal *WriteAheadLog) sealIfIdle() error {
+	wal.mutex.Lock()
+	defer wal.mutex.Unlock()
+	if len(wal.archiveDir) == 0 || len(wal.active) > 0 {
+		return nil
+	}
+	return wal.rotate()
+}
+
+// archive copies the first complete entries of the log file into the archive
+// directory as the segment from firstLSN to lastLSN. The copy is written
+// under a temporary name and renamed once it is synced, so the archive never
+// holds a partial segment
+func (wal *WriteAheadLog) archive(complete int64, firstLSN, lastLSN uint64) (err error) {
+	if err := os.MkdirAll(wal.archiveDir, 0755); err != nil {
+		return fmt.Errorf("unable to create archive `%s`: %w", wal.archiveDir, err)
+	}
+	path := filepath.Join(wal.archiveDir, archiveSegmentName(firstLSN, lastLSN))
+	out, err := os.CreateTemp(wal.archiveDir, ".segment-*")
+	if err != nil {
+		return fmt.Errorf("unable to create archive segment: %w", err)
+	}
+	defer func() {
+		if closeErr := out.Close(); err == nil && closeErr != nil {
+			err = fmt.Errorf("unable to close archive segment: %w", closeErr)
+		}
+		if err != nil {
+			os.Remove(out.Name())
+		}
+	}()
+
+	segment := io.NewSectionReader(wal.File, 0, complete*int64(ENTRY_SIZE))
+	if _, err := io.Copy(out, segment); err != nil {
+		return fmt.Errorf("unable to archive LSNs %d to %d: %w", firstLSN, lastLSN, err)
+	}
+	if err := out.Sync(); err != nil {
+		return fmt.Errorf("unable to sync archive segment: %w", err)
+	}
+	if err := os.Rename(out.Name(), path); err != nil {
+		return fmt.Errorf("unable to archive LSNs %d to %d: %w", firstLSN, lastLSN, err)
+	}
+	return nil
+}
+
+// lastArchivedLSN returns the LSN of the last entry in the archive directory,
+// or 0 if it holds none
+func lastArchivedLSN(dir string) (uint64, error) {
+	segments, err := archivedSegments(dir)
+	if err != nil || len(segments) == 0 {
+		return 0, err
+	}
+	return segments[len(segments)-1].lastLSN, nil
+}
+
+// Restore rebuilds a file at a point in time from a base backup written by
+// Backup and the log segments archived since. It lays down the base backup
+// as the new file at config.FilePath with a new log at walPath, appends the
+// archived entries after the backup's snapshot LSN up to target, verifying
+// each entry's checksum, and recovers the file from the resulting log, so
+// transactions committed after target are left out and one straddling it is
+// undone. A zero target replays the whole archive. Neither file may already
+// exist, whether or not the backup carries log entries, and both are removed
+// if the restore fails. It returns the LSN of the last entry restored
+func Restore(base io.Reader, archiveDir string, target RecoveryTarget, config PagerConfig, walPath string) (uint64, error) {
+	if len(walPath) == 0 {
+		return 0, &PagerError{Op: "Restore", Err: fmt.Errorf("no log path was given")}
+	}
+	hash := crc32.New(checksumTable)
+	snapshotLSN, pages, entries, err := readBackupHeader(io.TeeReader(base, hash))
+	if err != nil {
+		return 0, &PagerError{Op: "Restore", Err: err}
+	}
+	if target.LSN != 0 && target.LSN < snapshotLSN {
+		return 0, &PagerError{
+			Op:  "Restore",
+			Err: fmt.Errorf("target LSN %d is before the base backup at LSN %d", target.LSN, snapshotLSN),
+		}
+	}
+	if err := restoreFiles(base, hash, config.FilePath, pages, walPath, entries); err != nil {
+		return 0, &PagerError{Op: "Restore", Err: err}
+	}
+
+	lastLSN, err := replayArchive(archiveDir, walPath, snapshotLSN, target)
+	if err == nil {
+		err = recoverRestored(config, walPath)
+	}
+	if err != nil {
+		os.Remove(config.FilePath)
+		os.Remove(walPath)
+		return 0, &PagerError{Op: "Restore", Err: err}
+	}
+	return lastLSN, nil
+}
+
+// replayArchive appends the archived entries after afterLSN up to target to
+// the log restoreFiles created at walPath, and returns the LSN of the last entry the log then
+// holds. The archive must hold every LSN from afterLSN on without a gap
+func replayArchive(archiveDir, walPath string, afterLSN uint64, target RecoveryTarget) (lastLSN uint64, err error) {
+	segments, err := archivedSegments(archiveDir)
+	if err != nil {
+		return 0, err
+	}
+	log, err := os.OpenFile(walPath, os.O_RDWR|os.O_APPEND, 0644)
+	if err != nil {
+		return 0, fmt.Errorf("unable to open `%s`: %w", walPath, err)
+	}
+	defer func() {
+		if closeErr := log.Close(); err == nil && closeErr != nil {
+			err = fmt.Errorf("unable to close `%s`: %w", walPath, closeErr)
+		}
+	}()
+
+	lastLSN = afterLSN
+	writer := bufio.NewWriterSize(log, 4*ENTRY_SIZE)
+	reached := false
+	for _, segment := range segments {
+		if reached {
+			break
+		}
+		if segment.lastLSN <= lastLSN {
+			continue
+		}
+		reached, lastLSN, err = replaySegment(segment, writer, lastLSN, target)
+		if err != nil {
+			return 0, err
+		}
+	}
+	if target.LSN != 0 && lastLSN < target.LSN {
+		return 0, fmt.Errorf("archive ends at LSN %d, before target LSN %d", lastLSN, target.LSN)
+	}
+
+	if err := writer.Flush(); err != nil {
+		return 0, fmt.Errorf("unable to write `%s`: %w", walPath, err)
+	}
+	if err := log.Sync(); err != nil {
+		return 0, fmt.Errorf("unable to sync `%s`: %w", walPath, err)
+	}
+	return lastLSN, nil
+}
+
+// replaySegment writes the entries of an archived segment after lastLSN to
+// out until one falls past target, reporting whether target was reached and
+// the LSN of the last entry written
+func replaySegment(segment archivedSegment, out io.Writer, lastLSN uint64, target RecoveryTarget) (bool, uint64, error) {
+	file, err := os.Open(segment.path)
+	if err != nil {
+		return false, 0, fmt.Errorf("unable to open archive segment: %w", err)
+	}
+	defer file.Close()
+	info, err := file.Stat()
+	if err != nil {
+		return false, 0, fmt.Errorf("unable to get archive segment info: %w", err)
+	}
+
+	name := filepath.Base(segment.path)
+	for offset := int64(0); offset+int64(ENTRY_SIZE) <= info.Size(); offset += int64(ENTRY_SIZE) {
+		entry, err := readEntryAt(file, offset)
+		if err != nil {
+			return false, 0, fmt.Errorf("archive segment %s: %w", name, err)
+		}
+		if entry.LSN <= lastLSN {
+			continue
+		}
+		if entry.LSN != lastLSN+1 {
+			return false, 0, fmt.Errorf("archive is missing LSNs %d to %d", lastLSN+1, entry.LSN-1)
+		}
+		if !target.includes(entry) {
+			return true, lastLSN, nil
+		}
+		if _, err := out.Write(encodeEntry(entry)); err != nil {
+			return false, 0, fmt.Errorf("unable to write LSN %d: %w", entry.LSN, err)
+		}
+		lastLSN = entry.LSN
+	}
+	return false, lastLSN, nil
+}
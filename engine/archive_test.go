@@ -0,0 +1,279 @@
+package engine
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestRotateArchivesSegment(t *testing.T) {
+	dir := t.TempDir()
+	config := WriteAheadLogConfig{
+		FilePath:   filepath.Join(dir, "test.wal"),
+		ArchiveDir: filepath.Join(dir, "archive"),
+	}
+	wal, err := NewWriteAheadLog(config)
+	if err != nil {
+		t.Fatalf(`NewWriteAheadLog() got %q wanted nil`, err)
+	}
+	defer func() { wal.Close() }()
+
+	for _, entry := range []*WriteAheadLogEntry{
+		{TxnID: 1, Type: EntryTypeWrite, PageID: 1},
+		{TxnID: 1, Type: EntryTypeWrite, PageID: 2},
+		{TxnID: 1, Type: EntryTypeCommit},
+	} {
+		if err := wal.Append(entry); err != nil {
+			t.Fatalf(`Append() got %q wanted nil`, err)
+		}
+	}
+	if err := wal.Rotate(); err != nil {
+		t.Fatalf(`Rotate() got %q wanted nil`, err)
+	}
+
+	segments, err := archivedSegments(config.ArchiveDir)
+	if err != nil {
+		t.Fatalf(`archivedSegments() got %q wanted nil`, err)
+	}
+	if len(segments) != 1 || segments[0].firstLSN != 1 || segments[0].lastLSN != 3 {
+		t.Fatalf(`archive holds %+v; want one segment of LSNs 1 to 3`, segments)
+	}
+	archived, err := os.Open(segments[0].path)
+	if err != nil {
+		t.Fatalf(`Open() got %q wanted nil`, err)
+	}
+	defer archived.Close()
+	for i, want := range []PageID{1, 2, 0} {
+		entry, err := readEntryAt(archived, int64(i*ENTRY_SIZE))
+		if err != nil {
+			t.Fatalf(`readEntryAt(%d) got %q wanted nil`, i, err)
+		}
+		if entry.LSN != uint64(i+1) || entry.PageID != want {
+			t.Errorf(`archived entry %d = (LSN %d, PageID %d); want (%d, %d)`, i, entry.LSN, entry.PageID, i+1, want)
+		}
+	}
+	if entries, err := wal.Replay(); err != nil || len(entries) != 0 {
+		t.Errorf(`Replay() after Rotate() = %d entries, %v; want an empty log`, len(entries), err)
+	}
+
+	// Numbering continues after the sealed segment, even after reopening a
+	// log that rotation has just emptied
+	if err := wal.Close(); err != nil {
+		t.Fatalf(`Close() got %q wanted nil`, err)
+	}
+	if wal, err = NewWriteAheadLog(config); err != nil {
+		t.Fatalf(`NewWriteAheadLog() got %q wanted nil`, err)
+	}
+	write := &WriteAheadLogEntry{TxnID: 2, Type: EntryTypeWrite, PageID: 1}
+	if err := wal.Append(write); err != nil {
+		t.Fatalf(`Append() got %q wanted nil`, err)
+	}
+	if write.LSN != 4 {
+		t.Errorf(`Append() after reopening assigned LSN %d; want 4`, write.LSN)
+	}
+	if err := wal.Rotate(); err == nil {
+		t.Errorf(`Rotate() with transaction 2 active got nil wanted error`)
+	}
+
+	if err := newTestWAL(t).Rotate(); err == nil {
+		t.Errorf(`Rotate() without an ArchiveDir got nil wanted error`)
+	}
+}
+
+func TestCheckpointSealsArchivedLog(t *testing.T) {
+	dir := t.TempDir()
+	pager := newTestPager(t)
+	wal, err := NewWriteAheadLog(WriteAheadLogConfig{
+		FilePath:   filepath.Join(dir, "test.wal"),
+		ArchiveDir: filepath.Join(dir, "archive"),
+	})
+	if err != nil {
+		t.Fatalf(`NewWriteAheadLog() got %q wanted nil`, err)
+	}
+	defer wal.Close()
+
+	page, err := pager.AllocatePage(PageTypeData)
+	if err != nil {
+		t.Fatalf(`AllocatePage() got %q wanted nil`, err)
+	}
+	before := clonePage(page)
+	page.Body[0] = 1
+	logPageWrite(t, pager, wal, 1, before, page)
+	page.MarkDirtyLSN(wal.LastLSN())
+	if err := wal.Append(&WriteAheadLogEntry{TxnID: 1, Type: EntryTypeCommit}); err != nil {
+		t.Fatalf(`Append() got %q wanted nil`, err)
+	}
+
+	if err := Checkpoint(pager, wal); err != nil {
+		t.Fatalf(`Checkpoint() got %q wanted nil`, err)
+	}
+	segments, err := archivedSegments(filepath.Join(dir, "archive"))
+	if err != nil {
+		t.Fatalf(`archivedSegments() got %q wanted nil`, err)
+	}
+	if len(segments) != 1 || segments[0].lastLSN != 2 {
+		t.Errorf(`archive after Checkpoint() holds %+v; want the segment up to LSN 2`, segments)
+	}
+	entries, err := wal.Replay()
+	if err != nil {
+		t.Fatalf(`Replay() got %q wanted nil`, err)
+	}
+	if len(entries) != 1 || entries[0].Type != EntryTypeCheckpoint {
+		t.Errorf(`log after Checkpoint() holds %d entries; want just the checkpoint`, len(entries))
+	}
+
+	if err := Recover(pager, wal); err != nil {
+		t.Fatalf(`Recover() got %q wanted nil`, err)
+	}
+	got, err := pager.ReadPage(page.Header.PageID)
+	if err != nil {
+		t.Fatalf(`ReadPage() got %q wanted nil`, err)
+	}
+	if got.Body[0] != 1 {
+		t.Errorf(`page body[0] after Recover() = %d; want 1`, got.Body[0])
+	}
+}
+
+func TestRestoreFromArchive(t *testing.T) {
+	dir := t.TempDir()
+	archiveDir := filepath.Join(dir, "archive")
+	pager := newTestPager(t)
+	wal, err := NewWriteAheadLog(WriteAheadLogConfig{FilePath: filepath.Join(dir, "live.wal"), ArchiveDir: archiveDir})
+	if err != nil {
+		t.Fatalf(`NewWriteAheadLog() got %q wanted nil`, err)
+	}
+	defer wal.Close()
+
+	a, err := pager.AllocatePage(PageTypeData)
+	if err != nil {
+		t.Fatalf(`AllocatePage() got %q wanted nil`, err)
+	}
+	b, err := pager.AllocatePage(PageTypeData)
+	if err != nil {
+		t.Fatalf(`AllocatePage() got %q wanted nil`, err)
+	}
+	write := func(txnID uint64, page *Page, value byte) {
+		before := clonePage(page)
+		page.Body[0] = value
+		logPageWrite(t, pager, wal, txnID, before, page)
+		page.MarkDirtyLSN(wal.LastLSN())
+	}
+	commit := func(txnID uint64) {
+		if err := wal.Append(&WriteAheadLogEntry{TxnID: txnID, Type: EntryTypeCommit}); err != nil {
+			t.Fatalf(`Append() got %q wanted nil`, err)
+		}
+	}
+	rotate := func() {
+		if err := wal.Rotate(); err != nil {
+			t.Fatalf(`Rotate() got %q wanted nil`, err)
+		}
+	}
+
+	write(1, a, 1) // LSN 1
+	commit(1)      // LSN 2
+	var base bytes.Buffer
+	if _, err := pager.Backup(&base, wal); err != nil {
+		t.Fatalf(`Backup() got %q wanted nil`, err)
+	}
+	write(2, a, 2) // LSN 3
+	commit(2)      // LSN 4
+	rotate()
+	write(3, b, 3) // LSN 5
+	commit(3)      // LSN 6
+	write(4, a, 4) // LSN 7
+	commit(4)      // LSN 8
+	rotate()
+
+	tests := []struct {
+		name   string
+		target RecoveryTarget
+		last   uint64
+		a, b   byte
+	}{
+		{"base only", RecoveryTarget{LSN: 2}, 2, 1, 0},
+		{"into the second segment", RecoveryTarget{LSN: 6}, 6, 2, 3},
+		{"straddling transaction 4", RecoveryTarget{LSN: 7}, 7, 2, 3},
+		{"whole archive", RecoveryTarget{}, 8, 4, 3},
+	}
+	for i, test := range tests {
+		config := PagerConfig{FilePath: filepath.Join(dir, fmt.Sprintf("restored%d.db", i)), MaxCacheSize: 100}
+		walPath := filepath.Join(dir, fmt.Sprintf("restored%d.wal", i))
+		last, err := Restore(bytes.NewReader(base.Bytes()), archiveDir, test.target, config, walPath)
+		if err != nil {
+			t.Fatalf(`%s: Restore() got %q wanted nil`, test.name, err)
+		}
+		if last != test.last {
+			t.Errorf(`%s: Restore() = LSN %d; want %d`, test.name, last, test.last)
+		}
+		restored, err := NewPager(config)
+		if err != nil {
+			t.Fatalf(`NewPager() got %q wanted nil`, err)
+		}
+		for _, want := range []struct {
+			pageID PageID
+			value  byte
+		}{{a.Header.PageID, test.a}, {b.Header.PageID, test.b}} {
+			page, err := restored.ReadPage(want.pageID)
+			if err != nil {
+				t.Fatalf(`ReadPage(%d) got %q wanted nil`, want.pageID, err)
+			}
+			if page.Body[0] != want.value {
+				t.Errorf(`%s: restored page %d body[0] = %d; want %d`, test.name, want.pageID, page.Body[0], want.value)
+			}
+		}
+		restored.Close()
+	}
+
+	// A damaged archive stops the restore and leaves nothing behind
+	segments, err := archivedSegments(archiveDir)
+	if err != nil || len(segments) != 2 {
+		t.Fatalf(`archivedSegments() = %d segments, %v; want 2`, len(segments), err)
+	}
+	data, err := os.ReadFile(segments[1].path)
+	if err != nil {
+		t.Fatalf(`ReadFile() got %q wanted nil`, err)
+	}
+	data[ENTRY_SIZE+100] ^= 0xff
+	if err := os.WriteFile(segments[1].path, data, 0644); err != nil {
+		t.Fatalf(`WriteFile() got %q wanted nil`, err)
+	}
+	config := PagerConfig{FilePath: filepath.Join(dir, "damaged.db"), MaxCacheSize: 100}
+	_, err = Restore(bytes.NewReader(base.Bytes()), archiveDir, RecoveryTarget{}, config, filepath.Join(dir, "damaged.wal"))
+	if !errors.Is(err, ErrCorruptEntry) {
+		t.Errorf(`Restore() from a damaged archive got %v wanted ErrCorruptEntry`, err)
+	}
+	if _, err := os.Stat(config.FilePath); !os.IsNotExist(err) {
+		t.Errorf(`damaged restore left %s behind: %v`, config.FilePath, err)
+	}
+}
+
+func TestRestoreKeepsExistingLog(t *testing.T) {
+	dir := t.TempDir()
+	pager := newTestPager(t)
+	if _, err := pager.AllocatePage(PageTypeData); err != nil {
+		t.Fatalf(`AllocatePage() got %q wanted nil`, err)
+	}
+	// A backup taken without a log carries no entries
+	var base bytes.Buffer
+	if _, err := pager.Backup(&base, nil); err != nil {
+		t.Fatalf(`Backup() got %q wanted nil`, err)
+	}
+
+	walPath := filepath.Join(dir, "existing.wal")
+	if err := os.WriteFile(walPath, []byte("not ours"), 0644); err != nil {
+		t.Fatalf(`WriteFile() got %q wanted nil`, err)
+	}
+	config := PagerConfig{FilePath: filepath.Join(dir, "restored.db"), MaxCacheSize: 100}
+	if _, err := Restore(bytes.NewReader(base.Bytes()), filepath.Join(dir, "archive"), RecoveryTarget{}, config, walPath); err == nil {
+		t.Fatalf(`Restore() onto an existing log got nil wanted error`)
+	}
+	if data, err := os.ReadFile(walPath); err != nil || string(data) != "not ours" {
+		t.Errorf(`existing log after Restore() = %q, %v; want it untouched`, data, err)
+	}
+	if _, err := os.Stat(config.FilePath); !os.IsNotExist(err) {
+		t.Errorf(`failed restore left %s behind: %v`, config.FilePath, err)
+	}
+}
@@ -0,0 +1,673 @@
+package engine
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"hash"
+	"hash/crc32"
+	"io"
+	"os"
+	"sync"
+)
+
+// A backup stream is a header of the magic, the snapshot LSN, the page count
+// and the log entry count, then the image of every page of the file from the
+// superblock on, then the serialized log entries up to the snapshot LSN, and
+// finally a CRC32C of everything before it
+var backupMagic = [8]byte{'G', 'D', 'B', 'B', 'A', 'K', '0', '1'}
+
+const backupHeaderSize = 8 + 8 + 8 + 8
+
+// snapshotFile wraps a pager's file while a backup runs. The first write to a
+// page of the snapshot that the backup has not copied yet saves the page's
+// old image, so the backup sees every page as it was when the snapshot was
+// taken while writers carry on
+type snapshotFile struct {
+	pageFile
+	mutex sync.Mutex
+	// pages is the number of pages in the file at the snapshot
+	pages  PageID
+	copied map[PageID]bool
+	saved  map[PageID][]byte
+}
+
+func newSnapshotFile(file pageFile, pages PageID) *snapshotFile {
+	return &snapshotFile{
+		pageFile: file,
+		pages:    pages,
+		copied:   make(map[PageID]bool),
+		saved:    make(map[PageID][]byte),
+	}
+}
+
+func (f *snapshotFile) WriteAt(buffer []byte, offset int64) (int, error) {
+	if len(buffer) > 0 {
+		first := PageID(offset / PageSize)
+		last := PageID((offset + int64(len(buffer)) - 1) / PageSize)
+		if err := f.preserve(first, last+1); err != nil {
+			return 0, err
+		}
+	}
+	return f.pageFile.WriteAt(buffer, offset)
+}
+
+func (f *snapshotFile) Truncate(size int64) error {
+	if err := f.preserve(pagesInFile(size), f.pages); err != nil {
+		return err
+	}
+	return f.pageFile.Truncate(size)
+}
+
+// preserve saves the current image of every page of the snapshot in
+// [start, end) that is about to change and has not been copied or saved yet
+func (f *snapshotFile) preserve(start, end PageID) error {
+	f.mutex.Lock()
+	defer f.mutex.Unlock()
+
+	for pageID := start; pageID < min(end, f.pages); pageID++ {
+		if f.copied[pageID] || f.saved[pageID] != nil {
+			continue
+		}
+		image, err := f.readImage(pageID)
+		if err != nil {
+			return fmt.Errorf("unable to preserve page %d for backup: %w", pageID, err)
+		}
+		f.saved[pageID] = image
+	}
+	return nil
+}
+
+// snapshotPage returns the image of a page as of the snapshot. The caller must
+// not call it again for the same page
+func (f *snapshotFile) snapshotPage(pageID PageID) ([]byte, error) {
+	f.mutex.Lock()
+	defer f.mutex.Unlock()
+
+	f.copied[pageID] = true
+	if image, ok := f.saved[pageID]; ok {
+		delete(f.saved, pageID)
+		return image, nil
+	}
+	return f.readImage(pageID)
+}
+
+// readImage reads a page of the underlying file. A trailing partial page is
+// padded with zeroes. The caller must hold f.mutex
+func (f *snapshotFile) readImage(pageID PageID) ([]byte, error) {
+	image := make([]byte, PageSize)
+	n, err := f.pageFile.ReadAt(image, int64(pageID)*PageSize)
+	if err != nil && !(errors.Is(err, io.EOF) && n > 0) {
+		return nil, err
+	}
+	return image, nil
+}
+
+// Backup writes a consistent copy of the pager's file to dst while the pager
+// stays in use, and returns the snapshot LSN it is consistent with. Dirty
+// cached pages are flushed and the snapshot taken under the pager's lock, but
+// pages are copied after it is released: writers overwriting a page the
+// backup has yet to reach first set its old image aside for the backup.
+//
+// When wal is not nil the snapshot LSN is the last entry logged at the
+// snapshot, and the backup carries the log up to it, so RestoreBackup can
+// recover the copy exactly as a crash at the snapshot would have left it.
+// Without a log the snapshot LSN is 0. Only one backup of a pager can run at
+// a time
+func (p *Pager) Backup(dst io.Writer, wal *WriteAheadLog) (uint64, error) {
+	snapshot, snapshotLSN, err := p.startSnapshot(wal)
+	if err != nil {
+		return 0, err
+	}
+	defer p.endSnapshot(snapshot)
+
+	var entries []WriteAheadLogEntry
+	if wal != nil {
+		if entries, err = snapshotLog(wal, 0, snapshotLSN); err != nil {
+			return 0, &PagerError{Op: "Backup", Err: err}
+		}
+	}
+
+	hash := crc32.New(checksumTable)
+	out := io.MultiWriter(dst, hash)
+	header := make([]byte, backupHeaderSize)
+	copy(header, backupMagic[:])
+	binary.LittleEndian.PutUint64(header[8:16], snapshotLSN)
+	binary.LittleEndian.PutUint64(header[16:24], uint64(snapshot.pages))
+	binary.LittleEndian.PutUint64(header[24:32], uint64(len(entries)))
+	if _, err := out.Write(header); err != nil {
+		return 0, &PagerError{
+			Op:  "Backup",
+			Err: fmt.Errorf("unable to write header: %w", err),
+		}
+	}
+
+	for pageID := PageID(0); pageID < snapshot.pages; pageID++ {
+		image, err := snapshot.snapshotPage(pageID)
+		if err != nil {
+			return 0, &PagerError{
+				Op:  "Backup",
+				Err: fmt.Errorf("unable to read page %d: %w", pageID, err),
+			}
+		}
+		if _, err := out.Write(image); err != nil {
+			return 0, &PagerError{
+				Op:  "Backup",
+				Err: fmt.Errorf("unable to write page %d: %w", pageID, err),
+			}
+		}
+	}
+	for i := range entries {
+		if _, err := out.Write(encodeEntry(&entries[i])); err != nil {
+			return 0, &PagerError{
+				Op:  "Backup",
+				Err: fmt.Errorf("unable to write LSN %d: %w", entries[i].LSN, err),
+			}
+		}
+	}
+
+	if err := binary.Write(dst, binary.LittleEndian, hash.Sum32()); err != nil {
+		return 0, &PagerError{
+			Op:  "Backup",
+			Err: fmt.Errorf("unable to write checksum: %w", err),
+		}
+	}
+	return snapshotLSN, nil
+}
+
+// snapshotLog returns the entries of the log after afterLSN up to and
+// including snapshotLSN, first making sure they have all reached the file
+func snapshotLog(wal *WriteAheadLog, afterLSN, snapshotLSN uint64) ([]WriteAheadLogEntry, error) {
+	if err := wal.FlushTo(snapshotLSN); err != nil {
+		return nil, fmt.Errorf("unable to flush log: %w", err)
+	}
+	all, err := wal.ReplayFrom(afterLSN + 1)
+	if err != nil {
+		return nil, fmt.Errorf("unable to read log: %w", err)
+	}
+	var entries []WriteAheadLogEntry
+	for _, entry := range all {
+		if entry.LSN <= snapshotLSN {
+			entries = append(entries, entry)
+		}
+	}
+	return entries, nil
+}
+
+// startSnapshot flushes the cache and swaps a snapshotFile in for the pager's
+// file, returning it and the snapshot LSN
+func (p *Pager) startSnapshot(wal *WriteAheadLog) (*snapshotFile, uint64, error) {
+	p.mutex.Lock()
+	defer p.mutex.Unlock()
+
+	if _, ok := p.file.(*snapshotFile); ok {
+		return nil, 0, &PagerError{
+			Op:  "Backup",
+			Err: fmt.Errorf("a backup is already running"),
+		}
+	}
+
+	if !p.readOnly {
+		var dirty []*Page
+		for _, page := range p.pageCache {
+			if page.dirty {
+				dirty = append(dirty, page)
+			}
+		}
+		if err := p.writePages("Backup", dirty); err != nil {
+			return nil, 0, err
+		}
+		if p.superblockDirty {
+			if err := p.writeSuperblock(); err != nil {
+				return nil, 0, &PagerError{Op: "Backup", Err: err}
+			}
+		}
+		if err := p.file.Sync(); err != nil {
+			return nil, 0, &PagerError{
+				Op:  "Backup",
+				Err: fmt.Errorf("unable to sync file: %w", err),
+			}
+		}
+	}
+
+	fileSize, err := p.file.Size()
+	if err != nil {
+		return nil, 0, &PagerError{
+			Op:  "Backup",
+			Err: fmt.Errorf("unable to get file info: %w", err),
+		}
+	}
+	var snapshotLSN uint64
+	if wal != nil {
+		snapshotLSN = wal.LastLSN()
+	}
+	snapshot := newSnapshotFile(p.file, pagesInFile(fileSize))
+	p.file = snapshot
+	return snapshot, snapshotLSN, nil
+}
+
+// endSnapshot puts the pager's own file back in place of snapshot
+func (p *Pager) endSnapshot(snapshot *snapshotFile) {
+	p.mutex.Lock()
+	defer p.mutex.Unlock()
+	p.file = snapshot.pageFile
+}
+
+// RestoreBackup lays down a backup written by Backup as the new file at
+// config.FilePath and, if the backup carries log entries, a new log at
+// walPath, then recovers the file from that log so it holds exactly the state
+// at the snapshot. Neither file may already exist. It returns the backup's
+// snapshot LSN
+func RestoreBackup(src io.Reader, config PagerConfig, walPath string) (uint64, error) {
+	hash := crc32.New(checksumTable)
+	snapshotLSN, pages, entries, err := readBackupHeader(io.TeeReader(src, hash))
+	if err != nil {
+		return 0, &PagerError{Op: "RestoreBackup", Err: err}
+	}
+	if entries > 0 && len(walPath) == 0 {
+		return 0, &PagerError{
+			Op:  "RestoreBackup",
+			Err: fmt.Errorf("backup carries %d log entries but no log path was given", entries),
+		}
+	}
+
+	// Without entries there is no log to restore, and walPath is left alone
+	logPath := walPath
+	if entries == 0 {
+		logPath = ""
+	}
+	if err := restoreFiles(src, hash, config.FilePath, pages, logPath, entries); err != nil {
+		return 0, &PagerError{Op: "RestoreBackup", Err: err}
+	}
+	if entries == 0 {
+		return snapshotLSN, nil
+	}
+
+	if err := recoverRestored(config, walPath); err != nil {
+		return 0, &PagerError{Op: "RestoreBackup", Err: err}
+	}
+	return snapshotLSN, nil
+}
+
+// readBackupHeader reads the header of a backup written by Backup, returning
+// its snapshot LSN, page count and log entry count
+func readBackupHeader(in io.Reader) (uint64, uint64, uint64, error) {
+	header := make([]byte, backupHeaderSize)
+	if _, err := io.ReadFull(in, header); err != nil {
+		return 0, 0, 0, fmt.Errorf("unable to read header: %w", err)
+	}
+	if !bytes.Equal(header[:8], backupMagic[:]) {
+		return 0, 0, 0, fmt.Errorf("not a backup")
+	}
+	snapshotLSN := binary.LittleEndian.Uint64(header[8:16])
+	pages := binary.LittleEndian.Uint64(header[16:24])
+	entries := binary.LittleEndian.Uint64(header[24:32])
+	return snapshotLSN, pages, entries, nil
+}
+
+// recoverRestored runs recovery over a restored file from its restored log
+func recoverRestored(config PagerConfig, walPath string) error {
+	pager, err := NewPager(config)
+	if err != nil {
+		return err
+	}
+	wal, err := NewWriteAheadLog(WriteAheadLogConfig{FilePath: walPath})
+	if err != nil {
+		pager.Close()
+		return err
+	}
+	recoverErr := Recover(pager, wal)
+	walErr := wal.Close()
+	closeErr := pager.Close()
+	return errors.Join(recoverErr, walErr, closeErr)
+}
+
+// restoreFiles copies the pages and log entries of a backup, whose header hash
+// has already covered, from src into new files, then checks the trailing
+// checksum. The log is created at walPath unless it is empty, even when the
+// backup carries no entries, so the caller owns it. The files are removed
+// again if anything fails
+func restoreFiles(src io.Reader, hash hash.Hash32, filePath string, pages uint64, walPath string, entries uint64) (err error) {
+	in := io.TeeReader(src, hash)
+	file, err := os.OpenFile(filePath, os.O_RDWR|os.O_CREATE|os.O_EXCL, 0644)
+	if err != nil {
+		return fmt.Errorf("unable to create `%s`: %w", filePath, err)
+	}
+	defer func() {
+		if closeErr := file.Close(); err == nil && closeErr != nil {
+			err = fmt.Errorf("unable to close `%s`: %w", filePath, closeErr)
+		}
+		if err != nil {
+			os.Remove(filePath)
+		}
+	}()
+	if _, err := io.CopyN(file, in, int64(pages)*PageSize); err != nil {
+		return fmt.Errorf("unable to restore pages: %w", err)
+	}
+	if err := file.Sync(); err != nil {
+		return fmt.Errorf("unable to sync `%s`: %w", filePath, err)
+	}
+
+	if len(walPath) > 0 {
+		log, err := os.OpenFile(walPath, os.O_RDWR|os.O_CREATE|os.O_EXCL, 0644)
+		if err != nil {
+			return fmt.Errorf("unable to create `%s`: %w", walPath, err)
+		}
+		defer func() {
+			if closeErr := log.Close(); err == nil && closeErr != nil {
+				err = fmt.Errorf("unable to close `%s`: %w", walPath, closeErr)
+			}
+			if err != nil {
+				os.Remove(walPath)
+			}
+		}()
+		if _, err := io.CopyN(log, in, int64(entries)*int64(ENTRY_SIZE)); err != nil {
+			return fmt.Errorf("unable to restore log: %w", err)
+		}
+		if err := log.Sync(); err != nil {
+			return fmt.Errorf("unable to sync `%s`: %w", walPath, err)
+		}
+	}
+
+	// The checksum does not cover itself, so it is read past the hash
+	computed := hash.Sum32()
+	var stored uint32
+	if err := binary.Read(src, binary.LittleEndian, &stored); err != nil {
+		return fmt.Errorf("unable to read checksum: %w", err)
+	}
+	if stored != computed {
+		return fmt.Errorf("%w: backup stored %08x, computed %08x", ErrChecksumMismatch, stored, computed)
+	}
+	return nil
+}
+
+// An incremental backup stream is a header of its own magic, the LSN it
+// covers changes after, the snapshot LSN, the page count and the log entry
+// count, then the superblock image, then the PageID and image of each changed
+// page ended by a PageID of 0, then the log entries after the first LSN up to
+// the snapshot LSN, and finally a CRC32C of everything before it
+var incrementalMagic = [8]byte{'G', 'D', 'B', 'I', 'N', 'C', '0', '1'}
+
+const incrementalHeaderSize = 8 + 8 + 8 + 8 + 8
+
+type incrementalHeader struct {
+	sinceLSN    uint64
+	snapshotLSN uint64
+	pages       uint64
+	entries     uint64
+}
+
+// pageChangedSince reports whether a page image may hold changes made after
+// sinceLSN. A page's PageLSN only moves with logged changes, so pages that
+// have never been logged, and free pages, whose PageLSN deallocation leaves
+// alone, always count as changed, as does anything that doesn't parse
+func pageChangedSince(image []byte, sinceLSN uint64) bool {
+	header, err := parseHeader(image)
+	if err != nil {
+		return true
+	}
+	return header.PageLSN > sinceLSN || header.PageLSN == 0 || header.PageType == PageTypeFree
+}
+
+// IncrementalBackup writes the pages changed since sinceLSN, usually the
+// snapshot LSN of the previous backup, and the log entries after it, taking
+// the same online snapshot as Backup. Applied with ApplyIncrementalBackup on
+// top of the restored previous backup, it brings the copy to its own
+// snapshot, whose LSN it returns.
+//
+// Changed pages are found by their PageLSN, so a change made without logging
+// to a page that has a PageLSN from an earlier logged change is missed
+func (p *Pager) IncrementalBackup(dst io.Writer, wal *WriteAheadLog, sinceLSN uint64) (uint64, error) {
+	if wal == nil {
+		return 0, &PagerError{
+			Op:  "IncrementalBackup",
+			Err: fmt.Errorf("changes can only be tracked through a log"),
+		}
+	}
+	snapshot, snapshotLSN, err := p.startSnapshot(wal)
+	if err != nil {
+		return 0, err
+	}
+	defer p.endSnapshot(snapshot)
+
+	if sinceLSN > snapshotLSN {
+		return 0, &PagerError{
+			Op:  "IncrementalBackup",
+			Err: fmt.Errorf("LSN %d is past the end of the log at %d", sinceLSN, snapshotLSN),
+		}
+	}
+	entries, err := snapshotLog(wal, sinceLSN, snapshotLSN)
+	if err != nil {
+		return 0, &PagerError{Op: "IncrementalBackup", Err: err}
+	}
+	if snapshotLSN > sinceLSN && (len(entries) == 0 || entries[0].LSN != sinceLSN+1) {
+		return 0, &PagerError{
+			Op:  "IncrementalBackup",
+			Err: fmt.Errorf("the log after LSN %d has been sealed", sinceLSN),
+		}
+	}
+
+	hash := crc32.New(checksumTable)
+	out := io.MultiWriter(dst, hash)
+	write := func(what string, data []byte) error {
+		if _, err := out.Write(data); err != nil {
+			return &PagerError{
+				Op:  "IncrementalBackup",
+				Err: fmt.Errorf("unable to write %s: %w", what, err),
+			}
+		}
+		return nil
+	}
+
+	header := make([]byte, incrementalHeaderSize)
+	copy(header, incrementalMagic[:])
+	binary.LittleEndian.PutUint64(header[8:16], sinceLSN)
+	binary.LittleEndian.PutUint64(header[16:24], snapshotLSN)
+	binary.LittleEndian.PutUint64(header[24:32], uint64(snapshot.pages))
+	binary.LittleEndian.PutUint64(header[32:40], uint64(len(entries)))
+	if err := write("header", header); err != nil {
+		return 0, err
+	}
+
+	for pageID := PageID(0); pageID < snapshot.pages; pageID++ {
+		image, err := snapshot.snapshotPage(pageID)
+		if err != nil {
+			return 0, &PagerError{
+				Op:  "IncrementalBackup",
+				Err: fmt.Errorf("unable to read page %d: %w", pageID, err),
+			}
+		}
+		// The superblock always goes first, without a PageID
+		if pageID > 0 {
+			if !pageChangedSince(image, sinceLSN) {
+				continue
+			}
+			if err := write("page ID", binary.LittleEndian.AppendUint64(nil, uint64(pageID))); err != nil {
+				return 0, err
+			}
+		}
+		if err := write(fmt.Sprintf("page %d", pageID), image); err != nil {
+			return 0, err
+		}
+	}
+	if err := write("page list end", make([]byte, 8)); err != nil {
+		return 0, err
+	}
+	for i := range entries {
+		if err := write(fmt.Sprintf("LSN %d", entries[i].LSN), encodeEntry(&entries[i])); err != nil {
+			return 0, err
+		}
+	}
+
+	if err := binary.Write(dst, binary.LittleEndian, hash.Sum32()); err != nil {
+		return 0, &PagerError{
+			Op:  "IncrementalBackup",
+			Err: fmt.Errorf("unable to write checksum: %w", err),
+		}
+	}
+	return snapshotLSN, nil
+}
+
+// scanIncremental reads an incremental backup, passing the superblock as page
+// 0 and then each changed page to page, and each serialized log entry to
+// entry, and verifies its checksum once everything has been read. Either
+// callback may be nil
+func scanIncremental(src io.Reader, page func(PageID, []byte) error, entry func([]byte) error) (incrementalHeader, error) {
+	var header incrementalHeader
+	hash := crc32.New(checksumTable)
+	in := io.TeeReader(src, hash)
+
+	buffer := make([]byte, incrementalHeaderSize)
+	if _, err := io.ReadFull(in, buffer); err != nil {
+		return header, fmt.Errorf("unable to read header: %w", err)
+	}
+	if !bytes.Equal(buffer[:8], incrementalMagic[:]) {
+		return header, fmt.Errorf("not an incremental backup")
+	}
+	header.sinceLSN = binary.LittleEndian.Uint64(buffer[8:16])
+	header.snapshotLSN = binary.LittleEndian.Uint64(buffer[16:24])
+	header.pages = binary.LittleEndian.Uint64(buffer[24:32])
+	header.entries = binary.LittleEndian.Uint64(buffer[32:40])
+
+	image := make([]byte, PageSize)
+	var pageID PageID
+	for {
+		if _, err := io.ReadFull(in, image); err != nil {
+			return header, fmt.Errorf("unable to read page %d: %w", pageID, err)
+		}
+		if page != nil {
+			if err := page(pageID, image); err != nil {
+				return header, err
+			}
+		}
+
+		var next uint64
+		if err := binary.Read(in, binary.LittleEndian, &next); err != nil {
+			return header, fmt.Errorf("unable to read page ID: %w", err)
+		}
+		if next == 0 {
+			break
+		}
+		if PageID(next) <= pageID || next >= header.pages {
+			return header, fmt.Errorf("page %d out of order or past the %d pages of the file", next, header.pages)
+		}
+		pageID = PageID(next)
+	}
+
+	serialized := make([]byte, ENTRY_SIZE)
+	for i := uint64(0); i < header.entries; i++ {
+		if _, err := io.ReadFull(in, serialized); err != nil {
+			return header, fmt.Errorf("unable to read log entry %d: %w", i, err)
+		}
+		if entry != nil {
+			if err := entry(serialized); err != nil {
+				return header, err
+			}
+		}
+	}
+
+	// The checksum does not cover itself, so it is read past the hash
+	computed := hash.Sum32()
+	var stored uint32
+	if err := binary.Read(src, binary.LittleEndian, &stored); err != nil {
+		return header, fmt.Errorf("unable to read checksum: %w", err)
+	}
+	if stored != computed {
+		return header, fmt.Errorf("%w: backup stored %08x, computed %08x", ErrChecksumMismatch, stored, computed)
+	}
+	return header, nil
+}
+
+// ApplyIncrementalBackup applies an incremental backup written by
+// IncrementalBackup to the file at config.FilePath and its log at walPath, as
+// left by restoring the backup it follows, then recovers the file to the
+// incremental backup's snapshot, whose LSN it returns. The log must end at
+// the LSN the incremental backup starts after.
+//
+// src is read twice, first to verify its checksum, so a damaged backup is
+// rejected before anything changes
+func ApplyIncrementalBackup(src io.ReadSeeker, config PagerConfig, walPath string) (uint64, error) {
+	header, err := scanIncremental(src, nil, nil)
+	if err != nil {
+		return 0, &PagerError{Op: "ApplyIncrementalBackup", Err: err}
+	}
+	if _, err := src.Seek(0, io.SeekStart); err != nil {
+		return 0, &PagerError{
+			Op:  "ApplyIncrementalBackup",
+			Err: fmt.Errorf("unable to rewind backup: %w", err),
+		}
+	}
+
+	if err := applyIncremental(src, header, config.FilePath, walPath); err != nil {
+		return 0, &PagerError{Op: "ApplyIncrementalBackup", Err: err}
+	}
+	if err := recoverRestored(config, walPath); err != nil {
+		return 0, &PagerError{Op: "ApplyIncrementalBackup", Err: err}
+	}
+	return header.snapshotLSN, nil
+}
+
+// applyIncremental writes the pages and log entries of a verified incremental
+// backup into the file and log of the copy it applies to
+func applyIncremental(src io.Reader, header incrementalHeader, filePath, walPath string) (err error) {
+	log, err := os.OpenFile(walPath, os.O_RDWR|os.O_CREATE|os.O_APPEND, 0644)
+	if err != nil {
+		return fmt.Errorf("unable to open `%s`: %w", walPath, err)
+	}
+	defer func() {
+		if closeErr := log.Close(); err == nil && closeErr != nil {
+			err = fmt.Errorf("unable to close `%s`: %w", walPath, closeErr)
+		}
+	}()
+	info, err := log.Stat()
+	if err != nil {
+		return fmt.Errorf("unable to get log file info: %w", err)
+	}
+	var lastLSN uint64
+	if complete := info.Size() / int64(ENTRY_SIZE); complete > 0 {
+		last, err := readEntryAt(log, (complete-1)*int64(ENTRY_SIZE))
+		if err != nil {
+			return fmt.Errorf("unable to read last log entry: %w", err)
+		}
+		lastLSN = last.LSN
+	}
+	if lastLSN != header.sinceLSN {
+		return fmt.Errorf("log ends at LSN %d but the backup follows LSN %d", lastLSN, header.sinceLSN)
+	}
+
+	file, err := os.OpenFile(filePath, os.O_RDWR, 0)
+	if err != nil {
+		return fmt.Errorf("unable to open `%s`: %w", filePath, err)
+	}
+	defer func() {
+		if closeErr := file.Close(); err == nil && closeErr != nil {
+			err = fmt.Errorf("unable to close `%s`: %w", filePath, closeErr)
+		}
+	}()
+
+	_, err = scanIncremental(src, func(pageID PageID, image []byte) error {
+		if _, err := file.WriteAt(image, int64(pageID)*PageSize); err != nil {
+			return fmt.Errorf("unable to write page %d: %w", pageID, err)
+		}
+		return nil
+	}, func(serialized []byte) error {
+		if _, err := log.Write(serialized); err != nil {
+			return fmt.Errorf("unable to write log entry: %w", err)
+		}
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+	if err := file.Truncate(int64(header.pages) * PageSize); err != nil {
+		return fmt.Errorf("unable to resize `%s`: %w", filePath, err)
+	}
+	if err := file.Sync(); err != nil {
+		return fmt.Errorf("unable to sync `%s`: %w", filePath, err)
+	}
+	if err := log.Sync(); err != nil {
+		return fmt.Errorf("unable to sync `%s`: %w", walPath, err)
+	}
+	return nil
+}
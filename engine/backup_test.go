@@ -0,0 +1,276 @@
+package engine
+
+import (
+	"bytes"
+	"errors"
+	"io"
+	"path/filepath"
+	"slices"
+	"testing"
+)
+
+// hookWriter calls hook once the first after bytes have been written through it
+type hookWriter struct {
+	w       io.Writer
+	after   int
+	written int
+	hook    func()
+}
+
+func (h *hookWriter) Write(buffer []byte) (int, error) {
+	n, err := h.w.Write(buffer)
+	h.written += n
+	if h.hook != nil && h.written >= h.after {
+		hook := h.hook
+		h.hook = nil
+		hook()
+	}
+	return n, err
+}
+
+func TestBackupDuringWrites(t *testing.T) {
+	pager := newTestPager(t)
+	var pages []*Page
+	for i := 0; i < 16; i++ {
+		page, err := pager.AllocatePage(PageTypeData)
+		if err != nil {
+			t.Fatalf(`AllocatePage() got %q wanted nil`, err)
+		}
+		pages = append(pages, page)
+	}
+
+	// Every round stamps all pages with the same value, so a consistent copy
+	// holds one round throughout
+	writeRound := func(round int) {
+		for _, page := range pages {
+			page.Body[0] = byte(round)
+			page.Body[MaxBodySize-1] = byte(round)
+			page.MarkDirty()
+		}
+		if err := pager.WritePages(pages); err != nil {
+			t.Fatalf(`WritePages() got %q wanted nil`, err)
+		}
+	}
+	writeRound(1)
+
+	// Two more rounds land while the backup is halfway through the pages
+	var backup bytes.Buffer
+	dst := &hookWriter{w: &backup, after: backupHeaderSize + 8*PageSize, hook: func() {
+		writeRound(2)
+		writeRound(3)
+	}}
+	if _, err := pager.Backup(dst, nil); err != nil {
+		t.Fatalf(`Backup() got %q wanted nil`, err)
+	}
+	writeRound(4)
+
+	path := filepath.Join(t.TempDir(), "restored.db")
+	if _, err := RestoreBackup(&backup, PagerConfig{FilePath: path, MaxCacheSize: 100}, ""); err != nil {
+		t.Fatalf(`RestoreBackup() got %q wanted nil`, err)
+	}
+	restored, err := NewPager(PagerConfig{FilePath: path, MaxCacheSize: 100})
+	if err != nil {
+		t.Fatalf(`NewPager() got %q wanted nil`, err)
+	}
+	defer restored.Close()
+	for _, page := range pages {
+		got, err := restored.ReadPage(page.Header.PageID)
+		if err != nil {
+			t.Fatalf(`ReadPage(%d) got %q wanted nil`, page.Header.PageID, err)
+		}
+		if got.Body[0] != 1 || got.Body[MaxBodySize-1] != 1 {
+			t.Errorf(`restored page %d is from round %d/%d; want round 1`,
+				page.Header.PageID, got.Body[0], got.Body[MaxBodySize-1])
+		}
+	}
+
+	// The pager itself kept every later round
+	page, err := pager.ReadPage(pages[0].Header.PageID)
+	if err != nil {
+		t.Fatalf(`ReadPage() got %q wanted nil`, err)
+	}
+	if page.Body[0] != 4 {
+		t.Errorf(`live page body[0] = %d; want 4`, page.Body[0])
+	}
+}
+
+func TestBackupRestoresToSnapshot(t *testing.T) {
+	pager := newTestPager(t)
+	wal := newTestWAL(t)
+
+	a, err := pager.AllocatePage(PageTypeData)
+	if err != nil {
+		t.Fatalf(`AllocatePage() got %q wanted nil`, err)
+	}
+	b, err := pager.AllocatePage(PageTypeData)
+	if err != nil {
+		t.Fatalf(`AllocatePage() got %q wanted nil`, err)
+	}
+	write := func(txnID uint64, page *Page, value byte) {
+		before := clonePage(page)
+		page.Body[0] = value
+		logPageWrite(t, pager, wal, txnID, before, page)
+		if err := pager.WritePage(page); err != nil {
+			t.Fatalf(`WritePage() got %q wanted nil`, err)
+		}
+	}
+	commit := func(txnID uint64) {
+		if err := wal.Append(&WriteAheadLogEntry{TxnID: txnID, Type: EntryTypeCommit}); err != nil {
+			t.Fatalf(`Append() got %q wanted nil`, err)
+		}
+	}
+
+	// Transaction 2 is still running at the snapshot, and its change to b is
+	// already in the file
+	write(1, a, 1)
+	commit(1)
+	write(2, b, 7)
+
+	var backup bytes.Buffer
+	snapshotLSN, err := pager.Backup(&backup, wal)
+	if err != nil {
+		t.Fatalf(`Backup() got %q wanted nil`, err)
+	}
+	if snapshotLSN != 3 {
+		t.Errorf(`Backup() snapshot LSN = %d; want 3`, snapshotLSN)
+	}
+	commit(2)
+	write(3, a, 9)
+	commit(3)
+
+	dir := t.TempDir()
+	config := PagerConfig{FilePath: filepath.Join(dir, "restored.db"), MaxCacheSize: 100}
+	walPath := filepath.Join(dir, "restored.wal")
+	image := bytes.Clone(backup.Bytes())
+	if _, err := RestoreBackup(bytes.NewReader(image), config, walPath); err != nil {
+		t.Fatalf(`RestoreBackup() got %q wanted nil`, err)
+	}
+	restored, err := NewPager(config)
+	if err != nil {
+		t.Fatalf(`NewPager() got %q wanted nil`, err)
+	}
+	defer restored.Close()
+	for _, want := range []struct {
+		pageID PageID
+		value  byte
+	}{{a.Header.PageID, 1}, {b.Header.PageID, 0}} {
+		got, err := restored.ReadPage(want.pageID)
+		if err != nil {
+			t.Fatalf(`ReadPage(%d) got %q wanted nil`, want.pageID, err)
+		}
+		if got.Body[0] != want.value {
+			t.Errorf(`restored page %d body[0] = %d; want %d`, want.pageID, got.Body[0], want.value)
+		}
+	}
+
+	// A damaged backup is rejected and leaves nothing behind
+	image[backupHeaderSize+PageSize+HeaderSize] ^= 0xff
+	config.FilePath = filepath.Join(dir, "damaged.db")
+	_, err = RestoreBackup(bytes.NewReader(image), config, filepath.Join(dir, "damaged.wal"))
+	if !errors.Is(err, ErrChecksumMismatch) {
+		t.Errorf(`RestoreBackup() of a damaged backup got %v wanted ErrChecksumMismatch`, err)
+	}
+	if _, err := NewPager(PagerConfig{FilePath: config.FilePath, MaxCacheSize: 1, ReadOnly: true}); err == nil {
+		t.Errorf(`damaged restore left %s behind`, config.FilePath)
+	}
+}
+
+func TestIncrementalBackup(t *testing.T) {
+	pager := newTestPager(t)
+	wal := newTestWAL(t)
+
+	// Every page starts out with a logged change, so each has a PageLSN
+	var pages []*Page
+	for i := 0; i < 6; i++ {
+		page, err := pager.AllocatePage(PageTypeData)
+		if err != nil {
+			t.Fatalf(`AllocatePage() got %q wanted nil`, err)
+		}
+		pages = append(pages, page)
+	}
+	write := func(txnID uint64, page *Page, value byte) {
+		before := clonePage(page)
+		page.Body[0] = value
+		logPageWrite(t, pager, wal, txnID, before, page)
+		page.MarkDirtyLSN(wal.LastLSN())
+	}
+	commit := func(txnID uint64) {
+		if err := wal.Append(&WriteAheadLogEntry{TxnID: txnID, Type: EntryTypeCommit}); err != nil {
+			t.Fatalf(`Append() got %q wanted nil`, err)
+		}
+	}
+	for _, page := range pages {
+		write(1, page, 1)
+	}
+	commit(1)
+
+	var base bytes.Buffer
+	baseLSN, err := pager.Backup(&base, wal)
+	if err != nil {
+		t.Fatalf(`Backup() got %q wanted nil`, err)
+	}
+
+	changed := []*Page{pages[1], pages[4]}
+	for _, page := range changed {
+		write(2, page, 2)
+	}
+	commit(2)
+
+	var incremental bytes.Buffer
+	snapshotLSN, err := pager.IncrementalBackup(&incremental, wal, baseLSN)
+	if err != nil {
+		t.Fatalf(`IncrementalBackup() got %q wanted nil`, err)
+	}
+	if snapshotLSN != baseLSN+3 {
+		t.Errorf(`IncrementalBackup() snapshot LSN = %d; want %d`, snapshotLSN, baseLSN+3)
+	}
+
+	var got []PageID
+	header, err := scanIncremental(bytes.NewReader(incremental.Bytes()), func(pageID PageID, _ []byte) error {
+		got = append(got, pageID)
+		return nil
+	}, nil)
+	if err != nil {
+		t.Fatalf(`scanIncremental() got %q wanted nil`, err)
+	}
+	want := []PageID{0, changed[0].Header.PageID, changed[1].Header.PageID}
+	if !slices.Equal(got, want) {
+		t.Errorf(`incremental backup holds pages %v; want the superblock and %v`, got, want[1:])
+	}
+	if header.entries != 3 {
+		t.Errorf(`incremental backup holds %d log entries; want 3`, header.entries)
+	}
+
+	dir := t.TempDir()
+	config := PagerConfig{FilePath: filepath.Join(dir, "restored.db"), MaxCacheSize: 100}
+	walPath := filepath.Join(dir, "restored.wal")
+	if _, err := RestoreBackup(&base, config, walPath); err != nil {
+		t.Fatalf(`RestoreBackup() got %q wanted nil`, err)
+	}
+	if _, err := ApplyIncrementalBackup(bytes.NewReader(incremental.Bytes()), config, walPath); err != nil {
+		t.Fatalf(`ApplyIncrementalBackup() got %q wanted nil`, err)
+	}
+	// The copy has moved past the LSN the backup follows
+	if _, err := ApplyIncrementalBackup(bytes.NewReader(incremental.Bytes()), config, walPath); err == nil {
+		t.Errorf(`ApplyIncrementalBackup() twice got nil wanted error`)
+	}
+
+	restored, err := NewPager(config)
+	if err != nil {
+		t.Fatalf(`NewPager() got %q wanted nil`, err)
+	}
+	defer restored.Close()
+	for _, page := range pages {
+		value := byte(1)
+		if slices.Contains(changed, page) {
+			value = 2
+		}
+		got, err := restored.ReadPage(page.Header.PageID)
+		if err != nil {
+			t.Fatalf(`ReadPage(%d) got %q wanted nil`, page.Header.PageID, err)
+		}
+		if got.Body[0] != value {
+			t.Errorf(`restored page %d body[0] = %d; want %d`, page.Header.PageID, got.Body[0], value)
+		}
+	}
+}
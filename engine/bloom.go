@@ -0,0 +1,151 @@
+package engine
+
+import (
+	"errors"
+	"fmt"
+	"hash/crc32"
+	"hash/fnv"
+)
+
+// A page can summarize the keys it holds in a Bloom filter kept in the
+// footer's reserved bytes, so a lookup can rule the page out without reading
+// or scanning its body. flagKeyFilter in Header.Flags marks a page whose
+// filter is complete. The filter is followed by its own CRC32C, since neither
+// PageIntegrity nor the body checksum covers it and a damaged filter would
+// otherwise hide keys the page holds. Each key sets keyFilterHashes of the
+// keyFilterBits bits, picked by double hashing its FNV-1a hash. At 160 bits a
+// filter stays useful up to a few dozen keys and only ever produces false
+// positives past that
+const (
+	flagKeyFilter   = 0x04
+	keyFilterSize   = 20
+	keyFilterBits   = keyFilterSize * 8
+	keyFilterHashes = 3
+)
+
+// keyFilterChecksum is the checksum stored after a page's key filter
+func keyFilterChecksum(filter [keyFilterSize]byte) uint32 {
+	return crc32.Checksum(filter[:], checksumTable)
+}
+
+// checkKeyFilter reports ErrChecksumMismatch when a page marked as having a
+// key filter stores one that fails its checksum
+func checkKeyFilter(header PageHeader, footer PageFooter) error {
+	if header.Flags&flagKeyFilter == 0 {
+		return nil
+	}
+	if checksum := keyFilterChecksum(footer.KeyFilter); footer.KeyFilterChecksum != checksum {
+		return fmt.Errorf("%w: key filter stored %08x, computed %08x", ErrChecksumMismatch, footer.KeyFilterChecksum, checksum)
+	}
+	return nil
+}
+
+// keyFilterBitsFor returns the filter bits a key sets
+func keyFilterBitsFor(key []byte) [keyFilterHashes]uint32 {
+	hash := fnv.New64a()
+	hash.Write(key)
+	sum := hash.Sum64()
+	h1, h2 := uint32(sum), uint32(sum>>32)|1
+	var bits [keyFilterHashes]uint32
+	for i := range bits {
+		bits[i] = (h1 + uint32(i)*h2) % keyFilterBits
+	}
+	return bits
+}
+
+// HasKeyFilter reports whether the page carries a complete key filter
+func (page *Page) HasKeyFilter() bool {
+	return page.Header.Flags&flagKeyFilter != 0
+}
+
+// ResetKeyFilter starts the page on an empty key filter. The keys the page
+// holds must then be added with AddKey for the filter to be complete
+func (page *Page) ResetKeyFilter() {
+	clear(page.Footer.KeyFilter[:])
+	page.Header.Flags |= flagKeyFilter
+	page.dirty = true
+}
+
+// AddKey records key in the page's key filter, starting the filter if the
+// page has none. A page that had no filter must be given its existing keys
+// too, so callers adding the first key should ResetKeyFilter and add them all
+func (page *Page) AddKey(key []byte) {
+	for _, bit := range keyFilterBitsFor(key) {
+		page.Footer.KeyFilter[bit/8] |= 1 << (bit % 8)
+	}
+	page.Header.Flags |= flagKeyFilter
+	page.dirty = true
+}
+
+// MayContainKey reports whether key might be on the page. It is false only
+// when the page's key filter rules the key out; a page without a filter may
+// contain any key
+func (page *Page) MayContainKey(key []byte) bool {
+	return keyFilterMayContain(page.Header, page.Footer, key)
+}
+
+func keyFilterMayContain(header PageHeader, footer PageFooter, key []byte) bool {
+	if header.Flags&flagKeyFilter == 0 {
+		return true
+	}
+	for _, bit := range keyFilterBitsFor(key) {
+		if footer.KeyFilter[bit/8]&(1<<(bit%8)) == 0 {
+			return false
+		}
+	}
+	return true
+}
+
+// dropKeyFilter marks the page's filter incomplete after a change that did
+// not maintain it. The filter bytes are kept for a caller that goes on to
+// add the changed key
+func (page *Page) dropKeyFilter() {
+	page.Header.Flags &^= flagKeyFilter
+}
+
+// MayContainKey reports whether the page might hold key, like
+// Page.MayContainKey. A page that is not cached is checked from its header
+// and footer alone, without reading its body or caching it. A page whose
+// header and footer do not agree may contain any key, leaving the error to
+// the read that follows, but a damaged key filter is reported as
+// ErrChecksumMismatch rather than trusted
+func (p *Pager) MayContainKey(pageID PageID, key []byte) (bool, error) {
+	p.mutex.RLock()
+	defer p.mutex.RUnlock()
+
+	if page, ok := p.pageCache[pageID]; ok {
+		return page.MayContainKey(key), nil
+	}
+	buffer := make([]byte, PageSize)
+	offset := int64(pageID) * PageSize
+	footerStart := HeaderSize + MaxBodySize
+	if _, err := p.file.ReadAt(buffer[:HeaderSize], offset); err != nil {
+		return false, &PagerError{
+			Op:  "MayContainKey",
+			Err: fmt.Errorf("unable to read header of page %d: %w", pageID, err),
+		}
+	}
+	if _, err := p.file.ReadAt(buffer[footerStart:], offset+int64(footerStart)); err != nil {
+		return false, &PagerError{
+			Op:  "MayContainKey",
+			Err: fmt.Errorf("unable to read footer of page %d: %w", pageID, err),
+		}
+	}
+	header, err := parseHeader(buffer)
+	if err != nil {
+		return true, nil
+	}
+	footer, err := parseFooter(buffer)
+	if err != nil || footer == (PageFooter{}) {
+		return true, nil
+	}
+	if err := checkFooter(header, buffer[:HeaderSize], footer); errors.Is(err, ErrChecksumMismatch) {
+		return false, &PagerError{
+			Op:  "MayContainKey",
+			Err: fmt.Errorf("page %d failed validation: %w", pageID, err),
+		}
+	} else if err != nil {
+		return true, nil
+	}
+	return keyFilterMayContain(header, footer, key), nil
+}
@@ -0,0 +1,192 @@
+package engine
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"slices"
+	"testing"
+)
+
+func TestHeapLookupUsesKeyFilter(t *testing.T) {
+	pager := newTestPager(t)
+	heap, err := NewHeapFile(pager)
+	if err != nil {
+		t.Fatalf(`NewHeapFile() got %q wanted nil`, err)
+	}
+	heap.SetKeyFilter(true)
+
+	rids := make(map[string]RID)
+	for i := 0; i < 12; i++ {
+		key := fmt.Sprintf("key-%02d", i)
+		rid, err := heap.Insert([]byte(key))
+		if err != nil {
+			t.Fatalf(`Insert() got %q wanted nil`, err)
+		}
+		rids[key] = rid
+	}
+	reads := func() uint64 {
+		stats := pager.Stats()
+		return stats.CacheHits + stats.CacheMisses
+	}
+
+	// Absent keys are ruled out by the filter without reading the page
+	for i := 0; i < 5; i++ {
+		key := fmt.Sprintf("missing-%02d", i)
+		before := reads()
+		if _, err := heap.Lookup([]byte(key)); !errors.Is(err, ErrRecordNotFound) {
+			t.Errorf(`Lookup(%q) got %v wanted ErrRecordNotFound`, key, err)
+		}
+		if after := reads(); after != before {
+			t.Errorf(`Lookup(%q) read %d pages; want the filter to skip them`, key, after-before)
+		}
+	}
+
+	// Present keys always get past the filter
+	for key, want := range rids {
+		before := reads()
+		rid, err := heap.Lookup([]byte(key))
+		if err != nil {
+			t.Fatalf(`Lookup(%q) got %q wanted nil`, key, err)
+		}
+		if rid != want {
+			t.Errorf(`Lookup(%q) = %v; want %v`, key, rid, want)
+		}
+		if reads() == before {
+			t.Errorf(`Lookup(%q) read no pages`, key)
+		}
+	}
+
+	// Deleting rebuilds the filter, so the deleted key is ruled out again
+	if err := heap.Delete(rids["key-07"]); err != nil {
+		t.Fatalf(`Delete() got %q wanted nil`, err)
+	}
+	page, err := pager.ReadPage(rids["key-07"].PageID)
+	if err != nil {
+		t.Fatalf(`ReadPage() got %q wanted nil`, err)
+	}
+	if page.MayContainKey([]byte("key-07")) {
+		t.Errorf(`MayContainKey() of a deleted key got true wanted false`)
+	}
+	if !page.MayContainKey([]byte("key-08")) {
+		t.Errorf(`MayContainKey() of a remaining key got false wanted true`)
+	}
+
+	// Changing the page directly leaves it without a filter rather than with
+	// a stale one
+	if _, err := page.InsertRecord([]byte("direct")); err != nil {
+		t.Fatalf(`InsertRecord() got %q wanted nil`, err)
+	}
+	if page.HasKeyFilter() || !page.MayContainKey([]byte("direct")) {
+		t.Errorf(`page changed outside the heap still has a key filter`)
+	}
+}
+
+func TestPagerMayContainKeyFromDisk(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "test.db")
+	pager, err := NewPager(PagerConfig{FilePath: path, MaxCacheSize: 100})
+	if err != nil {
+		t.Fatalf(`NewPager() got %q wanted nil`, err)
+	}
+	filtered, err := pager.AllocatePage(PageTypeData)
+	if err != nil {
+		t.Fatalf(`AllocatePage() got %q wanted nil`, err)
+	}
+	filtered.AddKey([]byte("present"))
+	plain, err := pager.AllocatePage(PageTypeData)
+	if err != nil {
+		t.Fatalf(`AllocatePage() got %q wanted nil`, err)
+	}
+	if err := pager.WritePages([]*Page{filtered, plain}); err != nil {
+		t.Fatalf(`WritePages() got %q wanted nil`, err)
+	}
+	if err := pager.Close(); err != nil {
+		t.Fatalf(`Close() got %q wanted nil`, err)
+	}
+
+	pager, err = NewPager(PagerConfig{FilePath: path, MaxCacheSize: 100})
+	if err != nil {
+		t.Fatalf(`NewPager() got %q wanted nil`, err)
+	}
+	defer pager.Close()
+	tests := []struct {
+		pageID PageID
+		key    string
+		want   bool
+	}{
+		{filtered.Header.PageID, "present", true},
+		{filtered.Header.PageID, "absent", false},
+		{plain.Header.PageID, "absent", true},
+	}
+	for _, test := range tests {
+		got, err := pager.MayContainKey(test.pageID, []byte(test.key))
+		if err != nil {
+			t.Fatalf(`MayContainKey() got %q wanted nil`, err)
+		}
+		if got != test.want {
+			t.Errorf(`MayContainKey(%d, %q) = %t; want %t`, test.pageID, test.key, got, test.want)
+		}
+	}
+	if stats := pager.Stats(); stats.CachedPages != 0 {
+		t.Errorf(`MayContainKey() cached %d pages; want none`, stats.CachedPages)
+	}
+
+	// The filter survives a full read of the page
+	page, err := pager.ReadPage(filtered.Header.PageID)
+	if err != nil {
+		t.Fatalf(`ReadPage() got %q wanted nil`, err)
+	}
+	if !page.HasKeyFilter() || page.MayContainKey([]byte("absent")) {
+		t.Errorf(`key filter was not read back with the page`)
+	}
+}
+
+func TestDamagedKeyFilterFailsChecksum(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "test.db")
+	pager, err := NewPager(PagerConfig{FilePath: path, MaxCacheSize: 100})
+	if err != nil {
+		t.Fatalf(`NewPager() got %q wanted nil`, err)
+	}
+	page, err := pager.AllocatePage(PageTypeData)
+	if err != nil {
+		t.Fatalf(`AllocatePage() got %q wanted nil`, err)
+	}
+	page.AddKey([]byte("present"))
+	if err := pager.WritePage(page); err != nil {
+		t.Fatalf(`WritePage() got %q wanted nil`, err)
+	}
+	if err := pager.Close(); err != nil {
+		t.Fatalf(`Close() got %q wanted nil`, err)
+	}
+
+	// Clearing the filter's bits would make the key look absent
+	file, err := os.OpenFile(path, os.O_RDWR, 0644)
+	if err != nil {
+		t.Fatalf(`OpenFile() got %q wanted nil`, err)
+	}
+	filter := int64(page.Header.PageID)*PageSize + HeaderSize + MaxBodySize + 8
+	if _, err := file.WriteAt(make([]byte, keyFilterSize), filter); err != nil {
+		t.Fatalf(`WriteAt() got %q wanted nil`, err)
+	}
+	file.Close()
+
+	pager, err = NewPager(PagerConfig{FilePath: path, MaxCacheSize: 100})
+	if err != nil {
+		t.Fatalf(`NewPager() got %q wanted nil`, err)
+	}
+	defer pager.Close()
+	if _, err := pager.MayContainKey(page.Header.PageID, []byte("present")); !errors.Is(err, ErrChecksumMismatch) {
+		t.Errorf(`MayContainKey() with a damaged filter got %v wanted ErrChecksumMismatch`, err)
+	}
+	if _, err := pager.ReadPage(page.Header.PageID); !errors.Is(err, ErrChecksumMismatch) {
+		t.Errorf(`ReadPage() with a damaged filter got %v wanted ErrChecksumMismatch`, err)
+	}
+	report, err := pager.ValidateAll()
+	if err != nil {
+		t.Fatalf(`ValidateAll() got %q wanted nil`, err)
+	}
+	if !slices.Equal(report.CorruptPages, []PageID{page.Header.PageID}) {
+		t.Errorf(`ValidateAll() corrupt pages = %v; want [%d]`, report.CorruptPages, page.Header.PageID)
+	}
+}
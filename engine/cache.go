@@ -0,0 +1,123 @@
+package engine
+
+import (
+	"fmt"
+	"math"
+	"runtime/debug"
+	"runtime/metrics"
+)
+
+// Adaptive cache sizing looks at the hit rate over each window of accesses.
+// A window whose hit rate falls below adaptiveGrowBelow grows the cache by a
+// quarter, up to the configured cap; memory pressure shrinks it by a quarter,
+// never below the configured MaxCacheSize
+const (
+	adaptiveWindow    = 64
+	adaptiveGrowBelow = 0.5
+)
+
+// PagerStats is a snapshot of the pager's cache counters
+type PagerStats struct {
+	CacheHits   uint64
+	CacheMisses uint64
+	// CacheSize is the current maximum number of cached pages, which moves
+	// at runtime when adaptive sizing is enabled
+	CacheSize   int
+	CachedPages int
+	// Prefetched counts the pages readahead has read into the cache
+	Prefetched uint64
+}
+
+// Stats returns the pager's cache counters
+func (p *Pager) Stats() PagerStats {
+	p.mutex.RLock()
+	defer p.mutex.RUnlock()
+	return PagerStats{
+		CacheHits:   p.cacheHits,
+		CacheMisses: p.cacheMisses,
+		CacheSize:   p.maxPages,
+		CachedPages: len(p.pageCache),
+		Prefetched:  p.prefetched,
+	}
+}
+
+// PinPage reads a page and keeps it in the cache until a matching UnpinPage,
+// so the returned *Page stays the cached copy. Pins nest
+func (p *Pager) PinPage(pageID PageID) (*Page, error) {
+	p.mutex.Lock()
+	defer p.mutex.Unlock()
+
+	page, err := p.readPage(pageID)
+	if err != nil {
+		return nil, err
+	}
+	page.pins++
+	return page, nil
+}
+
+// UnpinPage releases one pin taken by PinPage
+func (p *Pager) UnpinPage(pageID PageID) error {
+	p.mutex.Lock()
+	defer p.mutex.Unlock()
+
+	page, ok := p.pageCache[pageID]
+	if !ok || page.pins == 0 {
+		return &PagerError{
+			Op:  "UnpinPage",
+			Err: fmt.Errorf("page %d is not pinned", pageID),
+		}
+	}
+	page.pins--
+	return nil
+}
+
+// recordAccess counts a cache hit or miss and, in adaptive mode, resizes the
+// cache at the end of each window. The caller must hold p.mutex
+func (p *Pager) recordAccess(hit bool) {
+	if hit {
+		p.cacheHits++
+	} else {
+		p.cacheMisses++
+	}
+	if !p.adaptive {
+		return
+	}
+
+	if hit {
+		p.windowHits++
+	}
+	p.windowAccesses++
+	if p.windowAccesses < adaptiveWindow {
+		return
+	}
+	hitRate := float64(p.windowHits) / float64(p.windowAccesses)
+	p.windowHits, p.windowAccesses = 0, 0
+
+	switch {
+	case p.memoryPressure():
+		p.maxPages = max(p.minPages, p.maxPages-max(1, p.maxPages/4))
+		for len(p.pageCache) > p.maxPages {
+			// Shrinking is best effort; pinned or unwritable pages stay
+			if evicted, err := p.evictPage(); err != nil || !evicted {
+				break
+			}
+		}
+	case hitRate < adaptiveGrowBelow && p.maxPages < p.maxPagesCap:
+		p.maxPages = min(p.maxPagesCap, p.maxPages+max(1, p.maxPages/4))
+	}
+}
+
+// heapUnderPressure reports whether the live heap is above 90% of the Go
+// runtime's soft memory limit. Without a limit there is never pressure
+func heapUnderPressure() bool {
+	limit := debug.SetMemoryLimit(-1)
+	if limit == math.MaxInt64 {
+		return false
+	}
+	sample := []metrics.Sample{{Name: "/memory/classes/heap/objects:bytes"}}
+	metrics.Read(sample)
+	if sample[0].Value.Kind() != metrics.KindUint64 {
+		return false
+	}
+	return float64(sample[0].Value.Uint64()) > 0.9*float64(limit)
+}
@@ -0,0 +1,160 @@
+package engine
+
+import (
+	"slices"
+	"testing"
+)
+
+func TestAdaptiveCacheGrowsTowardCap(t *testing.T) {
+	pager, err := NewMemoryPager(PagerConfig{
+		MaxCacheSize:     4,
+		AdaptiveCache:    true,
+		AdaptiveCacheCap: 64,
+		MemoryPressure:   func() bool { return false },
+	})
+	if err != nil {
+		t.Fatalf(`NewMemoryPager() got %q wanted nil`, err)
+	}
+	defer pager.Close()
+
+	var pageIDs []PageID
+	for i := 0; i < 48; i++ {
+		page, err := pager.AllocatePage(PageTypeData)
+		if err != nil {
+			t.Fatalf(`AllocatePage() got %q wanted nil`, err)
+		}
+		pageIDs = append(pageIDs, page.Header.PageID)
+	}
+
+	// A cyclic scan over 48 pages misses every time in a 4-page LRU cache
+	for round := 0; round < 40; round++ {
+		for _, pageID := range pageIDs {
+			if _, err := pager.ReadPage(pageID); err != nil {
+				t.Fatalf(`ReadPage(%d) got %q wanted nil`, pageID, err)
+			}
+		}
+	}
+
+	stats := pager.Stats()
+	if stats.CacheSize < len(pageIDs) {
+		t.Errorf(`CacheSize = %d; want grown to at least the working set of %d`, stats.CacheSize, len(pageIDs))
+	}
+	if stats.CacheSize > 64 {
+		t.Errorf(`CacheSize = %d; want at most the cap of 64`, stats.CacheSize)
+	}
+	if stats.CacheHits == 0 {
+		t.Errorf(`CacheHits = 0; want hits once the cache holds the working set`)
+	}
+}
+
+func TestAdaptiveCacheShrinksUnderPressure(t *testing.T) {
+	pressure := false
+	pager, err := NewMemoryPager(PagerConfig{
+		MaxCacheSize:     4,
+		AdaptiveCache:    true,
+		AdaptiveCacheCap: 64,
+		MemoryPressure:   func() bool { return pressure },
+	})
+	if err != nil {
+		t.Fatalf(`NewMemoryPager() got %q wanted nil`, err)
+	}
+	defer pager.Close()
+
+	var pageIDs []PageID
+	for i := 0; i < 32; i++ {
+		page, err := pager.AllocatePage(PageTypeData)
+		if err != nil {
+			t.Fatalf(`AllocatePage() got %q wanted nil`, err)
+		}
+		pageIDs = append(pageIDs, page.Header.PageID)
+	}
+	readAll := func(rounds int) {
+		for round := 0; round < rounds; round++ {
+			for _, pageID := range pageIDs {
+				if _, err := pager.ReadPage(pageID); err != nil {
+					t.Fatalf(`ReadPage(%d) got %q wanted nil`, pageID, err)
+				}
+			}
+		}
+	}
+
+	readAll(20)
+	grown := pager.Stats().CacheSize
+	pressure = true
+	readAll(20)
+
+	stats := pager.Stats()
+	if stats.CacheSize >= grown {
+		t.Errorf(`CacheSize under pressure = %d; want below %d`, stats.CacheSize, grown)
+	}
+	if stats.CacheSize < 4 {
+		t.Errorf(`CacheSize = %d; want no smaller than MaxCacheSize 4`, stats.CacheSize)
+	}
+	if stats.CachedPages > stats.CacheSize {
+		t.Errorf(`CachedPages = %d; want at most CacheSize %d`, stats.CachedPages, stats.CacheSize)
+	}
+}
+
+type eviction struct {
+	pageID PageID
+	dirty  bool
+}
+
+func TestOnEvictSkipsPinnedPages(t *testing.T) {
+	var evicted []eviction
+	pager, err := NewMemoryPager(PagerConfig{
+		MaxCacheSize: 2,
+		OnEvict: func(pageID PageID, dirty bool) {
+			evicted = append(evicted, eviction{pageID, dirty})
+		},
+	})
+	if err != nil {
+		t.Fatalf(`NewMemoryPager() got %q wanted nil`, err)
+	}
+	defer pager.Close()
+
+	for i := 0; i < 4; i++ {
+		if _, err := pager.AllocatePage(PageTypeData); err != nil {
+			t.Fatalf(`AllocatePage() got %q wanted nil`, err)
+		}
+	}
+	read := func(pageID PageID) *Page {
+		t.Helper()
+		page, err := pager.ReadPage(pageID)
+		if err != nil {
+			t.Fatalf(`ReadPage(%d) got %q wanted nil`, pageID, err)
+		}
+		return page
+	}
+
+	// Pages 3 and 4 are cached, 3 least recently
+	evicted = nil
+	read(1)
+	read(2)
+	read(3)
+	if _, err := pager.PinPage(3); err != nil {
+		t.Fatalf(`PinPage() got %q wanted nil`, err)
+	}
+	if err := pager.DeallocatePage(3); err == nil {
+		t.Errorf(`DeallocatePage() of a pinned page got nil wanted error`)
+	}
+	read(4).MarkDirty()
+	read(1)
+	read(2)
+	want := []eviction{{3, false}, {4, false}, {1, false}, {2, false}, {4, true}, {1, false}}
+	if !slices.Equal(evicted, want) {
+		t.Errorf(`evictions with page 3 pinned = %v; want %v`, evicted, want)
+	}
+
+	if err := pager.UnpinPage(3); err != nil {
+		t.Fatalf(`UnpinPage() got %q wanted nil`, err)
+	}
+	evicted = nil
+	read(4)
+	if want := []eviction{{3, false}}; !slices.Equal(evicted, want) {
+		t.Errorf(`evictions after unpinning = %v; want %v`, evicted, want)
+	}
+	if err := pager.UnpinPage(3); err == nil {
+		t.Errorf(`UnpinPage() of an unpinned page got nil wanted error`)
+	}
+}
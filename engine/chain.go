@@ -0,0 +1,107 @@
+package engine
+
+import (
+	"errors"
+	"fmt"
+)
+
+// ErrEndOfChain is returned when following a page link that is 0
+var ErrEndOfChain = errors.New("end of page chain")
+
+// NextPage reads the page linked from page's NextPageID, returning
+// ErrEndOfChain when page is the last in its chain
+func (p *Pager) NextPage(page *Page) (*Page, error) {
+	return p.linkedPage("NextPage", page.Header.NextPageID)
+}
+
+// PrevPage reads the page linked from page's PrevPageID, returning
+// ErrEndOfChain when page is the first in its chain
+func (p *Pager) PrevPage(page *Page) (*Page, error) {
+	return p.linkedPage("PrevPage", page.Header.PrevPageID)
+}
+
+func (p *Pager) linkedPage(op string, pageID PageID) (*Page, error) {
+	if pageID == 0 {
+		return nil, ErrEndOfChain
+	}
+	page, err := p.ReadPage(pageID)
+	if err != nil {
+		return nil, &PagerError{
+			Op:  op,
+			Err: fmt.Errorf("unable to read page %d: %w", pageID, err),
+		}
+	}
+	return page, nil
+}
+
+// WalkFrom calls fn on each page of the chain starting at startID, following
+// NextPageID until it reaches 0. The walk stops at the first error, from
+// reading a page or returned by fn, and returns it
+func (p *Pager) WalkFrom(startID PageID, fn func(*Page) error) error {
+	visited := make(map[PageID]bool)
+	for pageID := startID; pageID != 0; {
+		if visited[pageID] {
+			return &PagerError{
+				Op:  "WalkFrom",
+				Err: fmt.Errorf("cycle in page chain at page %d", pageID),
+			}
+		}
+		visited[pageID] = true
+
+		page, err := p.linkedPage("WalkFrom", pageID)
+		if err != nil {
+			return err
+		}
+		next := page.Header.NextPageID
+		if err := fn(page); err != nil {
+			return err
+		}
+		pageID = next
+	}
+	return nil
+}
+
+// LinkPages links next directly after prev, setting both directions of the
+// link and marking both pages dirty
+func LinkPages(prev, next *Page) {
+	prev.Header.NextPageID = next.Header.PageID
+	next.Header.PrevPageID = prev.Header.PageID
+	prev.MarkDirty()
+	next.MarkDirty()
+}
+
+// UnlinkPages splices page out of its chain, pointing its neighbors at each
+// other and clearing page's own links. The neighbors are read through pager,
+// and every page changed, page included, is written back with it: reading one
+// neighbor can evict the other, so marking the cached copies dirty could lose
+// the splice
+func UnlinkPages(page *Page, pager *Pager) error {
+	var prev, next *Page
+	var err error
+	if page.Header.PrevPageID != 0 {
+		if prev, err = pager.PrevPage(page); err != nil {
+			return err
+		}
+	}
+	if page.Header.NextPageID != 0 {
+		if next, err = pager.NextPage(page); err != nil {
+			return err
+		}
+	}
+
+	changed := []*Page{page}
+	switch {
+	case prev != nil && next != nil:
+		LinkPages(prev, next)
+		changed = append(changed, prev, next)
+	case prev != nil:
+		prev.Header.NextPageID = 0
+		changed = append(changed, prev)
+	case next != nil:
+		next.Header.PrevPageID = 0
+		changed = append(changed, next)
+	}
+	page.Header.NextPageID = 0
+	page.Header.PrevPageID = 0
+	return pager.WritePages(changed)
+}
@@ -0,0 +1,178 @@
+package engine
+
+import (
+	"errors"
+	"slices"
+	"testing"
+)
+
+// buildChain allocates n pages and links them in allocation order
+func buildChain(t *testing.T, pager *Pager, n int) []*Page {
+	t.Helper()
+	pages := make([]*Page, n)
+	for i := range pages {
+		page, err := pager.AllocatePage(PageTypeData)
+		if err != nil {
+			t.Fatalf(`AllocatePage() got %q wanted nil`, err)
+		}
+		pages[i] = page
+	}
+	for i := 1; i < len(pages); i++ {
+		LinkPages(pages[i-1], pages[i])
+	}
+	if err := pager.WritePages(pages); err != nil {
+		t.Fatalf(`WritePages() got %q wanted nil`, err)
+	}
+	return pages
+}
+
+func TestTraverseChain(t *testing.T) {
+	pager := newTestPager(t)
+	pages := buildChain(t, pager, 3)
+
+	var forward []PageID
+	page := pages[0]
+	for {
+		forward = append(forward, page.Header.PageID)
+		next, err := pager.NextPage(page)
+		if errors.Is(err, ErrEndOfChain) {
+			break
+		}
+		if err != nil {
+			t.Fatalf(`NextPage() got %q wanted nil`, err)
+		}
+		page = next
+	}
+
+	var backward []PageID
+	for {
+		backward = append(backward, page.Header.PageID)
+		prev, err := pager.PrevPage(page)
+		if errors.Is(err, ErrEndOfChain) {
+			break
+		}
+		if err != nil {
+			t.Fatalf(`PrevPage() got %q wanted nil`, err)
+		}
+		page = prev
+	}
+
+	want := []PageID{1, 2, 3}
+	if !slices.Equal(forward, want) {
+		t.Errorf(`forward walk = %v; want %v`, forward, want)
+	}
+	slices.Reverse(want)
+	if !slices.Equal(backward, want) {
+		t.Errorf(`backward walk = %v; want %v`, backward, want)
+	}
+}
+
+func TestWalkFrom(t *testing.T) {
+	pager := newTestPager(t)
+	pages := buildChain(t, pager, 3)
+
+	var walked []PageID
+	err := pager.WalkFrom(pages[0].Header.PageID, func(page *Page) error {
+		walked = append(walked, page.Header.PageID)
+		return nil
+	})
+	if err != nil {
+		t.Fatalf(`WalkFrom() got %q wanted nil`, err)
+	}
+	if want := []PageID{1, 2, 3}; !slices.Equal(walked, want) {
+		t.Errorf(`WalkFrom() visited %v; want %v`, walked, want)
+	}
+
+	stop := errors.New("stop")
+	walked = nil
+	err = pager.WalkFrom(pages[0].Header.PageID, func(page *Page) error {
+		walked = append(walked, page.Header.PageID)
+		if page.Header.PageID == 2 {
+			return stop
+		}
+		return nil
+	})
+	if !errors.Is(err, stop) {
+		t.Errorf(`WalkFrom() got %q wanted %q`, err, stop)
+	}
+	if want := []PageID{1, 2}; !slices.Equal(walked, want) {
+		t.Errorf(`WalkFrom() visited %v before stopping; want %v`, walked, want)
+	}
+
+	// A chain that loops back on itself is reported rather than walked forever
+	pages[2].Header.NextPageID = pages[0].Header.PageID
+	if err := pager.WritePage(pages[2]); err != nil {
+		t.Fatalf(`WritePage() got %q wanted nil`, err)
+	}
+	if err := pager.WalkFrom(pages[0].Header.PageID, func(*Page) error { return nil }); err == nil {
+		t.Errorf(`WalkFrom() on a cyclic chain got nil wanted error`)
+	}
+}
+
+func TestUnlinkMiddlePage(t *testing.T) {
+	pager := newTestPager(t)
+	pages := buildChain(t, pager, 3)
+
+	if err := UnlinkPages(pages[1], pager); err != nil {
+		t.Fatalf(`UnlinkPages() got %q wanted nil`, err)
+	}
+	if err := pager.FlushAll(); err != nil {
+		t.Fatalf(`FlushAll() got %q wanted nil`, err)
+	}
+
+	var walked []PageID
+	err := pager.WalkFrom(pages[0].Header.PageID, func(page *Page) error {
+		walked = append(walked, page.Header.PageID)
+		return nil
+	})
+	if err != nil {
+		t.Fatalf(`WalkFrom() got %q wanted nil`, err)
+	}
+	if want := []PageID{1, 3}; !slices.Equal(walked, want) {
+		t.Errorf(`chain after unlink = %v; want %v`, walked, want)
+	}
+
+	// The flushed links on disk agree in both directions
+	for _, want := range []PageHeader{
+		{PageID: 1, NextPageID: 3},
+		{PageID: 2},
+		{PageID: 3, PrevPageID: 1},
+	} {
+		page, err := pager.readPageFromDisk(want.PageID)
+		if err != nil {
+			t.Fatalf(`readPageFromDisk(%d) got %q wanted nil`, want.PageID, err)
+		}
+		if page.Header.NextPageID != want.NextPageID || page.Header.PrevPageID != want.PrevPageID {
+			t.Errorf(`page %d links = (next %d, prev %d); want (next %d, prev %d)`, want.PageID,
+				page.Header.NextPageID, page.Header.PrevPageID, want.NextPageID, want.PrevPageID)
+		}
+	}
+}
+
+func TestUnlinkPagesWithTinyCache(t *testing.T) {
+	// A single cached page means reading one neighbor evicts the other
+	pager, err := NewMemoryPager(PagerConfig{MaxCacheSize: 1})
+	if err != nil {
+		t.Fatalf(`NewMemoryPager() got %q wanted nil`, err)
+	}
+	defer pager.Close()
+	pages := buildChain(t, pager, 3)
+
+	if err := UnlinkPages(pages[1], pager); err != nil {
+		t.Fatalf(`UnlinkPages() got %q wanted nil`, err)
+	}
+	for _, want := range []PageHeader{
+		{PageID: 1, NextPageID: 3},
+		{PageID: 2},
+		{PageID: 3, PrevPageID: 1},
+	} {
+		page, err := pager.ReadPage(want.PageID)
+		if err != nil {
+			t.Fatalf(`ReadPage(%d) got %q wanted nil`, want.PageID, err)
+		}
+		if page.Header.NextPageID != want.NextPageID || page.Header.PrevPageID != want.PrevPageID {
+			t.Errorf(`page %d links = (next %d, prev %d); want (next %d, prev %d)`, want.PageID,
+				page.Header.NextPageID, page.Header.PrevPageID, want.NextPageID, want.PrevPageID)
+		}
+	}
+}
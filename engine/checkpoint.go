@@ -0,0 +1,134 @@
+package engine
+
+import (
+	"encoding/binary"
+	"fmt"
+)
+
+// A checkpoint entry holds two tables, each a uint32 count followed by that
+// many pairs of uint64s: NewData maps each active transaction to the LSN of its
+// first write, and OldData maps each dirty page to its recLSN
+const (
+	checkpointPairSize   = 16
+	maxCheckpointEntries = (PageSize - 4) / checkpointPairSize
+)
+
+// Checkpoint makes every page change logged so far durable in the pager's file
+// and logs a checkpoint entry recording the transactions still in flight and
+// the pages dirtied again since the flush. The checkpoint's LSN and log offset
+// are stored in the superblock, so Recover only redoes entries from the oldest
+// recLSN in the dirty page table, or after the checkpoint if it is empty, and
+// only reads back as far as the oldest transaction that was active at it.
+//
+// When the log has an ArchiveDir and no transaction is active or page dirty,
+// Checkpoint first seals the log's segment as Rotate does, so the checkpoint
+// starts a new one. Each file sharing a log then has to be checkpointed
+// before the log is, since the sealed entries are no longer recovered from
+func Checkpoint(pager *Pager, wal *WriteAheadLog) error {
+	// Pages can only be written once the log entries describing them are
+	if err := wal.Flush(); err != nil {
+		return &PagerError{
+			Op:  "Checkpoint",
+			Err: fmt.Errorf("unable to flush log: %w", err),
+		}
+	}
+	if err := pager.FlushAll(); err != nil {
+		return &PagerError{
+			Op:  "Checkpoint",
+			Err: fmt.Errorf("unable to flush pages: %w", err),
+		}
+	}
+
+	// With nothing left to redo or undo, the log so far is only history and
+	// an archived log seals it
+	if len(pager.DirtyPageTable()) == 0 {
+		if err := wal.sealIfIdle(); err != nil {
+			return &PagerError{
+				Op:  "Checkpoint",
+				Err: fmt.Errorf("unable to seal log segment: %w", err),
+			}
+		}
+	}
+
+	entry := &WriteAheadLogEntry{Type: EntryTypeCheckpoint}
+	if err := encodeLSNTable(entry.OldData[:], pager.DirtyPageTable()); err != nil {
+		return &PagerError{
+			Op:  "Checkpoint",
+			Err: fmt.Errorf("dirty page table: %w", err),
+		}
+	}
+	if err := wal.Append(entry); err != nil {
+		return &PagerError{
+			Op:  "Checkpoint",
+			Err: fmt.Errorf("unable to log checkpoint: %w", err),
+		}
+	}
+	if err := wal.Flush(); err != nil {
+		return &PagerError{
+			Op:  "Checkpoint",
+			Err: fmt.Errorf("unable to flush log: %w", err),
+		}
+	}
+	offset, err := wal.entryOffset(entry.LSN)
+	if err != nil {
+		return &PagerError{Op: "Checkpoint", Err: err}
+	}
+
+	pager.mutex.Lock()
+	defer pager.mutex.Unlock()
+	pager.superblock.checkpointLSN = entry.LSN
+	pager.superblock.checkpointOffset = offset
+	if err := pager.writeSuperblock(); err != nil {
+		return &PagerError{Op: "Checkpoint", Err: err}
+	}
+	return nil
+}
+
+// encodeActiveTxns stores the active transaction table in a checkpoint entry
+func encodeActiveTxns(entry *WriteAheadLogEntry, active map[uint64]uint64) error {
+	if err := encodeLSNTable(entry.NewData[:], active); err != nil {
+		return fmt.Errorf("active transaction table: %w", err)
+	}
+	return nil
+}
+
+// decodeCheckpoint reads the active transaction and dirty page tables from a
+// checkpoint entry
+func decodeCheckpoint(entry *WriteAheadLogEntry) (map[uint64]uint64, map[PageID]uint64, error) {
+	active, err := decodeLSNTable[uint64](entry.NewData[:])
+	if err != nil {
+		return nil, nil, fmt.Errorf("checkpoint LSN %d active transaction table: %w", entry.LSN, err)
+	}
+	dirty, err := decodeLSNTable[PageID](entry.OldData[:])
+	if err != nil {
+		return nil, nil, fmt.Errorf("checkpoint LSN %d dirty page table: %w", entry.LSN, err)
+	}
+	return active, dirty, nil
+}
+
+func encodeLSNTable[K ~uint64](data []byte, table map[K]uint64) error {
+	if len(table) > maxCheckpointEntries {
+		return fmt.Errorf("%d entries exceed the checkpoint limit of %d", len(table), maxCheckpointEntries)
+	}
+	binary.LittleEndian.PutUint32(data, uint32(len(table)))
+	offset := 4
+	for key, lsn := range table {
+		binary.LittleEndian.PutUint64(data[offset:], uint64(key))
+		binary.LittleEndian.PutUint64(data[offset+8:], lsn)
+		offset += checkpointPairSize
+	}
+	return nil
+}
+
+func decodeLSNTable[K ~uint64](data []byte) (map[K]uint64, error) {
+	count := int(binary.LittleEndian.Uint32(data))
+	if count > maxCheckpointEntries {
+		return nil, fmt.Errorf("%d entries exceed the checkpoint limit of %d", count, maxCheckpointEntries)
+	}
+	table := make(map[K]uint64, count)
+	for i := 0; i < count; i++ {
+		offset := 4 + i*checkpointPairSize
+		table[K(binary.LittleEndian.Uint64(data[offset:]))] = binary.LittleEndian.Uint64(data[offset+8:])
+	}
+	return table, nil
+}
@@ -0,0 +1,143 @@
+package engine
+
+import "testing"
+
+func TestCheckpointBoundsRecovery(t *testing.T) {
+	pager := newTestPager(t)
+	wal := newTestWAL(t)
+
+	pages := make([]*Page, 3)
+	for i := range pages {
+		page, err := pager.AllocatePage(PageTypeData)
+		if err != nil {
+			t.Fatalf(`AllocatePage() got %q wanted nil`, err)
+		}
+		pages[i] = page
+	}
+	update := func(txnID uint64, page *Page, value byte) {
+		t.Helper()
+		before := clonePage(page)
+		page.Body[0] = value
+		logPageWrite(t, pager, wal, txnID, before, page)
+		if err := pager.WritePage(page); err != nil {
+			t.Fatalf(`WritePage() got %q wanted nil`, err)
+		}
+	}
+	commit := func(txnID uint64) {
+		t.Helper()
+		if err := wal.Append(&WriteAheadLogEntry{TxnID: txnID, Type: EntryTypeCommit}); err != nil {
+			t.Fatalf(`Append() got %q wanted nil`, err)
+		}
+	}
+
+	// Transaction 1 commits before the checkpoint; transaction 2 is still
+	// running when it is taken
+	update(1, pages[0], 1)
+	commit(1)
+	update(2, pages[1], 2)
+	if err := Checkpoint(pager, wal); err != nil {
+		t.Fatalf(`Checkpoint() got %q wanted nil`, err)
+	}
+
+	entries, err := wal.Replay()
+	if err != nil {
+		t.Fatalf(`Replay() got %q wanted nil`, err)
+	}
+	last := entries[len(entries)-1]
+	if last.Type != EntryTypeCheckpoint {
+		t.Fatalf(`last entry type = %s; want CHECKPOINT`, last.Type)
+	}
+	buffer := make([]byte, PageSize)
+	pager.file.ReadAt(buffer, 0)
+	sb, err := decodeSuperblock(buffer)
+	if err != nil {
+		t.Fatalf(`decodeSuperblock() got %q wanted nil`, err)
+	}
+	if sb.checkpointLSN != last.LSN {
+		t.Errorf(`superblock checkpoint LSN = %d; want %d`, sb.checkpointLSN, last.LSN)
+	}
+	if want := int64(len(entries)-1) * int64(ENTRY_SIZE); sb.checkpointOffset != want {
+		t.Errorf(`superblock checkpoint offset = %d; want %d`, sb.checkpointOffset, want)
+	}
+
+	// Transaction 3 commits after the checkpoint
+	update(3, pages[2], 3)
+	commit(3)
+	if err := wal.Flush(); err != nil {
+		t.Fatalf(`Flush() got %q wanted nil`, err)
+	}
+
+	// Change page 1 behind the log's back: redo of transaction 1 would only
+	// overwrite it if recovery started before the checkpoint
+	pages[0].Body[0] = 99
+	if err := pager.WritePage(pages[0]); err != nil {
+		t.Fatalf(`WritePage() got %q wanted nil`, err)
+	}
+
+	if err := Recover(pager, wal); err != nil {
+		t.Fatalf(`Recover() got %q wanted nil`, err)
+	}
+	for i, want := range []byte{99, 0, 3} {
+		page, err := pager.ReadPage(pages[i].Header.PageID)
+		if err != nil {
+			t.Fatalf(`ReadPage() got %q wanted nil`, err)
+		}
+		if page.Body[0] != want {
+			t.Errorf(`page %d body[0] after recovery = %d; want %d`, page.Header.PageID, page.Body[0], want)
+		}
+	}
+}
+
+func TestActiveTxnTableRoundTrip(t *testing.T) {
+	active := map[uint64]uint64{7: 3, 9: 12}
+	entry := &WriteAheadLogEntry{Type: EntryTypeCheckpoint}
+	if err := encodeActiveTxns(entry, active); err != nil {
+		t.Fatalf(`encodeActiveTxns() got %q wanted nil`, err)
+	}
+	decoded, err := decodeLSNTable[uint64](entry.NewData[:])
+	if err != nil {
+		t.Fatalf(`decodeLSNTable() got %q wanted nil`, err)
+	}
+	if len(decoded) != 2 || decoded[7] != 3 || decoded[9] != 12 {
+		t.Errorf(`decodeLSNTable() = %v; want %v`, decoded, active)
+	}
+}
+
+func TestRecoveryStartsAtOldestRecLSN(t *testing.T) {
+	pager := newTestPager(t)
+	wal := newTestWAL(t)
+
+	// Transaction 1 is active from LSN 2; page 5 was dirtied at LSN 3 and is
+	// not yet on disk when the checkpoint is logged at LSN 6
+	for _, entry := range []*WriteAheadLogEntry{
+		{TxnID: 9, Type: EntryTypeCommit},
+		{TxnID: 1, Type: EntryTypeWrite, PageID: 4},
+		{TxnID: 2, Type: EntryTypeWrite, PageID: 5},
+		{TxnID: 2, Type: EntryTypeCommit},
+		{TxnID: 3, Type: EntryTypeCommit},
+	} {
+		if err := wal.Append(entry); err != nil {
+			t.Fatalf(`Append() got %q wanted nil`, err)
+		}
+	}
+	checkpoint := &WriteAheadLogEntry{Type: EntryTypeCheckpoint}
+	if err := encodeLSNTable(checkpoint.OldData[:], map[PageID]uint64{5: 3}); err != nil {
+		t.Fatalf(`encodeLSNTable() got %q wanted nil`, err)
+	}
+	if err := wal.Append(checkpoint); err != nil {
+		t.Fatalf(`Append() got %q wanted nil`, err)
+	}
+	if err := wal.Flush(); err != nil {
+		t.Fatalf(`Flush() got %q wanted nil`, err)
+	}
+	pager.superblock.checkpointLSN = checkpoint.LSN
+	pager.superblock.checkpointOffset = 5 * int64(ENTRY_SIZE)
+
+	startLSN, redoAfter, err := pager.recoveryStart(wal)
+	if err != nil {
+		t.Fatalf(`recoveryStart() got %q wanted nil`, err)
+	}
+	if startLSN != 2 || redoAfter != 2 {
+		t.Errorf(`recoveryStart() = (start %d, redo after %d); want (2, 2)`, startLSN, redoAfter)
+	}
+}
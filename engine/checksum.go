@@ -0,0 +1,108 @@
+package engine
+
+import (
+	"encoding/binary"
+	"fmt"
+	"hash/crc32"
+	"math/bits"
+)
+
+// ChecksumAlgorithm selects how page checksums are computed. The algorithm
+// a file was created with is recorded in its superblock
+type ChecksumAlgorithm uint8
+
+const (
+	ChecksumCRC32C ChecksumAlgorithm = iota
+	ChecksumXXHash
+)
+
+var checksumTable = crc32.MakeTable(crc32.Castagnoli)
+
+// Checksummer computes the checksum stored in a page header
+type Checksummer interface {
+	Checksum(data []byte) uint32
+}
+
+func (a ChecksumAlgorithm) String() string {
+	switch a {
+	case ChecksumCRC32C:
+		return "crc32c"
+	case ChecksumXXHash:
+		return "xxhash"
+	default:
+		return fmt.Sprintf("unknown(%d)", uint8(a))
+	}
+}
+
+// checksummer returns the implementation of an algorithm
+func (a ChecksumAlgorithm) checksummer() (Checksummer, error) {
+	switch a {
+	case ChecksumCRC32C:
+		return crc32cChecksummer{}, nil
+	case ChecksumXXHash:
+		return xxhashChecksummer{}, nil
+	default:
+		return nil, fmt.Errorf("unknown checksum algorithm %d", uint8(a))
+	}
+}
+
+type crc32cChecksummer struct{}
+
+func (crc32cChecksummer) Checksum(data []byte) uint32 {
+	return crc32.Checksum(data, checksumTable)
+}
+
+// xxhashChecksummer computes XXH32 with a zero seed
+type xxhashChecksummer struct{}
+
+const (
+	xxhPrime1 uint32 = 0x9E3779B1
+	xxhPrime2 uint32 = 0x85EBCA77
+	xxhPrime3 uint32 = 0xC2B2AE3D
+	xxhPrime4 uint32 = 0x27D4EB2F
+	xxhPrime5 uint32 = 0x165667B1
+)
+
+func xxhRound(acc, lane uint32) uint32 {
+	return bits.RotateLeft32(acc+lane*xxhPrime2, 13) * xxhPrime1
+}
+
+func (xxhashChecksummer) Checksum(data []byte) uint32 {
+	length := uint32(len(data))
+	var h uint32
+
+	if len(data) >= 16 {
+		var seed uint32
+		v1 := seed + xxhPrime1 + xxhPrime2
+		v2 := seed + xxhPrime2
+		v3 := seed
+		v4 := seed - xxhPrime1
+		for ; len(data) >= 16; data = data[16:] {
+			v1 = xxhRound(v1, binary.LittleEndian.Uint32(data[0:4]))
+			v2 = xxhRound(v2, binary.LittleEndian.Uint32(data[4:8]))
+			v3 = xxhRound(v3, binary.LittleEndian.Uint32(data[8:12]))
+			v4 = xxhRound(v4, binary.LittleEndian.Uint32(data[12:16]))
+		}
+		h = bits.RotateLeft32(v1, 1) + bits.RotateLeft32(v2, 7) +
+			bits.RotateLeft32(v3, 12) + bits.RotateLeft32(v4, 18)
+	} else {
+		h = xxhPrime5
+	}
+	h += length
+
+	for ; len(data) >= 4; data = data[4:] {
+		h += binary.LittleEndian.Uint32(data[0:4]) * xxhPrime3
+		h = bits.RotateLeft32(h, 17) * xxhPrime4
+	}
+	for _, b := range data {
+		h += uint32(b) * xxhPrime5
+		h = bits.RotateLeft32(h, 11) * xxhPrime1
+	}
+
+	h ^= h >> 15
+	h *= xxhPrime2
+	h ^= h >> 13
+	h *= xxhPrime3
+	h ^= h >> 16
+	return h
+}
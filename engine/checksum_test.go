@@ -0,0 +1,110 @@
+package engine
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestXXHashReferenceVectors(t *testing.T) {
+	vectors := map[string]uint32{
+		"":    0x02CC5D05,
+		"a":   0x550D7456,
+		"abc": 0x32D153FF,
+		"Nobody inspects the spammish repetition": 0xE2293B2F,
+	}
+	for input, want := range vectors {
+		if got := (xxhashChecksummer{}).Checksum([]byte(input)); got != want {
+			t.Errorf(`XXH32(%q) = %08x; want %08x`, input, got, want)
+		}
+	}
+}
+
+func TestXXHashDatabaseReopens(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "xxhash.db")
+	pager, err := NewPager(PagerConfig{FilePath: path, MaxCacheSize: 10, Checksum: ChecksumXXHash})
+	if err != nil {
+		t.Fatalf(`NewPager() got %q wanted nil`, err)
+	}
+	page, err := pager.AllocatePage(PageTypeData)
+	if err != nil {
+		t.Fatalf(`AllocatePage() got %q wanted nil`, err)
+	}
+	copy(page.Body, "hashed with xxhash")
+	if err := pager.WritePage(page); err != nil {
+		t.Fatalf(`WritePage() got %q wanted nil`, err)
+	}
+	if want := (xxhashChecksummer{}).Checksum(page.Body); page.Header.Checksum != want {
+		t.Errorf(`Checksum = %08x; want xxhash %08x`, page.Header.Checksum, want)
+	}
+	if err := pager.Close(); err != nil {
+		t.Fatalf(`Close() got %q wanted nil`, err)
+	}
+
+	// The superblock's choice wins over the config of a later open
+	reopened, err := NewPager(PagerConfig{FilePath: path, MaxCacheSize: 10, Checksum: ChecksumCRC32C})
+	if err != nil {
+		t.Fatalf(`NewPager() got %q wanted nil`, err)
+	}
+	defer reopened.Close()
+	if reopened.superblock.checksum != ChecksumXXHash {
+		t.Errorf(`reopened checksum = %s; want xxhash`, reopened.superblock.checksum)
+	}
+	read, err := reopened.ReadPage(page.Header.PageID)
+	if err != nil {
+		t.Fatalf(`ReadPage() got %q wanted nil`, err)
+	}
+	if err := reopened.ValidatePage(read); err != nil {
+		t.Errorf(`ValidatePage() got %q wanted nil`, err)
+	}
+}
+
+func TestChecksumMismatchDetected(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "corrupt.db")
+	pager, err := NewPager(PagerConfig{FilePath: path, MaxCacheSize: 10, Checksum: ChecksumXXHash})
+	if err != nil {
+		t.Fatalf(`NewPager() got %q wanted nil`, err)
+	}
+	page, err := pager.AllocatePage(PageTypeData)
+	if err != nil {
+		t.Fatalf(`AllocatePage() got %q wanted nil`, err)
+	}
+	pager.Close()
+
+	file, err := os.OpenFile(path, os.O_RDWR, 0644)
+	if err != nil {
+		t.Fatalf(`OpenFile() got %q wanted nil`, err)
+	}
+	file.WriteAt([]byte{0xFF}, int64(page.Header.PageID)*PageSize+HeaderSize+10)
+	file.Close()
+
+	reopened, err := NewPager(PagerConfig{FilePath: path, MaxCacheSize: 10})
+	if err != nil {
+		t.Fatalf(`NewPager() got %q wanted nil`, err)
+	}
+	defer reopened.Close()
+	if _, err := reopened.ReadPage(page.Header.PageID); !errors.Is(err, ErrChecksumMismatch) {
+		t.Errorf(`ReadPage() of corrupt page got %v wanted ErrChecksumMismatch`, err)
+	}
+}
+
+func benchmarkChecksum(b *testing.B, checksummer Checksummer) {
+	page := make([]byte, PageSize)
+	for i := range page {
+		page[i] = byte(i * 7)
+	}
+	b.SetBytes(PageSize)
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		checksummer.Checksum(page)
+	}
+}
+
+func BenchmarkChecksumCRC32C(b *testing.B) {
+	benchmarkChecksum(b, crc32cChecksummer{})
+}
+
+func BenchmarkChecksumXXHash(b *testing.B) {
+	benchmarkChecksum(b, xxhashChecksummer{})
+}
@@ -0,0 +1,89 @@
+// Command gdbcheck verifies the page checksums of a GopherDB file, and
+// optionally the entry checksums of its write-ahead log, exiting with status 1
+// if anything is corrupt
+package main
+
+import (
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+
+	"engine"
+)
+
+func main() {
+	os.Exit(run(os.Args[1:], os.Stdout, os.Stderr))
+}
+
+// run checks the files named by args, writes the report to stdout and
+// returns the exit status: 0 when everything is valid, 1 when corruption was
+// found and 2 when the check could not be run
+func run(args []string, stdout, stderr io.Writer) int {
+	flags := flag.NewFlagSet("gdbcheck", flag.ContinueOnError)
+	flags.SetOutput(stderr)
+	walPath := flags.String("wal", "", "also verify the entries of this write-ahead log")
+	flags.Usage = func() {
+		fmt.Fprintln(stderr, "usage: gdbcheck [-wal <wal-file>] <db-file>")
+		flags.PrintDefaults()
+	}
+	if err := flags.Parse(args); err != nil {
+		return 2
+	}
+	if flags.NArg() != 1 {
+		flags.Usage()
+		return 2
+	}
+
+	pager, err := engine.NewPager(engine.PagerConfig{
+		FilePath:     flags.Arg(0),
+		MaxCacheSize: 1,
+		ReadOnly:     true,
+	})
+	if err != nil {
+		fmt.Fprintln(stderr, "gdbcheck:", err)
+		return 2
+	}
+	defer pager.Close()
+	report, err := pager.ValidateAll()
+	if err != nil {
+		fmt.Fprintln(stderr, "gdbcheck:", err)
+		return 2
+	}
+	fmt.Fprintf(stdout, "pages: %d\n", report.TotalPages)
+	fmt.Fprintf(stdout, "corrupt pages: %s\n", list(report.CorruptPages))
+	fmt.Fprintf(stdout, "torn pages: %s\n", list(report.TornPages))
+	ok := report.OK()
+
+	if *walPath != "" {
+		walReport, err := engine.ValidateWAL(*walPath)
+		if err != nil {
+			fmt.Fprintln(stderr, "gdbcheck:", err)
+			return 2
+		}
+		fmt.Fprintf(stdout, "wal entries: %d\n", walReport.Entries)
+		fmt.Fprintf(stdout, "corrupt wal entries at offsets: %s\n", list(walReport.CorruptOffsets))
+		if walReport.TornBytes > 0 {
+			fmt.Fprintf(stdout, "torn wal tail: %d bytes\n", walReport.TornBytes)
+		}
+		ok = ok && walReport.OK()
+	}
+
+	if !ok {
+		return 1
+	}
+	return 0
+}
+
+// list formats values as a space-separated list, or "none"
+func list[T any](values []T) string {
+	if len(values) == 0 {
+		return "none"
+	}
+	parts := make([]string, len(values))
+	for i, value := range values {
+		parts[i] = fmt.Sprint(value)
+	}
+	return strings.Join(parts, " ")
+}
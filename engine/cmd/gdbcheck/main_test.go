@@ -0,0 +1,59 @@
+package main
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"engine"
+)
+
+func TestRunReportsCorruptPage(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "check.db")
+	pager, err := engine.NewPager(engine.PagerConfig{FilePath: path, MaxCacheSize: 100})
+	if err != nil {
+		t.Fatalf(`NewPager() got %q wanted nil`, err)
+	}
+	for i := 0; i < 4; i++ {
+		if _, err := pager.AllocatePage(engine.PageTypeData); err != nil {
+			t.Fatalf(`AllocatePage() got %q wanted nil`, err)
+		}
+	}
+	if err := pager.Close(); err != nil {
+		t.Fatalf(`Close() got %q wanted nil`, err)
+	}
+
+	var stdout, stderr bytes.Buffer
+	if code := run([]string{path}, &stdout, &stderr); code != 0 {
+		t.Fatalf("run() on a valid file = %d; want 0\n%s%s", code, stdout.String(), stderr.String())
+	}
+
+	file, err := os.OpenFile(path, os.O_RDWR, 0644)
+	if err != nil {
+		t.Fatalf(`OpenFile() got %q wanted nil`, err)
+	}
+	file.WriteAt([]byte{0xff}, 3*engine.PageSize+engine.HeaderSize+10)
+	file.Close()
+
+	stdout.Reset()
+	stderr.Reset()
+	if code := run([]string{path}, &stdout, &stderr); code != 1 {
+		t.Errorf("run() on a corrupt file = %d; want 1\n%s", code, stderr.String())
+	}
+	want := "pages: 4\ncorrupt pages: 3\ntorn pages: none\n"
+	if stdout.String() != want {
+		t.Errorf("run() printed\n%s\nwant\n%s", stdout.String(), want)
+	}
+}
+
+func TestRunUsage(t *testing.T) {
+	var stdout, stderr bytes.Buffer
+	if code := run(nil, &stdout, &stderr); code != 2 {
+		t.Errorf(`run() without a file = %d; want 2`, code)
+	}
+	if !strings.Contains(stderr.String(), "usage: gdbcheck") {
+		t.Errorf(`run() without a file printed %q; want usage`, stderr.String())
+	}
+}
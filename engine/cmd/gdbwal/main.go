@@ -0,0 +1,20 @@
+// Command gdbwal prints the entries of a GopherDB write-ahead log
+package main
+
+import (
+	"fmt"
+	"os"
+
+	"engine"
+)
+
+func main() {
+	if len(os.Args) != 2 {
+		fmt.Fprintln(os.Stderr, "usage: gdbwal <wal-file>")
+		os.Exit(2)
+	}
+	if err := engine.DumpWAL(os.Stdout, os.Args[1]); err != nil {
+		fmt.Fprintln(os.Stderr, "gdbwal:", err)
+		os.Exit(1)
+	}
+}
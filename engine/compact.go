@@ -0,0 +1,307 @@
+package engine
+
+import (
+	"encoding/binary"
+	"fmt"
+	"os"
+	"path/filepath"
+)
+
+// Compact rewrites every live page of the file at srcPath densely into a new
+// file at dstPath, remapping PageIDs and the NextPageID/PrevPageID links
+// between them. Free pages are dropped, so the result is no larger than the
+// source. It must be run offline: nothing else may have srcPath open while it
+// runs, and dstPath must not already exist.
+//
+// The PageIDs pages store in their bodies are remapped too: the overflow
+// chains heap records spilled into and the pages and tail of a saved
+// free-space index. References from outside the file are not, so a file of a
+// Database must be compacted with CompactDatabase, which updates the table
+// heads in its catalog, and LOB locators a caller stored in its own records
+// go stale.
+func Compact(srcPath, dstPath string) error {
+	_, err := compact(srcPath, dstPath)
+	return err
+}
+
+// compact is Compact returning the mapping from old to new PageIDs
+func compact(srcPath, dstPath string) (map[PageID]PageID, error) {
+	if _, err := os.Stat(dstPath); err == nil {
+		return nil, &PagerError{
+			Op:  "Compact",
+			Err: fmt.Errorf("destination `%s` already exists", dstPath),
+		}
+	}
+
+	src, err := NewPager(PagerConfig{FilePath: srcPath, MaxCacheSize: 1, ReadOnly: true})
+	if err != nil {
+		return nil, err
+	}
+	defer src.Close()
+
+	srcSize, err := src.file.Size()
+	if err != nil {
+		return nil, &PagerError{
+			Op:  "Compact",
+			Err: fmt.Errorf("unable to get file info: %w", err),
+		}
+	}
+	pageCount := PageID(srcSize / PageSize)
+
+	// First pass: assign dense PageIDs to live pages in their original order
+	remap := make(map[PageID]PageID)
+	var live []PageID
+	for pageID := PageID(1); pageID < pageCount; pageID++ {
+		page, err := src.readPageFromDisk(pageID)
+		if err != nil {
+			return nil, &PagerError{
+				Op:  "Compact",
+				Err: fmt.Errorf("unable to read source page %d: %w", pageID, err),
+			}
+		}
+		if page.Header.PageType == PageTypeFree {
+			continue
+		}
+		live = append(live, pageID)
+		remap[pageID] = PageID(len(live))
+	}
+
+	dst, err := NewPager(PagerConfig{
+		FilePath:     dstPath,
+		MaxCacheSize: 1,
+		Checksum:     src.superblock.checksum,
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	// Second pass: copy each live page to its new location, fixing its links
+	for _, oldID := range live {
+		page, err := src.readPageFromDisk(oldID)
+		if err != nil {
+			dst.Close()
+			return nil, &PagerError{
+				Op:  "Compact",
+				Err: fmt.Errorf("unable to read source page %d: %w", oldID, err),
+			}
+		}
+
+		newPage, err := dst.AllocatePage(page.Header.PageType)
+		if err != nil {
+			dst.Close()
+			return nil, err
+		}
+		if newPage.Header.PageID != remap[oldID] {
+			dst.Close()
+			return nil, &PagerError{
+				Op:  "Compact",
+				Err: fmt.Errorf("destination allocated page %d, expected %d", newPage.Header.PageID, remap[oldID]),
+			}
+		}
+
+		newPage.Header = page.Header
+		newPage.Header.PageID = remap[oldID]
+		if newPage.Header.NextPageID, err = remapLink(remap, oldID, page.Header.NextPageID); err != nil {
+			dst.Close()
+			return nil, err
+		}
+		if newPage.Header.PrevPageID, err = remapLink(remap, oldID, page.Header.PrevPageID); err != nil {
+			dst.Close()
+			return nil, err
+		}
+		copy(newPage.Body, page.Body)
+		if err := remapBody(remap, oldID, newPage); err != nil {
+			dst.Close()
+			return nil, err
+		}
+		newPage.Footer = page.Footer
+		newPage.MarkDirty()
+	}
+
+	if err := dst.Close(); err != nil {
+		return nil, err
+	}
+	return remap, nil
+}
+
+// remapLink translates a page link through the compaction mapping, rejecting
+// links that point at free or missing pages
+func remapLink(remap map[PageID]PageID, from PageID, link PageID) (PageID, error) {
+	if link == 0 {
+		return 0, nil
+	}
+	newID, ok := remap[link]
+	if !ok {
+		return 0, &PagerError{
+			Op:  "Compact",
+			Err: fmt.Errorf("page %d links to page %d which is not live", from, link),
+		}
+	}
+	return newID, nil
+}
+
+// remapBody translates the PageIDs stored in a copied page's body: the first
+// pages of the overflow chains a data page's records spilled into, and the
+// pages a free-space index page lists along with the tail it records
+func remapBody(remap map[PageID]PageID, from PageID, page *Page) error {
+	switch page.Header.PageType {
+	case PageTypeData:
+		for slot := uint16(0); uint32(slot) < page.Header.RecordCount; slot++ {
+			flags, err := page.recordFlags(slot)
+			if err != nil || flags&slotFlagOverflow == 0 {
+				continue
+			}
+			stub, _ := page.Record(slot)
+			locator, err := DecodeLOBLocator(stub)
+			if err != nil {
+				return &PagerError{
+					Op:  "Compact",
+					Err: fmt.Errorf("record %d of page %d: %w", slot, from, err),
+				}
+			}
+			if locator.FirstPageID, err = remapLink(remap, from, locator.FirstPageID); err != nil {
+				return err
+			}
+			copy(stub, locator.Encode())
+		}
+	case PageTypeMetadata:
+		return remapFreeSpaceIndexPage(page, func(pageID PageID) (PageID, error) {
+			return remapLink(remap, from, pageID)
+		})
+	}
+	return nil
+}
+
+// CompactDatabase compacts every file of the database in dir into the new
+// directory dstDir, as Compact does, and points the table heads recorded in
+// the copy's catalog at their new PageIDs. Like Compact it must be run
+// offline. Tablespaces must have paths relative to dir, which they keep
+// within dstDir. If it fails dstDir is removed
+func CompactDatabase(dir, dstDir string) (err error) {
+	if _, err := os.Stat(filepath.Join(dir, mainFileName)); err != nil {
+		return &PagerError{
+			Op:  "CompactDatabase",
+			Err: fmt.Errorf("no database in `%s`: %w", dir, err),
+		}
+	}
+	if _, err := os.Stat(dstDir); err == nil {
+		return &PagerError{
+			Op:  "CompactDatabase",
+			Err: fmt.Errorf("destination `%s` already exists", dstDir),
+		}
+	}
+
+	db, err := OpenDatabase(dir, PagerConfig{MaxCacheSize: 64})
+	if err != nil {
+		return err
+	}
+	paths := make(map[FileID]string, len(db.tablespaces))
+	for id, ts := range db.tablespaces {
+		paths[id] = ts.Path
+	}
+	if err := db.Close(); err != nil {
+		return err
+	}
+	for id, path := range paths {
+		if filepath.IsAbs(path) {
+			return &PagerError{
+				Op:  "CompactDatabase",
+				Err: fmt.Errorf("tablespace %d has the absolute path `%s`", id, path),
+			}
+		}
+	}
+
+	if err := os.MkdirAll(dstDir, 0755); err != nil {
+		return &PagerError{
+			Op:  "CompactDatabase",
+			Err: fmt.Errorf("unable to create `%s`: %w", dstDir, err),
+		}
+	}
+	defer func() {
+		if err != nil {
+			os.RemoveAll(dstDir)
+		}
+	}()
+	remaps := make(map[FileID]map[PageID]PageID, len(paths))
+	for id, path := range paths {
+		if remaps[id], err = compact(filepath.Join(dir, path), filepath.Join(dstDir, path)); err != nil {
+			return err
+		}
+	}
+	return remapCatalog(filepath.Join(dstDir, mainFileName), remaps)
+}
+
+// remapCatalog points the table records of the catalog in a compacted main
+// file at the new head PageIDs of their heaps. Only the 8-byte head changes,
+// so each record is overwritten in place and keeps its RID
+func remapCatalog(path string, remaps map[FileID]map[PageID]PageID) error {
+	if remaps[DefaultTablespace][catalogHeadPageID] != catalogHeadPageID {
+		return &PagerError{
+			Op:  "CompactDatabase",
+			Err: fmt.Errorf("catalog moved from page %d", catalogHeadPageID),
+		}
+	}
+	pager, err := NewPager(PagerConfig{FilePath: path, MaxCacheSize: 64})
+	if err != nil {
+		return err
+	}
+	catalog, err := OpenHeapFile(pager, catalogHeadPageID)
+	if err != nil {
+		pager.Close()
+		return err
+	}
+
+	heads := make(map[RID]PageID)
+	for record, err := range catalog.Scan() {
+		if err != nil {
+			pager.Close()
+			return err
+		}
+		if len(record.Data) < 13 || record.Data[0] != catalogTable {
+			continue
+		}
+		id := FileID(binary.LittleEndian.Uint16(record.Data[1:]))
+		head := PageID(binary.LittleEndian.Uint64(record.Data[3:]))
+		newHead, ok := remaps[id][head]
+		if !ok {
+			pager.Close()
+			return &PagerError{
+				Op:  "CompactDatabase",
+				Err: fmt.Errorf("catalog record %v points at page %d of file %d, which is not live", record.RID, head, id),
+			}
+		}
+		if newHead != head {
+			heads[record.RID] = newHead
+		}
+	}
+	for rid, head := range heads {
+		if err := patchCatalogHead(pager, rid, head); err != nil {
+			pager.Close()
+			return err
+		}
+	}
+	return pager.Close()
+}
+
+// patchCatalogHead overwrites the head PageID of the table record at rid in
+// place. The record must be stored inline and uncompressed, as catalog
+// records are unless their schema is too large to fit in a page
+func patchCatalogHead(pager *Pager, rid RID, head PageID) error {
+	page, err := pager.ReadPage(rid.PageID)
+	if err != nil {
+		return err
+	}
+	flags, err := page.recordFlags(rid.Slot)
+	if err != nil {
+		return err
+	}
+	if flags&(slotFlagOverflow|slotFlagCompressed) != 0 {
+		return &PagerError{
+			Op:  "CompactDatabase",
+			Err: fmt.Errorf("catalog record %v is not stored inline", rid),
+		}
+	}
+	data, _ := page.Record(rid.Slot)
+	binary.LittleEndian.PutUint64(data[3:], uint64(head))
+	return pager.WritePage(page)
+}
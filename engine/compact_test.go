@@ -0,0 +1,258 @@
+package engine
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestCompactSparseFile(t *testing.T) {
+	dir := t.TempDir()
+	srcPath := filepath.Join(dir, "sparse.db")
+	dstPath := filepath.Join(dir, "compact.db")
+
+	pager, err := NewPager(PagerConfig{FilePath: srcPath, MaxCacheSize: 100})
+	if err != nil {
+		t.Fatalf(`NewPager() got %q wanted nil`, err)
+	}
+
+	var pages []*Page
+	for i := 0; i < 12; i++ {
+		page, err := pager.AllocatePage(PageTypeData)
+		if err != nil {
+			t.Fatalf(`AllocatePage() got %q wanted nil`, err)
+		}
+		page.Body[0] = byte(i)
+		pages = append(pages, page)
+	}
+
+	// Chain the pages we keep: 2 <-> 5 <-> 9
+	pages[2].Header.NextPageID = pages[5].Header.PageID
+	pages[5].Header.PrevPageID = pages[2].Header.PageID
+	pages[5].Header.NextPageID = pages[9].Header.PageID
+	pages[9].Header.PrevPageID = pages[5].Header.PageID
+	for _, page := range pages {
+		page.MarkDirty()
+	}
+	if err := pager.FlushAll(); err != nil {
+		t.Fatalf(`FlushAll() got %q wanted nil`, err)
+	}
+
+	kept := map[int]bool{2: true, 5: true, 9: true, 11: true}
+	for i, page := range pages {
+		if !kept[i] {
+			if err := pager.DeallocatePage(page.Header.PageID); err != nil {
+				t.Fatalf(`DeallocatePage(%d) got %q wanted nil`, page.Header.PageID, err)
+			}
+		}
+	}
+	if err := pager.Close(); err != nil {
+		t.Fatalf(`Close() got %q wanted nil`, err)
+	}
+
+	if err := Compact(srcPath, dstPath); err != nil {
+		t.Fatalf(`Compact() got %q wanted nil`, err)
+	}
+
+	srcInfo, _ := os.Stat(srcPath)
+	dstInfo, _ := os.Stat(dstPath)
+	if dstInfo.Size() >= srcInfo.Size() {
+		t.Errorf(`compacted size = %d; want less than %d`, dstInfo.Size(), srcInfo.Size())
+	}
+	if want := int64(len(kept)+1) * PageSize; dstInfo.Size() != want {
+		t.Errorf(`compacted size = %d; want %d`, dstInfo.Size(), want)
+	}
+
+	compacted, err := NewPager(PagerConfig{FilePath: dstPath, MaxCacheSize: 100, ReadOnly: true})
+	if err != nil {
+		t.Fatalf(`NewPager(compacted) got %q wanted nil`, err)
+	}
+	defer compacted.Close()
+
+	wantBody := []byte{2, 5, 9, 11}
+	for i, want := range wantBody {
+		page, err := compacted.ReadPage(PageID(i + 1))
+		if err != nil {
+			t.Fatalf(`ReadPage(%d) got %q wanted nil`, i+1, err)
+		}
+		if page.Body[0] != want {
+			t.Errorf(`page %d body[0] = %d; want %d`, i+1, page.Body[0], want)
+		}
+	}
+
+	first, _ := compacted.ReadPage(1)
+	second, _ := compacted.ReadPage(2)
+	third, _ := compacted.ReadPage(3)
+	if first.Header.NextPageID != 2 || second.Header.PrevPageID != 1 {
+		t.Errorf(`link 1 <-> 2 = (%d, %d); want (2, 1)`, first.Header.NextPageID, second.Header.PrevPageID)
+	}
+	if second.Header.NextPageID != 3 || third.Header.PrevPageID != 2 {
+		t.Errorf(`link 2 <-> 3 = (%d, %d); want (3, 2)`, second.Header.NextPageID, third.Header.PrevPageID)
+	}
+	if third.Header.NextPageID != 0 {
+		t.Errorf(`page 3 NextPageID = %d; want 0`, third.Header.NextPageID)
+	}
+}
+
+func TestCompactRefusesExistingDestination(t *testing.T) {
+	dir := t.TempDir()
+	srcPath := filepath.Join(dir, "src.db")
+	dstPath := filepath.Join(dir, "dst.db")
+	os.WriteFile(srcPath, nil, 0644)
+	os.WriteFile(dstPath, nil, 0644)
+
+	if err := Compact(srcPath, dstPath); err == nil {
+		t.Errorf(`Compact() onto an existing file got nil wanted error`)
+	}
+}
+
+func TestCompactRemapsBodyReferences(t *testing.T) {
+	dir := t.TempDir()
+	srcPath := filepath.Join(dir, "heap.db")
+	dstPath := filepath.Join(dir, "compact.db")
+
+	pager, err := NewPager(PagerConfig{FilePath: srcPath, MaxCacheSize: 100})
+	if err != nil {
+		t.Fatalf(`NewPager() got %q wanted nil`, err)
+	}
+	// Freed pages ahead of the heap shift all of its pages down
+	var holes []PageID
+	for i := 0; i < 3; i++ {
+		page, err := pager.AllocatePage(PageTypeData)
+		if err != nil {
+			t.Fatalf(`AllocatePage() got %q wanted nil`, err)
+		}
+		holes = append(holes, page.Header.PageID)
+	}
+	heap, err := NewHeapFile(pager)
+	if err != nil {
+		t.Fatalf(`NewHeapFile() got %q wanted nil`, err)
+	}
+	big := bytes.Repeat([]byte("lob "), MaxRecordSize)
+	rid, err := heap.InsertRecordAnywhere(big)
+	if err != nil {
+		t.Fatalf(`InsertRecordAnywhere() got %q wanted nil`, err)
+	}
+	if err := heap.Close(); err != nil {
+		t.Fatalf(`Close() got %q wanted nil`, err)
+	}
+	headID, indexID := heap.HeadPageID(), heap.IndexPageID()
+	for _, pageID := range holes {
+		if err := pager.DeallocatePage(pageID); err != nil {
+			t.Fatalf(`DeallocatePage() got %q wanted nil`, err)
+		}
+	}
+	if err := pager.Close(); err != nil {
+		t.Fatalf(`Close() got %q wanted nil`, err)
+	}
+
+	remap, err := compact(srcPath, dstPath)
+	if err != nil {
+		t.Fatalf(`compact() got %q wanted nil`, err)
+	}
+	if remap[headID] == headID {
+		t.Fatalf(`compact() left the heap head at page %d`, headID)
+	}
+	compacted, err := NewPager(PagerConfig{FilePath: dstPath, MaxCacheSize: 100})
+	if err != nil {
+		t.Fatalf(`NewPager(compacted) got %q wanted nil`, err)
+	}
+	defer compacted.Close()
+	heap, err = OpenHeapFileWithIndex(compacted, remap[headID], remap[indexID])
+	if err != nil {
+		t.Fatalf(`OpenHeapFileWithIndex() got %q wanted nil`, err)
+	}
+	got, err := heap.Get(RID{PageID: remap[rid.PageID], Slot: rid.Slot})
+	if err != nil {
+		t.Fatalf(`Get() of the spilled record got %q wanted nil`, err)
+	}
+	if !bytes.Equal(got, big) {
+		t.Errorf(`spilled record did not survive compaction`)
+	}
+	if _, err := heap.Insert([]byte("after")); err != nil {
+		t.Errorf(`Insert() into the compacted heap got %q wanted nil`, err)
+	}
+}
+
+func TestCompactDatabase(t *testing.T) {
+	dir := t.TempDir()
+	dstDir := filepath.Join(t.TempDir(), "compacted")
+	db := openTestDatabase(t, dir)
+
+	// A table dropped ahead of the others leaves holes in the main file
+	scratch, err := db.CreateTable("scratch", nil)
+	if err != nil {
+		t.Fatalf(`CreateTable() got %q wanted nil`, err)
+	}
+	for i := 0; i < 3; i++ {
+		if _, err := scratch.Insert(bytes.Repeat([]byte{byte(i)}, MaxRecordSize)); err != nil {
+			t.Fatalf(`Insert() got %q wanted nil`, err)
+		}
+	}
+	users, err := db.CreateTable("users", []byte("schema"))
+	if err != nil {
+		t.Fatalf(`CreateTable() got %q wanted nil`, err)
+	}
+	second, err := db.CreateTablespace("second")
+	if err != nil {
+		t.Fatalf(`CreateTablespace() got %q wanted nil`, err)
+	}
+	orders, err := db.CreateTable("orders", nil, InTablespace(second))
+	if err != nil {
+		t.Fatalf(`CreateTable() got %q wanted nil`, err)
+	}
+	want := map[string][]byte{
+		"users":  bytes.Repeat([]byte("lob "), MaxRecordSize),
+		"orders": []byte("order"),
+	}
+	for name, table := range map[string]*Table{"users": users, "orders": orders} {
+		if _, err := table.Insert(want[name]); err != nil {
+			t.Fatalf(`Insert() got %q wanted nil`, err)
+		}
+	}
+	usersRID := users.catalogRID
+	// Dropping only after the inserts keeps them from reusing its pages
+	if err := db.DropTable("scratch"); err != nil {
+		t.Fatalf(`DropTable() got %q wanted nil`, err)
+	}
+	if err := db.Close(); err != nil {
+		t.Fatalf(`Close() got %q wanted nil`, err)
+	}
+
+	if err := CompactDatabase(dir, dstDir); err != nil {
+		t.Fatalf(`CompactDatabase() got %q wanted nil`, err)
+	}
+	srcInfo, _ := os.Stat(filepath.Join(dir, mainFileName))
+	dstInfo, _ := os.Stat(filepath.Join(dstDir, mainFileName))
+	if dstInfo.Size() >= srcInfo.Size() {
+		t.Errorf(`compacted main file = %d bytes; want less than %d`, dstInfo.Size(), srcInfo.Size())
+	}
+
+	compacted := openTestDatabase(t, dstDir)
+	defer compacted.Close()
+	for name, data := range want {
+		table, err := compacted.Table(name)
+		if err != nil {
+			t.Fatalf(`Table(%q) got %q wanted nil`, name, err)
+		}
+		// Patching the head in place leaves the catalog record where it was
+		if name == "users" && table.catalogRID != usersRID {
+			t.Errorf(`users catalog record moved from %v to %v`, usersRID, table.catalogRID)
+		}
+		var records [][]byte
+		for record, err := range table.Scan() {
+			if err != nil {
+				t.Fatalf(`Scan() of %s got %q wanted nil`, name, err)
+			}
+			records = append(records, record.Data)
+		}
+		if len(records) != 1 || !bytes.Equal(records[0], data) {
+			t.Errorf(`table %s after compaction holds %d records; want its one record intact`, name, len(records))
+		}
+	}
+
+	if err := CompactDatabase(dir, dstDir); err == nil {
+		t.Errorf(`CompactDatabase() onto an existing directory got nil wanted error`)
+	}
+}
@@ -0,0 +1,145 @@
+package engine
+
+import (
+	"bytes"
+	"compress/flate"
+	"compress/lzw"
+	"encoding/binary"
+	"fmt"
+	"io"
+)
+
+// Compression selects the codec used to store a page body on disk
+type Compression uint8
+
+const (
+	CompressionNone Compression = iota
+	CompressionFlate
+	CompressionLZW
+)
+
+// The codec a page was stored with lives in the low bits of Header.Flags.
+// A compressed body is stored as a uint16 length followed by the compressed
+// bytes; bodies that do not shrink are stored uncompressed
+const (
+	flagCompressionMask    = 0x03
+	compressedLengthPrefix = 2
+)
+
+func (c Compression) String() string {
+	switch c {
+	case CompressionNone:
+		return "none"
+	case CompressionFlate:
+		return "flate"
+	case CompressionLZW:
+		return "lzw"
+	default:
+		return fmt.Sprintf("unknown(%d)", uint8(c))
+	}
+}
+
+// compressBody returns the stored form of body under codec, along with the
+// codec actually used, which is CompressionNone when compressing doesn't help
+func compressBody(body []byte, codec Compression) ([]byte, Compression, error) {
+	if codec == CompressionNone {
+		return body, CompressionNone, nil
+	}
+
+	compressed, err := compressBytes(body, codec)
+	if err != nil {
+		return nil, CompressionNone, err
+	}
+	if len(compressed)+compressedLengthPrefix >= len(body) {
+		return body, CompressionNone, nil
+	}
+	stored := make([]byte, len(body))
+	binary.LittleEndian.PutUint16(stored[0:compressedLengthPrefix], uint16(len(compressed)))
+	copy(stored[compressedLengthPrefix:], compressed)
+	return stored, codec, nil
+}
+
+// recordPageCompression counts a page image just written in the compression
+// metrics, if the page's type is compressed. The caller must hold p.mutex
+func (p *Pager) recordPageCompression(page *Page, image []byte) {
+	if p.compression[page.Header.PageType] == CompressionNone {
+		return
+	}
+	stored := MaxBodySize
+	if Compression(page.Header.Flags&flagCompressionMask) != CompressionNone {
+		stored = compressedLengthPrefix + int(binary.LittleEndian.Uint16(image[HeaderSize:]))
+	}
+	recordCompression(p.metrics, MetricPageUncompressedBytes, MetricPageCompressedBytes,
+		MetricPageCompressionSkipped, MaxBodySize, stored)
+}
+
+// decompressBody reverses compressBody, returning a body of bodySize bytes
+func decompressBody(stored []byte, codec Compression, bodySize int) ([]byte, error) {
+	if codec == CompressionNone {
+		return stored, nil
+	}
+
+	length := int(binary.LittleEndian.Uint16(stored[0:compressedLengthPrefix]))
+	if compressedLengthPrefix+length > len(stored) {
+		return nil, fmt.Errorf("compressed length %d exceeds page body", length)
+	}
+	body, err := decompressBytes(stored[compressedLengthPrefix:compressedLengthPrefix+length], codec, bodySize)
+	if err != nil {
+		return nil, fmt.Errorf("unable to decompress %s body: %w", codec, err)
+	}
+	return body, nil
+}
+
+// compressBytes returns data compressed with codec
+func compressBytes(data []byte, codec Compression) ([]byte, error) {
+	var compressed bytes.Buffer
+	var writer io.WriteCloser
+	switch codec {
+	case CompressionFlate:
+		flateWriter, err := flate.NewWriter(&compressed, flate.BestSpeed)
+		if err != nil {
+			return nil, err
+		}
+		writer = flateWriter
+	case CompressionLZW:
+		writer = lzw.NewWriter(&compressed, lzw.LSB, 8)
+	default:
+		return nil, fmt.Errorf("unknown compression codec %d", codec)
+	}
+	if _, err := writer.Write(data); err != nil {
+		return nil, err
+	}
+	if err := writer.Close(); err != nil {
+		return nil, err
+	}
+	return compressed.Bytes(), nil
+}
+
+// decompressBytes reverses compressBytes, returning exactly size bytes. A
+// stream that ends early or runs on past size is rejected
+func decompressBytes(compressed []byte, codec Compression, size int) ([]byte, error) {
+	var reader io.ReadCloser
+	switch codec {
+	case CompressionFlate:
+		reader = flate.NewReader(bytes.NewReader(compressed))
+	case CompressionLZW:
+		reader = lzw.NewReader(bytes.NewReader(compressed), lzw.LSB, 8)
+	default:
+		return nil, fmt.Errorf("unknown compression codec %d", codec)
+	}
+	defer reader.Close()
+
+	data := make([]byte, size)
+	if _, err := io.ReadFull(reader, data); err != nil {
+		return nil, err
+	}
+	var extra [1]byte
+	switch _, err := io.ReadFull(reader, extra[:]); err {
+	case io.EOF:
+		return data, nil
+	case nil:
+		return nil, fmt.Errorf("compressed stream is longer than %d bytes", size)
+	default:
+		return nil, err
+	}
+}
@@ -0,0 +1,191 @@
+package engine
+
+import (
+	"bytes"
+	"path/filepath"
+	"testing"
+)
+
+func TestPerPageTypeCompression(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "compressed.db")
+	config := PagerConfig{
+		FilePath:     path,
+		MaxCacheSize: 10,
+		Compression: map[PageType]Compression{
+			PageTypeData:     CompressionFlate,
+			PageTypeIndex:    CompressionLZW,
+			PageTypeOverflow: CompressionNone,
+		},
+	}
+	pager, err := NewPager(config)
+	if err != nil {
+		t.Fatalf(`NewPager() got %q wanted nil`, err)
+	}
+
+	want := map[PageType]Compression{
+		PageTypeData:     CompressionFlate,
+		PageTypeIndex:    CompressionLZW,
+		PageTypeOverflow: CompressionNone,
+	}
+	pageIDs := make(map[PageType]PageID)
+	body := bytes.Repeat([]byte("gopherdb "), MaxBodySize/9+1)[:MaxBodySize]
+	for pageType := range want {
+		page, err := pager.AllocatePage(pageType)
+		if err != nil {
+			t.Fatalf(`AllocatePage() got %q wanted nil`, err)
+		}
+		copy(page.Body, body)
+		if err := pager.WritePage(page); err != nil {
+			t.Fatalf(`WritePage() got %q wanted nil`, err)
+		}
+		pageIDs[pageType] = page.Header.PageID
+	}
+	if err := pager.Close(); err != nil {
+		t.Fatalf(`Close() got %q wanted nil`, err)
+	}
+
+	// Decoding relies only on the flags, not on the configuration
+	reopened, err := NewPager(PagerConfig{FilePath: path, MaxCacheSize: 10})
+	if err != nil {
+		t.Fatalf(`NewPager() got %q wanted nil`, err)
+	}
+	defer reopened.Close()
+	for pageType, codec := range want {
+		page, err := reopened.ReadPage(pageIDs[pageType])
+		if err != nil {
+			t.Fatalf(`ReadPage() got %q wanted nil`, err)
+		}
+		if got := Compression(page.Header.Flags & flagCompressionMask); got != codec {
+			t.Errorf(`page type %d stored with %s; want %s`, pageType, got, codec)
+		}
+		if !bytes.Equal(page.Body, body) {
+			t.Errorf(`page type %d body did not round-trip`, pageType)
+		}
+	}
+}
+
+func TestCompressionSkippedWhenItDoesNotHelp(t *testing.T) {
+	pager, err := NewMemoryPager(PagerConfig{
+		MaxCacheSize: 10,
+		Compression:  map[PageType]Compression{PageTypeData: CompressionFlate},
+	})
+	if err != nil {
+		t.Fatalf(`NewMemoryPager() got %q wanted nil`, err)
+	}
+	defer pager.Close()
+
+	page, err := pager.AllocatePage(PageTypeData)
+	if err != nil {
+		t.Fatalf(`AllocatePage() got %q wanted nil`, err)
+	}
+	// An xorshift sequence does not compress
+	state := uint32(2463534242)
+	for i := range page.Body {
+		state ^= state << 13
+		state ^= state >> 17
+		state ^= state << 5
+		page.Body[i] = byte(state)
+	}
+	body := append([]byte(nil), page.Body...)
+	if err := pager.WritePage(page); err != nil {
+		t.Fatalf(`WritePage() got %q wanted nil`, err)
+	}
+
+	stored, err := pager.readPageFromDisk(page.Header.PageID)
+	if err != nil {
+		t.Fatalf(`readPageFromDisk() got %q wanted nil`, err)
+	}
+	if got := Compression(stored.Header.Flags & flagCompressionMask); got != CompressionNone {
+		t.Errorf(`incompressible page stored with %s; want none`, got)
+	}
+	if !bytes.Equal(stored.Body, body) {
+		t.Errorf(`incompressible body did not round-trip`)
+	}
+}
+
+func TestCompressionMetrics(t *testing.T) {
+	metrics := NewMemoryMetrics()
+	pager, err := NewMemoryPager(PagerConfig{
+		MaxCacheSize: 10,
+		Compression:  map[PageType]Compression{PageTypeData: CompressionFlate},
+		Metrics:      metrics,
+	})
+	if err != nil {
+		t.Fatalf(`NewMemoryPager() got %q wanted nil`, err)
+	}
+	defer pager.Close()
+
+	var pages []*Page
+	for i := 0; i < 4; i++ {
+		page, err := pager.AllocatePage(PageTypeData)
+		if err != nil {
+			t.Fatalf(`AllocatePage() got %q wanted nil`, err)
+		}
+		pages = append(pages, page)
+	}
+	// Metadata pages are stored uncompressed and left out of the counts
+	if _, err := pager.AllocatePage(PageTypeMetadata); err != nil {
+		t.Fatalf(`AllocatePage() got %q wanted nil`, err)
+	}
+	allocated := metrics.PageCompression()
+	if allocated.UncompressedBytes != 4*MaxBodySize || allocated.Skipped != 0 {
+		t.Errorf(`after allocating, page compression = %+v; want 4 compressed empty bodies`, allocated)
+	}
+
+	// Two pages of text compress and two of noise are stored as they are
+	state := uint32(2463534242)
+	for i, page := range pages {
+		for j := range page.Body {
+			if i%2 == 0 {
+				page.Body[j] = "compressible "[j%13]
+				continue
+			}
+			state ^= state << 13
+			state ^= state >> 17
+			state ^= state << 5
+			page.Body[j] = byte(state)
+		}
+		page.MarkDirty()
+	}
+	if err := pager.WritePages(pages); err != nil {
+		t.Fatalf(`WritePages() got %q wanted nil`, err)
+	}
+	stats := metrics.PageCompression()
+	written := CompressionStats{
+		UncompressedBytes: stats.UncompressedBytes - allocated.UncompressedBytes,
+		CompressedBytes:   stats.CompressedBytes - allocated.CompressedBytes,
+		Skipped:           stats.Skipped - allocated.Skipped,
+	}
+	if written.UncompressedBytes != 4*MaxBodySize {
+		t.Errorf(`uncompressed page bytes = %v; want %d`, written.UncompressedBytes, 4*MaxBodySize)
+	}
+	if written.Skipped != 2 {
+		t.Errorf(`skipped pages = %v; want 2`, written.Skipped)
+	}
+	// The noise pages count in full, so the ratio sits just above a half
+	if ratio := written.Ratio(); ratio <= 0.5 || ratio >= 0.6 {
+		t.Errorf(`page compression ratio = %.3f; want between 0.5 and 0.6`, ratio)
+	}
+
+	heap, err := NewHeapFile(pager)
+	if err != nil {
+		t.Fatalf(`NewHeapFile() got %q wanted nil`, err)
+	}
+	heap.SetRecordCompression(CompressionFlate, 16)
+	for _, record := range [][]byte{
+		bytes.Repeat([]byte("abcd"), 100),
+		pages[1].Body[:400],
+		[]byte("short"),
+	} {
+		if _, err := heap.Insert(record); err != nil {
+			t.Fatalf(`Insert() got %q wanted nil`, err)
+		}
+	}
+	records := metrics.RecordCompression()
+	if records.UncompressedBytes != 800 || records.Skipped != 1 {
+		t.Errorf(`record compression = %+v; want 800 bytes tried and 1 skipped`, records)
+	}
+	if ratio := records.Ratio(); ratio <= 0.5 || ratio >= 0.6 {
+		t.Errorf(`record compression ratio = %.3f; want between 0.5 and 0.6`, ratio)
+	}
+}
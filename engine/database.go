@@ -0,0 +1,586 @@
+package engine
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"iter"
+	"os"
+	"sync"
+)
+
+var (
+	ErrTableNotFound = errors.New("table not found")
+	ErrTableExists   = errors.New("table already exists")
+)
+
+// The catalog is a heap file in the default tablespace whose head is always
+// page 1. Each record starts with a kind byte. A tablespace record holds the
+// uint16 FileID followed by the file's path, and is written as a dedicated
+// tablespace record for a file holding a single table. A table record holds
+// the uint16 FileID of its tablespace, the uint64 head PageID of its heap
+// within that file, a uint16 name length, the name and then the schema. A
+// single next FileID record holds the uint16 FileID the next tablespace gets,
+// so a dropped tablespace's FileID is never handed out again
+const (
+	mainFileName      = "main.db"
+	tablespaceFileExt = ".tbs"
+	catalogHeadPageID = PageID(1)
+
+	catalogTablespace          byte = 1
+	catalogTable               byte = 2
+	catalogDedicatedTablespace byte = 3
+	catalogNextFileID          byte = 4
+)
+
+// Database is a set of files, each a Tablespace with its own pager, tied
+// together by a catalog of the tablespaces and the tables stored in them
+type Database struct {
+	dir    string
+	config PagerConfig
+	mutex  sync.Mutex
+
+	tablespaces map[FileID]*Tablespace
+	tables      map[string]*Table
+	catalog     *HeapFile
+	// nextFileID is the FileID the next tablespace gets, and nextFileIDRID
+	// its record in the catalog, if it has one yet
+	nextFileID    FileID
+	nextFileIDRID RID
+}
+
+// Table is a named heap file in one tablespace of a database. The RIDs it
+// hands out carry global PageIDs, so they identify a record across the whole
+// database
+type Table struct {
+	Name       string
+	Schema     []byte
+	Tablespace FileID
+	heap       *HeapFile
+	// catalogRID is the table's record in the catalog
+	catalogRID RID
+}
+
+// TableOption configures CreateTable
+type TableOption func(*tableOptions)
+
+type tableOptions struct {
+	tablespace FileID
+	file       string
+}
+
+// InTablespace places a new table in an existing tablespace rather than the
+// default one
+func InTablespace(id FileID) TableOption {
+	return func(options *tableOptions) {
+		options.tablespace = id
+	}
+}
+
+// WithFile stores a new table in a file of its own at path, relative to the
+// database directory unless it is absolute. The file must not already exist,
+// and is deleted when the table is dropped
+func WithFile(path string) TableOption {
+	return func(options *tableOptions) {
+		options.file = path
+	}
+}
+
+// OpenDatabase opens the database in dir, creating the directory and an empty
+// catalog if it does not exist yet. config is used for every file's pager;
+// its FilePath is ignored
+func OpenDatabase(dir string, config PagerConfig) (*Database, error) {
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return nil, &PagerError{
+			Op:  "OpenDatabase",
+			Err: fmt.Errorf("unable to create directory `%s`: %w", dir, err),
+		}
+	}
+	main, err := openTablespace(dir, DefaultTablespace, mainFileName, config)
+	if err != nil {
+		return nil, err
+	}
+	db := &Database{
+		dir:         dir,
+		config:      config,
+		tablespaces: map[FileID]*Tablespace{DefaultTablespace: main},
+		tables:      make(map[string]*Table),
+	}
+	if err := db.loadCatalog(); err != nil {
+		db.Close()
+		return nil, err
+	}
+	return db, nil
+}
+
+// loadCatalog opens the catalog heap, creating it in a new file, and opens
+// every tablespace and table it lists
+func (db *Database) loadCatalog() error {
+	pager := db.tablespaces[DefaultTablespace].pager
+	stat, err := pager.Stat()
+	if err != nil {
+		return err
+	}
+	if stat.PageCount <= 1 {
+		catalog, err := NewHeapFile(pager)
+		if err != nil {
+			return err
+		}
+		if catalog.HeadPageID() != catalogHeadPageID {
+			return &PagerError{
+				Op:  "OpenDatabase",
+				Err: fmt.Errorf("catalog was allocated page %d, expected %d", catalog.HeadPageID(), catalogHeadPageID),
+			}
+		}
+		db.catalog = catalog
+		db.nextFileID = DefaultTablespace + 1
+		return nil
+	}
+
+	if db.catalog, err = OpenHeapFile(pager, catalogHeadPageID); err != nil {
+		return err
+	}
+	var tables []HeapRecord
+	for record, err := range db.catalog.Scan() {
+		if err != nil {
+			return err
+		}
+		if len(record.Data) == 0 {
+			return db.catalogError(record.RID, "empty record")
+		}
+		switch record.Data[0] {
+		case catalogTablespace, catalogDedicatedTablespace:
+			if err := db.loadTablespace(record); err != nil {
+				return err
+			}
+		case catalogTable:
+			tables = append(tables, record)
+		case catalogNextFileID:
+			if len(record.Data) < 3 {
+				return db.catalogError(record.RID, "truncated next FileID record")
+			}
+			db.nextFileID = max(db.nextFileID, FileID(binary.LittleEndian.Uint16(record.Data[1:])))
+			db.nextFileIDRID = record.RID
+		default:
+			return db.catalogError(record.RID, fmt.Sprintf("unknown record kind %d", record.Data[0]))
+		}
+	}
+	// A catalog written before it kept a next FileID record only has the
+	// FileIDs of its tablespaces to go on
+	for id := range db.tablespaces {
+		db.nextFileID = max(db.nextFileID, id+1)
+	}
+	// Tables are opened once every tablespace is, wherever their records sit
+	for _, record := range tables {
+		if err := db.loadTable(record); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (db *Database) loadTablespace(record HeapRecord) error {
+	if len(record.Data) < 3 {
+		return db.catalogError(record.RID, "truncated tablespace record")
+	}
+	id := FileID(binary.LittleEndian.Uint16(record.Data[1:]))
+	if _, ok := db.tablespaces[id]; ok {
+		return db.catalogError(record.RID, fmt.Sprintf("tablespace %d listed twice", id))
+	}
+	ts, err := openTablespace(db.dir, id, string(record.Data[3:]), db.config)
+	if err != nil {
+		return err
+	}
+	ts.Dedicated = record.Data[0] == catalogDedicatedTablespace
+	ts.catalogRID = record.RID
+	db.tablespaces[id] = ts
+	return nil
+}
+
+func (db *Database) loadTable(record HeapRecord) error {
+	data := record.Data
+	if len(data) < 13 || len(data) < 13+int(binary.LittleEndian.Uint16(data[11:])) {
+		return db.catalogError(record.RID, "truncated table record")
+	}
+	id := FileID(binary.LittleEndian.Uint16(data[1:]))
+	head := PageID(binary.LittleEndian.Uint64(data[3:]))
+	nameEnd := 13 + int(binary.LittleEndian.Uint16(data[11:]))
+	name := string(data[13:nameEnd])
+
+	ts, ok := db.tablespaces[id]
+	if !ok {
+		return db.catalogError(record.RID, fmt.Sprintf("table `%s` is in unknown tablespace %d", name, id))
+	}
+	heap, err := OpenHeapFile(ts.pager, head)
+	if err != nil {
+		return err
+	}
+	db.tables[name] = &Table{
+		Name:       name,
+		Schema:     data[nameEnd:],
+		Tablespace: id,
+		heap:       heap,
+		catalogRID: record.RID,
+	}
+	return nil
+}
+
+func (db *Database) catalogError(rid RID, problem string) error {
+	return &PagerError{
+		Op:  "OpenDatabase",
+		Err: fmt.Errorf("catalog record %v: %s", rid, problem),
+	}
+}
+
+// Tablespace returns the tablespace with the given FileID
+func (db *Database) Tablespace(id FileID) (*Tablespace, bool) {
+	db.mutex.Lock()
+	defer db.mutex.Unlock()
+	ts, ok := db.tablespaces[id]
+	return ts, ok
+}
+
+// CreateTablespace adds a new file to the database, named after name in the
+// database directory, and returns its FileID
+func (db *Database) CreateTablespace(name string) (FileID, error) {
+	db.mutex.Lock()
+	defer db.mutex.Unlock()
+	ts, err := db.createTablespace(name+tablespaceFileExt, false)
+	if err != nil {
+		return 0, err
+	}
+	return ts.ID, nil
+}
+
+// createTablespace opens a new tablespace at path and records it in the
+// catalog. The caller must hold db.mutex
+func (db *Database) createTablespace(path string, dedicated bool) (*Tablespace, error) {
+	for existing, ts := range db.tablespaces {
+		if ts.Path == path {
+			return nil, &PagerError{
+				Op:  "CreateTablespace",
+				Err: fmt.Errorf("`%s` is already tablespace %d", path, existing),
+			}
+		}
+	}
+	if _, err := os.Stat(resolvePath(db.dir, path)); err == nil {
+		return nil, &PagerError{
+			Op:  "CreateTablespace",
+			Err: fmt.Errorf("file `%s` already exists", path),
+		}
+	}
+	id := db.nextFileID
+	if id == ^FileID(0) {
+		return nil, &PagerError{
+			Op:  "CreateTablespace",
+			Err: fmt.Errorf("every FileID has been used"),
+		}
+	}
+	// The FileID is taken before the file exists, so a failure below can
+	// only waste it, never hand it out twice
+	if err := db.saveNextFileID(id + 1); err != nil {
+		return nil, err
+	}
+
+	ts, err := openTablespace(db.dir, id, path, db.config)
+	if err != nil {
+		return nil, err
+	}
+	record := make([]byte, 3, 3+len(path))
+	record[0] = catalogTablespace
+	if dedicated {
+		record[0] = catalogDedicatedTablespace
+	}
+	binary.LittleEndian.PutUint16(record[1:], uint16(id))
+	rid, err := db.catalog.InsertRecordAnywhere(append(record, path...))
+	if err != nil {
+		ts.pager.Close()
+		os.Remove(resolvePath(db.dir, path))
+		return nil, err
+	}
+	ts.Dedicated = dedicated
+	ts.catalogRID = rid
+	db.tablespaces[id] = ts
+	return ts, nil
+}
+
+// saveNextFileID records next as the FileID the next tablespace gets. The new
+// record goes in before the old one is deleted, and loadCatalog keeps the
+// highest of any it finds, so a failure cannot lose the count. The caller must
+// hold db.mutex
+func (db *Database) saveNextFileID(next FileID) error {
+	record := make([]byte, 3)
+	record[0] = catalogNextFileID
+	binary.LittleEndian.PutUint16(record[1:], uint16(next))
+	rid, err := db.catalog.InsertRecordAnywhere(record)
+	if err != nil {
+		return err
+	}
+	old := db.nextFileIDRID
+	db.nextFileID = next
+	db.nextFileIDRID = rid
+	if old != (RID{}) {
+		return db.catalog.Delete(old)
+	}
+	return nil
+}
+
+// removeTablespace deletes a tablespace from the catalog, closes its pager and
+// deletes its file, which goes even if closing the pager fails. The caller
+// must hold db.mutex
+func (db *Database) removeTablespace(op string, ts *Tablespace) error {
+	if err := db.catalog.Delete(ts.catalogRID); err != nil {
+		return err
+	}
+	delete(db.tablespaces, ts.ID)
+	closeErr := ts.pager.Close()
+	if err := os.Remove(resolvePath(db.dir, ts.Path)); err != nil {
+		return &PagerError{
+			Op:  op,
+			Err: fmt.Errorf("unable to delete file `%s`: %w", ts.Path, err),
+		}
+	}
+	return closeErr
+}
+
+// CreateTable creates an empty table in the default tablespace, the one
+// chosen with InTablespace or a file of its own given by WithFile, and records
+// it in the catalog. The schema is stored with the table as it is given
+func (db *Database) CreateTable(name string, schema []byte, opts ...TableOption) (*Table, error) {
+	var options tableOptions
+	for _, opt := range opts {
+		opt(&options)
+	}
+
+	db.mutex.Lock()
+	defer db.mutex.Unlock()
+
+	if _, ok := db.tables[name]; ok {
+		return nil, &PagerError{
+			Op:  "CreateTable",
+			Err: fmt.Errorf("`%s`: %w", name, ErrTableExists),
+		}
+	}
+	if len(name) > int(^uint16(0)) {
+		return nil, &PagerError{
+			Op:  "CreateTable",
+			Err: fmt.Errorf("table name of %d bytes is too long", len(name)),
+		}
+	}
+	var ts *Tablespace
+	if options.file != "" {
+		var err error
+		if ts, err = db.createTablespace(options.file, true); err != nil {
+			return nil, err
+		}
+	} else {
+		var ok bool
+		if ts, ok = db.tablespaces[options.tablespace]; !ok {
+			return nil, &PagerError{
+				Op:  "CreateTable",
+				Err: fmt.Errorf("tablespace %d does not exist", options.tablespace),
+			}
+		}
+		if ts.Dedicated {
+			return nil, &PagerError{
+				Op:  "CreateTable",
+				Err: fmt.Errorf("tablespace %d is dedicated to another table", ts.ID),
+			}
+		}
+	}
+
+	heap, err := NewHeapFile(ts.pager)
+	if err != nil {
+		return nil, db.abandonTablespace(ts, err)
+	}
+	record := make([]byte, 13, 13+len(name)+len(schema))
+	record[0] = catalogTable
+	binary.LittleEndian.PutUint16(record[1:], uint16(ts.ID))
+	binary.LittleEndian.PutUint64(record[3:], uint64(heap.HeadPageID()))
+	binary.LittleEndian.PutUint16(record[11:], uint16(len(name)))
+	record = append(append(record, name...), schema...)
+	rid, err := db.catalog.InsertRecordAnywhere(record)
+	if err != nil {
+		return nil, db.abandonTablespace(ts, err)
+	}
+
+	table := &Table{
+		Name:       name,
+		Schema:     append([]byte(nil), schema...),
+		Tablespace: ts.ID,
+		heap:       heap,
+		catalogRID: rid,
+	}
+	db.tables[name] = table
+	return table, nil
+}
+
+// abandonTablespace undoes the tablespace CreateTable made for a table it then
+// failed to create, if it made one, and returns err. The caller must hold
+// db.mutex
+func (db *Database) abandonTablespace(ts *Tablespace, err error) error {
+	if !ts.Dedicated {
+		return err
+	}
+	if removeErr := db.removeTablespace("CreateTable", ts); removeErr != nil {
+		return errors.Join(err, removeErr)
+	}
+	return err
+}
+
+// Table returns the table with the given name
+func (db *Database) Table(name string) (*Table, error) {
+	db.mutex.Lock()
+	defer db.mutex.Unlock()
+	table, ok := db.tables[name]
+	if !ok {
+		return nil, &PagerError{
+			Op:  "Table",
+			Err: fmt.Errorf("`%s`: %w", name, ErrTableNotFound),
+		}
+	}
+	return table, nil
+}
+
+// DropTable removes a table from the catalog. A table stored in a file of its
+// own has that file deleted; otherwise its pages are freed in its tablespace
+func (db *Database) DropTable(name string) error {
+	db.mutex.Lock()
+	defer db.mutex.Unlock()
+
+	table, ok := db.tables[name]
+	if !ok {
+		return &PagerError{
+			Op:  "DropTable",
+			Err: fmt.Errorf("`%s`: %w", name, ErrTableNotFound),
+		}
+	}
+	ts := db.tablespaces[table.Tablespace]
+
+	if err := db.catalog.Delete(table.catalogRID); err != nil {
+		return err
+	}
+	delete(db.tables, name)
+	if !ts.Dedicated {
+		return table.heap.Drop()
+	}
+
+	return db.removeTablespace("DropTable", ts)
+}
+
+// WalkFrom calls fn on each page of the chain starting at the global PageID
+// startID, following NextPageID links across the database's files, and passes
+// the global PageID of each page along with it. It stops at the first error
+func (db *Database) WalkFrom(startID PageID, fn func(PageID, *Page) error) error {
+	visited := make(map[PageID]bool)
+	for pageID := startID; pageID != 0; {
+		if visited[pageID] {
+			return &PagerError{
+				Op:  "WalkFrom",
+				Err: fmt.Errorf("cycle in page chain at page %d", pageID),
+			}
+		}
+		visited[pageID] = true
+
+		file, local := SplitPageID(pageID)
+		ts, ok := db.Tablespace(file)
+		if !ok {
+			return &PagerError{
+				Op:  "WalkFrom",
+				Err: fmt.Errorf("page %d is in unknown file %d", pageID, file),
+			}
+		}
+		page, err := ts.pager.linkedPage("WalkFrom", local)
+		if err != nil {
+			return err
+		}
+		next := translateLink(file, page.Header.NextPageID)
+		if err := fn(pageID, page); err != nil {
+			return err
+		}
+		pageID = next
+	}
+	return nil
+}
+
+// Recover runs recovery on every file of the database from a log shared by
+// all of them, whose write entries carry global PageIDs
+func (db *Database) Recover(wal *WriteAheadLog) error {
+	db.mutex.Lock()
+	defer db.mutex.Unlock()
+	for _, ts := range db.tablespaces {
+		if err := ts.recover(wal); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Close flushes and closes every file of the database, returning the first
+// error met
+func (db *Database) Close() error {
+	db.mutex.Lock()
+	defer db.mutex.Unlock()
+	var firstErr error
+	for _, ts := range db.tablespaces {
+		if err := ts.pager.Close(); err != nil && firstErr == nil {
+			firstErr = err
+		}
+	}
+	return firstErr
+}
+
+// Insert stores a record of any size in the table, returning its global RID
+func (t *Table) Insert(data []byte) (RID, error) {
+	rid, err := t.heap.InsertRecordAnywhere(data)
+	if err != nil {
+		return RID{}, err
+	}
+	return t.globalRID(rid), nil
+}
+
+// Get returns a copy of the record identified by the global RID rid
+func (t *Table) Get(rid RID) ([]byte, error) {
+	local, err := t.localRID("TableGet", rid)
+	if err != nil {
+		return nil, err
+	}
+	return t.heap.Get(local)
+}
+
+// Delete removes the record identified by the global RID rid
+func (t *Table) Delete(rid RID) error {
+	local, err := t.localRID("TableDelete", rid)
+	if err != nil {
+		return err
+	}
+	return t.heap.Delete(local)
+}
+
+// Scan returns an iterator over every live record in the table, with global
+// RIDs
+func (t *Table) Scan() iter.Seq2[HeapRecord, error] {
+	return func(yield func(HeapRecord, error) bool) {
+		for record, err := range t.heap.Scan() {
+			record.RID = t.globalRID(record.RID)
+			if !yield(record, err) {
+				return
+			}
+		}
+	}
+}
+
+func (t *Table) globalRID(rid RID) RID {
+	return RID{PageID: GlobalPageID(t.Tablespace, rid.PageID), Slot: rid.Slot}
+}
+
+func (t *Table) localRID(op string, rid RID) (RID, error) {
+	file, pageID := SplitPageID(rid.PageID)
+	if file != t.Tablespace {
+		return RID{}, &PagerError{
+			Op:  op,
+			Err: fmt.Errorf("record %v is in tablespace %d, not %d of table `%s`", rid, file, t.Tablespace, t.Name),
+		}
+	}
+	return RID{PageID: pageID, Slot: rid.Slot}, nil
+}
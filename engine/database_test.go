@@ -0,0 +1,333 @@
+package engine
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func openTestDatabase(t *testing.T, dir string) *Database {
+	t.Helper()
+	db, err := OpenDatabase(dir, PagerConfig{MaxCacheSize: 100})
+	if err != nil {
+		t.Fatalf(`OpenDatabase() got %q wanted nil`, err)
+	}
+	return db
+}
+
+func TestDatabaseTablesInTwoFiles(t *testing.T) {
+	dir := t.TempDir()
+	db := openTestDatabase(t, dir)
+
+	second, err := db.CreateTablespace("second")
+	if err != nil {
+		t.Fatalf(`CreateTablespace() got %q wanted nil`, err)
+	}
+	if second == DefaultTablespace {
+		t.Fatalf(`CreateTablespace() returned the default tablespace`)
+	}
+	users, err := db.CreateTable("users", []byte("id int, name text"))
+	if err != nil {
+		t.Fatalf(`CreateTable(users) got %q wanted nil`, err)
+	}
+	orders, err := db.CreateTable("orders", []byte("id int, total int"), InTablespace(second))
+	if err != nil {
+		t.Fatalf(`CreateTable(orders) got %q wanted nil`, err)
+	}
+	if _, err := db.CreateTable("users", nil); !errors.Is(err, ErrTableExists) {
+		t.Errorf(`CreateTable(users) twice got %v wanted ErrTableExists`, err)
+	}
+
+	userRID, err := users.Insert([]byte("gopher"))
+	if err != nil {
+		t.Fatalf(`Insert() got %q wanted nil`, err)
+	}
+	orderRID, err := orders.Insert([]byte("order 1"))
+	if err != nil {
+		t.Fatalf(`Insert() got %q wanted nil`, err)
+	}
+	if file, _ := SplitPageID(userRID.PageID); file != DefaultTablespace {
+		t.Errorf(`users RID %v is in tablespace %d; want %d`, userRID, file, DefaultTablespace)
+	}
+	if file, _ := SplitPageID(orderRID.PageID); file != second {
+		t.Errorf(`orders RID %v is in tablespace %d; want %d`, orderRID, file, second)
+	}
+	if _, err := users.Get(orderRID); err == nil {
+		t.Errorf(`users.Get() of an orders RID got nil wanted error`)
+	}
+	if err := db.Close(); err != nil {
+		t.Fatalf(`Close() got %q wanted nil`, err)
+	}
+
+	if _, err := os.Stat(filepath.Join(dir, "second"+tablespaceFileExt)); err != nil {
+		t.Errorf(`tablespace file: %v`, err)
+	}
+
+	db = openTestDatabase(t, dir)
+	defer db.Close()
+	for name, want := range map[string]struct {
+		rid    RID
+		record string
+		schema string
+	}{
+		"users":  {userRID, "gopher", "id int, name text"},
+		"orders": {orderRID, "order 1", "id int, total int"},
+	} {
+		table, err := db.Table(name)
+		if err != nil {
+			t.Fatalf(`Table(%s) got %q wanted nil`, name, err)
+		}
+		if string(table.Schema) != want.schema {
+			t.Errorf(`Table(%s).Schema = %q; want %q`, name, table.Schema, want.schema)
+		}
+		got, err := table.Get(want.rid)
+		if err != nil {
+			t.Fatalf(`%s.Get(%v) got %q wanted nil`, name, want.rid, err)
+		}
+		if string(got) != want.record {
+			t.Errorf(`%s.Get(%v) = %q; want %q`, name, want.rid, got, want.record)
+		}
+	}
+	if _, err := db.Table("missing"); !errors.Is(err, ErrTableNotFound) {
+		t.Errorf(`Table(missing) got %v wanted ErrTableNotFound`, err)
+	}
+}
+
+func TestDatabaseRecoverSharedLog(t *testing.T) {
+	db := openTestDatabase(t, t.TempDir())
+	defer db.Close()
+	wal := newTestWAL(t)
+
+	second, err := db.CreateTablespace("second")
+	if err != nil {
+		t.Fatalf(`CreateTablespace() got %q wanted nil`, err)
+	}
+	main, _ := db.Tablespace(DefaultTablespace)
+	other, _ := db.Tablespace(second)
+
+	// Give both files a page with the same local PageID
+	var pages [2]*Page
+	for i, ts := range []*Tablespace{main, other} {
+		for {
+			page, err := ts.Pager().AllocatePage(PageTypeData)
+			if err != nil {
+				t.Fatalf(`AllocatePage() got %q wanted nil`, err)
+			}
+			if page.Header.PageID == 5 {
+				pages[i] = page
+				break
+			}
+		}
+	}
+
+	// Log a committed change to the second file's page under its global PageID
+	before := clonePage(pages[1])
+	pages[1].Body[0] = 42
+	entry := &WriteAheadLogEntry{TxnID: 1, Type: EntryTypeWrite, PageID: GlobalPageID(second, 5)}
+	oldImage, err := other.Pager().encodePage(before)
+	if err != nil {
+		t.Fatalf(`encodePage() got %q wanted nil`, err)
+	}
+	newImage, err := other.Pager().encodePage(pages[1])
+	if err != nil {
+		t.Fatalf(`encodePage() got %q wanted nil`, err)
+	}
+	copy(entry.OldData[:], oldImage)
+	copy(entry.NewData[:], newImage)
+	if err := wal.Append(entry); err != nil {
+		t.Fatalf(`Append() got %q wanted nil`, err)
+	}
+	if err := wal.Append(&WriteAheadLogEntry{TxnID: 1, Type: EntryTypeCommit}); err != nil {
+		t.Fatalf(`Append() got %q wanted nil`, err)
+	}
+	if err := wal.Flush(); err != nil {
+		t.Fatalf(`Flush() got %q wanted nil`, err)
+	}
+
+	// The change itself never reached the file
+	pages[1].Body[0] = 0
+
+	if err := db.Recover(wal); err != nil {
+		t.Fatalf(`Recover() got %q wanted nil`, err)
+	}
+	for i, ts := range []*Tablespace{main, other} {
+		page, err := ts.Pager().ReadPage(5)
+		if err != nil {
+			t.Fatalf(`ReadPage(5) got %q wanted nil`, err)
+		}
+		if want := byte(42 * i); page.Body[0] != want {
+			t.Errorf(`tablespace %d page 5 body[0] = %d; want %d`, ts.ID, page.Body[0], want)
+		}
+	}
+}
+
+func TestTablesInSeparateFiles(t *testing.T) {
+	dir := t.TempDir()
+	db := openTestDatabase(t, dir)
+
+	tables := make(map[string]*Table)
+	rids := make(map[string]RID)
+	for _, name := range []string{"a", "b"} {
+		table, err := db.CreateTable(name, nil, WithFile(name+".db"))
+		if err != nil {
+			t.Fatalf(`CreateTable(%s) got %q wanted nil`, name, err)
+		}
+		rid, err := table.Insert([]byte("row of " + name))
+		if err != nil {
+			t.Fatalf(`Insert() got %q wanted nil`, err)
+		}
+		tables[name], rids[name] = table, rid
+	}
+	if tables["a"].Tablespace == tables["b"].Tablespace || tables["a"].Tablespace == DefaultTablespace {
+		t.Fatalf(`tables are in tablespaces %d and %d; want two new ones`, tables["a"].Tablespace, tables["b"].Tablespace)
+	}
+	if _, err := db.CreateTable("c", nil, InTablespace(tables["a"].Tablespace)); err == nil {
+		t.Errorf(`CreateTable() in a dedicated tablespace got nil wanted error`)
+	}
+	if _, err := db.CreateTable("c", nil, WithFile("a.db")); err == nil {
+		t.Errorf(`CreateTable() WithFile of an existing file got nil wanted error`)
+	}
+
+	if err := db.DropTable("a"); err != nil {
+		t.Fatalf(`DropTable(a) got %q wanted nil`, err)
+	}
+	if _, err := os.Stat(filepath.Join(dir, "a.db")); !os.IsNotExist(err) {
+		t.Errorf(`a.db after DropTable(a): %v; want it deleted`, err)
+	}
+	if _, err := os.Stat(filepath.Join(dir, "b.db")); err != nil {
+		t.Errorf(`b.db after DropTable(a): %v`, err)
+	}
+	if err := db.Close(); err != nil {
+		t.Fatalf(`Close() got %q wanted nil`, err)
+	}
+
+	db = openTestDatabase(t, dir)
+	defer db.Close()
+	if _, err := db.Table("a"); !errors.Is(err, ErrTableNotFound) {
+		t.Errorf(`Table(a) after reopening got %v wanted ErrTableNotFound`, err)
+	}
+	b, err := db.Table("b")
+	if err != nil {
+		t.Fatalf(`Table(b) got %q wanted nil`, err)
+	}
+	if ts, _ := db.Tablespace(b.Tablespace); ts == nil || !ts.Dedicated || ts.Path != "b.db" {
+		t.Errorf(`Table(b) tablespace = %+v; want dedicated file b.db`, ts)
+	}
+	got, err := b.Get(rids["b"])
+	if err != nil {
+		t.Fatalf(`Get() got %q wanted nil`, err)
+	}
+	if string(got) != "row of b" {
+		t.Errorf(`Get() = %q; want "row of b"`, got)
+	}
+}
+
+func TestDropTableFreesSharedPages(t *testing.T) {
+	db := openTestDatabase(t, t.TempDir())
+	defer db.Close()
+
+	keep, err := db.CreateTable("keep", nil)
+	if err != nil {
+		t.Fatalf(`CreateTable() got %q wanted nil`, err)
+	}
+	drop, err := db.CreateTable("drop", nil)
+	if err != nil {
+		t.Fatalf(`CreateTable() got %q wanted nil`, err)
+	}
+	for i := 0; i < 4; i++ {
+		if _, err := drop.Insert(make([]byte, MaxRecordSize)); err != nil {
+			t.Fatalf(`Insert() got %q wanted nil`, err)
+		}
+	}
+	if _, err := drop.Insert(make([]byte, 3*MaxBodySize)); err != nil {
+		t.Fatalf(`Insert() got %q wanted nil`, err)
+	}
+	// A page of another table after the dropped one keeps the file from
+	// simply being truncated
+	if _, err := keep.heap.AppendPage(); err != nil {
+		t.Fatalf(`AppendPage() got %q wanted nil`, err)
+	}
+
+	if err := db.DropTable("drop"); err != nil {
+		t.Fatalf(`DropTable() got %q wanted nil`, err)
+	}
+	main, _ := db.Tablespace(DefaultTablespace)
+	free, err := main.Pager().FreePages()
+	if err != nil {
+		t.Fatalf(`FreePages() got %q wanted nil`, err)
+	}
+	// Four data pages, one overflow stub page and four overflow pages
+	if len(free) != 9 {
+		t.Errorf(`DropTable() freed %d pages; want 9`, len(free))
+	}
+}
+
+func TestDroppedFileIDIsNotReused(t *testing.T) {
+	dir := t.TempDir()
+	db := openTestDatabase(t, dir)
+
+	a, err := db.CreateTable("a", nil, WithFile("a.db"))
+	if err != nil {
+		t.Fatalf(`CreateTable(a) got %q wanted nil`, err)
+	}
+	dropped := a.Tablespace
+	if err := db.DropTable("a"); err != nil {
+		t.Fatalf(`DropTable(a) got %q wanted nil`, err)
+	}
+	b, err := db.CreateTable("b", nil, WithFile("b.db"))
+	if err != nil {
+		t.Fatalf(`CreateTable(b) got %q wanted nil`, err)
+	}
+	if b.Tablespace <= dropped {
+		t.Errorf(`CreateTable(b) got tablespace %d after %d was dropped; want a new FileID`, b.Tablespace, dropped)
+	}
+	dropped = b.Tablespace
+	if err := db.DropTable("b"); err != nil {
+		t.Fatalf(`DropTable(b) got %q wanted nil`, err)
+	}
+	if err := db.Close(); err != nil {
+		t.Fatalf(`Close() got %q wanted nil`, err)
+	}
+
+	// The highest FileID stays used once the database is reopened
+	db = openTestDatabase(t, dir)
+	defer db.Close()
+	id, err := db.CreateTablespace("c")
+	if err != nil {
+		t.Fatalf(`CreateTablespace() got %q wanted nil`, err)
+	}
+	if id <= dropped {
+		t.Errorf(`CreateTablespace() after reopening got %d; want more than %d`, id, dropped)
+	}
+}
+
+func TestCreateTableRemovesFileOnFailure(t *testing.T) {
+	dir := t.TempDir()
+	db := openTestDatabase(t, dir)
+
+	// Only files opened from now on fail, and the new file's first write, its
+	// heap's head page, is the one that does
+	db.config.Faults = &FaultConfig{FailWriteN: 1}
+	if _, err := db.CreateTable("t", nil, WithFile("t.db")); err == nil {
+		t.Fatalf(`CreateTable() got nil wanted error`)
+	}
+	if _, err := os.Stat(filepath.Join(dir, "t.db")); !os.IsNotExist(err) {
+		t.Errorf(`t.db after a failed CreateTable(): %v; want it deleted`, err)
+	}
+	if len(db.tablespaces) != 1 {
+		t.Errorf(`database has %d tablespaces after a failed CreateTable(); want 1`, len(db.tablespaces))
+	}
+	if err := db.Close(); err != nil {
+		t.Fatalf(`Close() got %q wanted nil`, err)
+	}
+
+	db = openTestDatabase(t, dir)
+	defer db.Close()
+	if len(db.tablespaces) != 1 {
+		t.Errorf(`reopened database has %d tablespaces; want 1`, len(db.tablespaces))
+	}
+	if _, err := db.CreateTable("t", nil, WithFile("t.db")); err != nil {
+		t.Errorf(`CreateTable() after the failed one got %q wanted nil`, err)
+	}
+}
@@ -0,0 +1,61 @@
+package engine
+
+import (
+	"errors"
+	"sync"
+)
+
+var ErrInjectedFault = errors.New("injected fault")
+
+// FaultConfig describes I/O failures to inject into a pager's backing file.
+// Write counts are 1-based and include every WriteAt the pager issues after it
+// has opened the file; a zero count disables that fault
+type FaultConfig struct {
+	// FailWriteN makes the Nth write fail without writing anything
+	FailWriteN int
+	// TornWriteN makes the Nth write persist only its first TornWriteBytes
+	// bytes before failing, as if the process crashed mid-write
+	TornWriteN     int
+	TornWriteBytes int
+	// FailSync makes every Sync fail
+	FailSync bool
+}
+
+// faultFile wraps a pageFile and injects the failures described by a
+// FaultConfig
+type faultFile struct {
+	pageFile
+	config FaultConfig
+	mutex  sync.Mutex
+	writes int
+}
+
+func newFaultFile(file pageFile, config FaultConfig) *faultFile {
+	return &faultFile{pageFile: file, config: config}
+}
+
+func (f *faultFile) WriteAt(buffer []byte, offset int64) (int, error) {
+	f.mutex.Lock()
+	f.writes++
+	write := f.writes
+	f.mutex.Unlock()
+
+	if write == f.config.FailWriteN {
+		return 0, ErrInjectedFault
+	}
+	if write == f.config.TornWriteN && f.config.TornWriteBytes < len(buffer) {
+		n, err := f.pageFile.WriteAt(buffer[:f.config.TornWriteBytes], offset)
+		if err != nil {
+			return n, err
+		}
+		return n, ErrInjectedFault
+	}
+	return f.pageFile.WriteAt(buffer, offset)
+}
+
+func (f *faultFile) Sync() error {
+	if f.config.FailSync {
+		return ErrInjectedFault
+	}
+	return f.pageFile.Sync()
+}
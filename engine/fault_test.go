@@ -0,0 +1,117 @@
+package engine
+
+import (
+	"errors"
+	"path/filepath"
+	"testing"
+)
+
+// logPageWrite appends a WAL write entry carrying a page's before and after
+// images
+func logPageWrite(t *testing.T, pager *Pager, wal *WriteAheadLog, txnID uint64, before, after *Page) {
+	t.Helper()
+	entry := &WriteAheadLogEntry{TxnID: txnID, Type: EntryTypeWrite, PageID: after.Header.PageID}
+	oldImage, err := pager.encodePage(before)
+	if err != nil {
+		t.Fatalf(`encodePage() got %q wanted nil`, err)
+	}
+	newImage, err := pager.encodePage(after)
+	if err != nil {
+		t.Fatalf(`encodePage() got %q wanted nil`, err)
+	}
+	copy(entry.OldData[:], oldImage)
+	copy(entry.NewData[:], newImage)
+	if err := wal.Append(entry); err != nil {
+		t.Fatalf(`Append() got %q wanted nil`, err)
+	}
+}
+
+// clonePage returns a deep copy of a page
+func clonePage(page *Page) *Page {
+	clone := *page
+	clone.Body = append([]byte(nil), page.Body...)
+	clone.elem = nil
+	return &clone
+}
+
+func TestRecoverRepairsTornPageWrite(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "torn.db")
+	wal := newTestWAL(t)
+
+	// Write 1 is the allocation; write 2 is torn after 512 bytes
+	pager, err := NewPager(PagerConfig{
+		FilePath:     path,
+		MaxCacheSize: 10,
+		Faults:       &FaultConfig{TornWriteN: 2, TornWriteBytes: 512},
+	})
+	if err != nil {
+		t.Fatalf(`NewPager() got %q wanted nil`, err)
+	}
+	page, err := pager.AllocatePage(PageTypeData)
+	if err != nil {
+		t.Fatalf(`AllocatePage() got %q wanted nil`, err)
+	}
+	pageID := page.Header.PageID
+
+	before := clonePage(page)
+	for i := range page.Body {
+		page.Body[i] = byte(i)
+	}
+	logPageWrite(t, pager, wal, 1, before, page)
+	if err := wal.Append(&WriteAheadLogEntry{TxnID: 1, Type: EntryTypeCommit}); err != nil {
+		t.Fatalf(`Append(commit) got %q wanted nil`, err)
+	}
+	if err := wal.Flush(); err != nil {
+		t.Fatalf(`Flush() got %q wanted nil`, err)
+	}
+
+	if err := pager.WritePage(page); !errors.Is(err, ErrInjectedFault) {
+		t.Fatalf(`WritePage() got %v wanted ErrInjectedFault`, err)
+	}
+	pager.file.Close()
+
+	// After the simulated crash the page is torn on disk
+	restarted, err := NewPager(PagerConfig{FilePath: path, MaxCacheSize: 10})
+	if err != nil {
+		t.Fatalf(`NewPager() got %q wanted nil`, err)
+	}
+	defer restarted.Close()
+	if _, err := restarted.ReadPage(pageID); !errors.Is(err, ErrTornPage) {
+		t.Fatalf(`ReadPage() of torn page got %v wanted ErrTornPage`, err)
+	}
+
+	if err := Recover(restarted, wal); err != nil {
+		t.Fatalf(`Recover() got %q wanted nil`, err)
+	}
+	repaired, err := restarted.ReadPage(pageID)
+	if err != nil {
+		t.Fatalf(`ReadPage() after Recover got %q wanted nil`, err)
+	}
+	for i := range repaired.Body {
+		if repaired.Body[i] != byte(i) {
+			t.Fatalf(`repaired body[%d] = %d; want %d`, i, repaired.Body[i], byte(i))
+		}
+	}
+}
+
+func TestFaultInjection(t *testing.T) {
+	pager, err := NewMemoryPager(PagerConfig{
+		MaxCacheSize: 10,
+		Faults:       &FaultConfig{FailWriteN: 2, FailSync: true},
+	})
+	if err != nil {
+		t.Fatalf(`NewMemoryPager() got %q wanted nil`, err)
+	}
+	defer pager.Close()
+
+	page, err := pager.AllocatePage(PageTypeData)
+	if err != nil {
+		t.Fatalf(`AllocatePage() got %q wanted nil`, err)
+	}
+	if _, err := pager.AllocatePage(PageTypeData); !errors.Is(err, ErrInjectedFault) {
+		t.Errorf(`second AllocatePage() got %v wanted ErrInjectedFault`, err)
+	}
+	if err := pager.WritePage(page); !errors.Is(err, ErrInjectedFault) {
+		t.Errorf(`WritePage() with failing sync got %v wanted ErrInjectedFault`, err)
+	}
+}
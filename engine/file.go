@@ -0,0 +1,136 @@
+package engine
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"sync"
+)
+
+// pageFile is the backing store a Pager reads and writes pages through
+type pageFile interface {
+	io.ReaderAt
+	io.WriterAt
+	Name() string
+	Size() (int64, error)
+	Sync() error
+	Truncate(size int64) error
+	Close() error
+}
+
+// osFile is a pageFile backed by a file on disk
+type osFile struct {
+	*os.File
+}
+
+func (f osFile) Size() (int64, error) {
+	info, err := f.Stat()
+	if err != nil {
+		return 0, err
+	}
+	return info.Size(), nil
+}
+
+// memFile is a pageFile backed by a byte slice. Sync is a no-op and the
+// contents are lost on Close
+type memFile struct {
+	name   string
+	mutex  sync.RWMutex
+	data   []byte
+	closed bool
+}
+
+func newMemFile(name string) *memFile {
+	return &memFile{name: name}
+}
+
+func (f *memFile) Name() string {
+	return f.name
+}
+
+func (f *memFile) ReadAt(buffer []byte, offset int64) (int, error) {
+	f.mutex.RLock()
+	defer f.mutex.RUnlock()
+
+	if f.closed {
+		return 0, os.ErrClosed
+	}
+	if offset < 0 {
+		return 0, fmt.Errorf("negative offset %d", offset)
+	}
+	if offset >= int64(len(f.data)) {
+		return 0, io.EOF
+	}
+	n := copy(buffer, f.data[offset:])
+	if n < len(buffer) {
+		return n, io.EOF
+	}
+	return n, nil
+}
+
+func (f *memFile) WriteAt(buffer []byte, offset int64) (int, error) {
+	f.mutex.Lock()
+	defer f.mutex.Unlock()
+
+	if f.closed {
+		return 0, os.ErrClosed
+	}
+	if offset < 0 {
+		return 0, fmt.Errorf("negative offset %d", offset)
+	}
+	if end := offset + int64(len(buffer)); end > int64(len(f.data)) {
+		f.data = append(f.data, make([]byte, end-int64(len(f.data)))...)
+	}
+	return copy(f.data[offset:], buffer), nil
+}
+
+func (f *memFile) Size() (int64, error) {
+	f.mutex.RLock()
+	defer f.mutex.RUnlock()
+
+	if f.closed {
+		return 0, os.ErrClosed
+	}
+	return int64(len(f.data)), nil
+}
+
+func (f *memFile) Sync() error {
+	f.mutex.RLock()
+	defer f.mutex.RUnlock()
+
+	if f.closed {
+		return os.ErrClosed
+	}
+	return nil
+}
+
+func (f *memFile) Truncate(size int64) error {
+	f.mutex.Lock()
+	defer f.mutex.Unlock()
+
+	if f.closed {
+		return os.ErrClosed
+	}
+	if size < 0 {
+		return fmt.Errorf("negative size %d", size)
+	}
+	if size <= int64(len(f.data)) {
+		clear(f.data[size:])
+		f.data = f.data[:size]
+	} else {
+		f.data = append(f.data, make([]byte, size-int64(len(f.data)))...)
+	}
+	return nil
+}
+
+func (f *memFile) Close() error {
+	f.mutex.Lock()
+	defer f.mutex.Unlock()
+
+	if f.closed {
+		return os.ErrClosed
+	}
+	f.closed = true
+	f.data = nil
+	return nil
+}
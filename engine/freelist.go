@@ -0,0 +1,230 @@
+package engine
+
+import (
+	"fmt"
+)
+
+// Deallocated pages form a chain threaded through their NextPageID, with the
+// head kept in p.freeListHead. The helpers here walk and edit that chain. All
+// of them require the caller to hold p.mutex
+
+// FreePages returns the PageIDs on the free list, most recently freed first
+func (p *Pager) FreePages() ([]PageID, error) {
+	p.mutex.Lock()
+	defer p.mutex.Unlock()
+
+	ids, err := p.freeListIDs()
+	if err != nil {
+		return nil, &PagerError{Op: "FreePages", Err: err}
+	}
+	return ids, nil
+}
+
+// freeListIDs returns the PageIDs on the free list in chain order
+func (p *Pager) freeListIDs() ([]PageID, error) {
+	var ids []PageID
+	seen := make(map[PageID]bool)
+	for pageID := p.freeListHead; pageID != 0; {
+		if seen[pageID] {
+			return nil, fmt.Errorf("cycle in free list at page %d", pageID)
+		}
+		seen[pageID] = true
+
+		page, err := p.readPageFromDisk(pageID)
+		if err != nil {
+			return nil, fmt.Errorf("unable to read free page %d: %w", pageID, err)
+		}
+		if page.Header.PageType != PageTypeFree {
+			return nil, fmt.Errorf("page %d on the free list is not free", pageID)
+		}
+		ids = append(ids, pageID)
+		pageID = page.Header.NextPageID
+	}
+	return ids, nil
+}
+
+// Truncate shrinks the file to newPageCount pages, counting the superblock.
+// Every page being cut off must already be free; they are taken off the free
+// list and dropped from the cache. Deallocating the last page already shrinks
+// the file, so this is for free pages that were left behind the end of it
+func (p *Pager) Truncate(newPageCount uint64) error {
+	p.mutex.Lock()
+	defer p.mutex.Unlock()
+
+	if p.readOnly {
+		return &PagerError{Op: "Truncate", Err: ErrReadOnly}
+	}
+	if newPageCount < 1 || newPageCount > uint64(p.nextPageID) {
+		return &PagerError{
+			Op:  "Truncate",
+			Err: fmt.Errorf("page count %d outside [1, %d]", newPageCount, p.nextPageID),
+		}
+	}
+
+	ids, err := p.freeListIDs()
+	if err != nil {
+		return &PagerError{Op: "Truncate", Err: err}
+	}
+	free := make(map[PageID]bool, len(ids))
+	for _, pageID := range ids {
+		free[pageID] = true
+	}
+	for pageID := PageID(newPageCount); pageID < p.nextPageID; pageID++ {
+		if free[pageID] {
+			continue
+		}
+		// Free pages that fell off the list, e.g. in a crash, can go too
+		page, err := p.readPageFromDisk(pageID)
+		if err != nil {
+			return &PagerError{
+				Op:  "Truncate",
+				Err: fmt.Errorf("unable to read page %d: %w", pageID, err),
+			}
+		}
+		if page.Header.PageType != PageTypeFree {
+			return &PagerError{
+				Op:  "Truncate",
+				Err: fmt.Errorf("page %d is still allocated", pageID),
+			}
+		}
+	}
+	return p.truncateFree("Truncate", ids, PageID(newPageCount))
+}
+
+// growBatch is how many pages Grow writes per call to the file
+const growBatch = 256
+
+// Grow extends the file by nPages free pages, so the allocations that follow
+// reuse them instead of extending the file one page at a time. The new pages
+// go on the front of the free list in PageID order
+func (p *Pager) Grow(nPages uint64) error {
+	p.mutex.Lock()
+	defer p.mutex.Unlock()
+
+	if p.readOnly {
+		return &PagerError{Op: "Grow", Err: ErrReadOnly}
+	}
+	if nPages == 0 {
+		return nil
+	}
+
+	start := p.nextPageID
+	end := start + PageID(nPages)
+	for batchStart := start; batchStart < end; batchStart += growBatch {
+		batch := make([]*Page, 0, min(growBatch, end-batchStart))
+		for pageID := batchStart; pageID < end && len(batch) < growBatch; pageID++ {
+			page := NewPage(PageTypeFree)
+			page.Header.PageID = pageID
+			page.Header.NextPageID = pageID + 1
+			if pageID == end-1 {
+				page.Header.NextPageID = p.freeListHead
+			}
+			batch = append(batch, page)
+		}
+		if err := p.writePages("Grow", batch); err != nil {
+			return err
+		}
+	}
+	if err := p.file.Sync(); err != nil {
+		return &PagerError{
+			Op:  "Grow",
+			Err: fmt.Errorf("unable to sync file: %w", err),
+		}
+	}
+
+	p.nextPageID = end
+	p.freeListHead = start
+	p.superblockDirty = true
+	return nil
+}
+
+// shrinkFreeTail gives the run of free pages at the end of the file back to
+// the file system: they are unlinked from the free list, the allocation
+// high-water mark drops below them, and the file is truncated
+func (p *Pager) shrinkFreeTail() error {
+	ids, err := p.freeListIDs()
+	if err != nil {
+		return &PagerError{Op: "ShrinkFreeTail", Err: err}
+	}
+	free := make(map[PageID]bool, len(ids))
+	for _, pageID := range ids {
+		free[pageID] = true
+	}
+
+	newNext := p.nextPageID
+	for newNext > 1 && free[newNext-1] {
+		newNext--
+	}
+	return p.truncateFree("ShrinkFreeTail", ids, newNext)
+}
+
+// truncateFree cuts the file down to newNext pages, all pages from newNext on
+// being on the free list ids
+func (p *Pager) truncateFree(op string, ids []PageID, newNext PageID) error {
+	if newNext == p.nextPageID {
+		return nil
+	}
+
+	// Relink the surviving free pages, skipping the ones being cut off
+	var kept []PageID
+	for _, pageID := range ids {
+		if pageID < newNext {
+			kept = append(kept, pageID)
+		}
+	}
+	if err := p.relinkFreeList(ids, kept); err != nil {
+		return err
+	}
+
+	if err := p.file.Truncate(int64(newNext) * PageSize); err != nil {
+		return &PagerError{
+			Op:  op,
+			Err: fmt.Errorf("unable to truncate file: %w", err),
+		}
+	}
+	for pageID := newNext; pageID < p.nextPageID; pageID++ {
+		p.dropPage(pageID)
+	}
+	p.nextPageID = newNext
+	p.superblockDirty = true
+	return nil
+}
+
+// relinkFreeList rewrites the free list, currently chained as old, so that it
+// is chained as kept, which must be a subsequence of old. Only pages whose
+// link changes are rewritten
+func (p *Pager) relinkFreeList(old []PageID, kept []PageID) error {
+	oldNext := make(map[PageID]PageID, len(old))
+	for i, pageID := range old {
+		if i+1 < len(old) {
+			oldNext[pageID] = old[i+1]
+		}
+	}
+
+	for i, pageID := range kept {
+		var next PageID
+		if i+1 < len(kept) {
+			next = kept[i+1]
+		}
+		if oldNext[pageID] == next {
+			continue
+		}
+		page, err := p.readPageFromDisk(pageID)
+		if err != nil {
+			return &PagerError{
+				Op:  "RelinkFreeList",
+				Err: fmt.Errorf("unable to read free page %d: %w", pageID, err),
+			}
+		}
+		page.Header.NextPageID = next
+		if err := p.writePage(page); err != nil {
+			return err
+		}
+	}
+
+	p.freeListHead = 0
+	if len(kept) > 0 {
+		p.freeListHead = kept[0]
+	}
+	return nil
+}
@@ -0,0 +1,200 @@
+package engine
+
+import (
+	"encoding/binary"
+	"fmt"
+)
+
+// The free-space index groups pages into buckets of fsmBucketWidth free bytes
+// each. Every page in a bucket above the one a request falls into has room
+// for it, so a lookup only has to check pages individually in one bucket
+const (
+	fsmBucketWidth = 128
+	fsmBuckets     = MaxBodySize/fsmBucketWidth + 1
+)
+
+// freeSpaceIndex tracks the free bytes of each page in a heap file
+type freeSpaceIndex struct {
+	free    map[PageID]uint32
+	buckets [fsmBuckets]map[PageID]struct{}
+}
+
+func newFreeSpaceIndex() *freeSpaceIndex {
+	index := &freeSpaceIndex{free: make(map[PageID]uint32)}
+	for i := range index.buckets {
+		index.buckets[i] = make(map[PageID]struct{})
+	}
+	return index
+}
+
+func fsmBucket(free uint32) int {
+	return int(min(free, MaxBodySize) / fsmBucketWidth)
+}
+
+// contains reports whether the index tracks pageID
+func (index *freeSpaceIndex) contains(pageID PageID) bool {
+	_, ok := index.free[pageID]
+	return ok
+}
+
+// update records that pageID has free bytes available
+func (index *freeSpaceIndex) update(pageID PageID, free uint32) {
+	if old, ok := index.free[pageID]; ok {
+		delete(index.buckets[fsmBucket(old)], pageID)
+	}
+	index.free[pageID] = free
+	index.buckets[fsmBucket(free)][pageID] = struct{}{}
+}
+
+// find returns a page with at least need free bytes
+func (index *freeSpaceIndex) find(need uint32) (PageID, bool) {
+	if need > MaxBodySize {
+		return 0, false
+	}
+	first := fsmBucket(need)
+	for pageID := range index.buckets[first] {
+		if index.free[pageID] >= need {
+			return pageID, true
+		}
+	}
+	for bucket := first + 1; bucket < fsmBuckets; bucket++ {
+		for pageID := range index.buckets[bucket] {
+			return pageID, true
+		}
+	}
+	return 0, false
+}
+
+// bestFit returns the page with the least free space that still has at least
+// need free bytes
+func (index *freeSpaceIndex) bestFit(need uint32) (PageID, bool) {
+	if need > MaxBodySize {
+		return 0, false
+	}
+	for bucket := fsmBucket(need); bucket < fsmBuckets; bucket++ {
+		var best PageID
+		for pageID := range index.buckets[bucket] {
+			free := index.free[pageID]
+			if free < need {
+				continue
+			}
+			if best == 0 || free < index.free[best] || (free == index.free[best] && pageID < best) {
+				best = pageID
+			}
+		}
+		if best != 0 {
+			return best, true
+		}
+	}
+	return 0, false
+}
+
+// A persisted index is a chain of metadata pages. The first page's body
+// starts with the heap's tail PageID, and every page then holds a uint32 entry
+// count followed by (PageID uint64, free uint32) entries
+const (
+	fsmEntrySize      = 12
+	fsmEntriesPerPage = (MaxBodySize - 8 - 4) / fsmEntrySize
+)
+
+// save writes the index and tailPageID to a new chain of metadata pages and
+// returns its first page
+func (index *freeSpaceIndex) save(pager *Pager, tailPageID PageID) (PageID, error) {
+	pageIDs := make([]PageID, 0, len(index.free))
+	for pageID := range index.free {
+		pageIDs = append(pageIDs, pageID)
+	}
+
+	var first, prev *Page
+	for len(pageIDs) > 0 || first == nil {
+		page, err := pager.AllocatePage(PageTypeMetadata)
+		if err != nil {
+			return 0, err
+		}
+		body := page.Body
+		if first == nil {
+			first = page
+			binary.LittleEndian.PutUint64(body, uint64(tailPageID))
+		}
+		body = body[8:]
+
+		count := min(len(pageIDs), fsmEntriesPerPage)
+		binary.LittleEndian.PutUint32(body, uint32(count))
+		for i, pageID := range pageIDs[:count] {
+			entry := body[4+i*fsmEntrySize:]
+			binary.LittleEndian.PutUint64(entry, uint64(pageID))
+			binary.LittleEndian.PutUint32(entry[8:], index.free[pageID])
+		}
+		pageIDs = pageIDs[count:]
+
+		if prev != nil {
+			LinkPages(prev, page)
+			if err := pager.WritePage(prev); err != nil {
+				return 0, err
+			}
+		}
+		prev = page
+	}
+	if err := pager.WritePage(prev); err != nil {
+		return 0, err
+	}
+	return first.Header.PageID, nil
+}
+
+// remapFreeSpaceIndexPage translates the PageIDs a page of a saved index
+// holds through remap: the tail, which only the first page records, and the
+// page of each entry
+func remapFreeSpaceIndexPage(page *Page, remap func(PageID) (PageID, error)) error {
+	body := page.Body
+	tail, err := remap(PageID(binary.LittleEndian.Uint64(body)))
+	if err != nil {
+		return err
+	}
+	binary.LittleEndian.PutUint64(body, uint64(tail))
+	body = body[8:]
+
+	count := int(binary.LittleEndian.Uint32(body))
+	if count > fsmEntriesPerPage {
+		return fmt.Errorf("free-space index page %d holds %d entries, more than %d", page.Header.PageID, count, fsmEntriesPerPage)
+	}
+	for i := 0; i < count; i++ {
+		entry := body[4+i*fsmEntrySize:]
+		pageID, err := remap(PageID(binary.LittleEndian.Uint64(entry)))
+		if err != nil {
+			return err
+		}
+		binary.LittleEndian.PutUint64(entry, uint64(pageID))
+	}
+	return nil
+}
+
+// loadFreeSpaceIndex reads an index saved by save, returning it and the tail
+// PageID it was saved with
+func loadFreeSpaceIndex(pager *Pager, firstPageID PageID) (*freeSpaceIndex, PageID, error) {
+	index := newFreeSpaceIndex()
+	var tailPageID PageID
+	err := pager.WalkFrom(firstPageID, func(page *Page) error {
+		if page.Header.PageType != PageTypeMetadata {
+			return fmt.Errorf("page %d is not a free-space index page", page.Header.PageID)
+		}
+		body := page.Body
+		if page.Header.PageID == firstPageID {
+			tailPageID = PageID(binary.LittleEndian.Uint64(body))
+		}
+		body = body[8:]
+
+		count := int(binary.LittleEndian.Uint32(body))
+		if count > fsmEntriesPerPage {
+			return fmt.Errorf("free-space index page %d holds %d entries", page.Header.PageID, count)
+		}
+		for i := 0; i < count; i++ {
+			entry := body[4+i*fsmEntrySize:]
+			index.update(PageID(binary.LittleEndian.Uint64(entry)), binary.LittleEndian.Uint32(entry[8:]))
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, 0, err
+	}
+	return index, tailPageID, nil
+}
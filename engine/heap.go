@@ -0,0 +1,780 @@
+package engine
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"iter"
+	"maps"
+	"slices"
+	"sync"
+)
+
+// HeapFile is the storage for a table: a doubly linked chain of data pages.
+// Only the head PageID needs to be recorded elsewhere; the rest of the chain is
+// reached through NextPageID/PrevPageID
+type HeapFile struct {
+	pager      *Pager
+	mutex      sync.Mutex
+	headPageID PageID
+	tailPageID PageID
+	// freeSpace tracks each page in the chain by its free bytes so inserts
+	// can pick a page without reading the chain
+	freeSpace *freeSpaceIndex
+	strategy  InsertStrategy
+	// Records longer than compressAbove bytes are compressed with
+	// recordCodec when that makes them smaller
+	recordCodec   Compression
+	compressAbove int
+	// keyFilter makes inserts give the pages they touch a key filter over
+	// their records, see SetKeyFilter
+	keyFilter bool
+	// indexPageID is the first page of the index saved by the last Close, or
+	// 0 if it has never been saved
+	indexPageID PageID
+}
+
+// InsertStrategy selects the page an insert places its record on
+type InsertStrategy uint8
+
+const (
+	// InsertFirstFit uses whichever page the free-space index finds first
+	// with enough room, which is the cheapest lookup
+	InsertFirstFit InsertStrategy = iota
+	// InsertBestFit uses the page with the least free space that still fits
+	// the record, packing pages tightly
+	InsertBestFit
+	// InsertAppendOnly only ever uses the tail page, appending a new one when
+	// it is full, so space freed on earlier pages is never reused
+	InsertAppendOnly
+)
+
+func (s InsertStrategy) String() string {
+	switch s {
+	case InsertFirstFit:
+		return "first-fit"
+	case InsertBestFit:
+		return "best-fit"
+	case InsertAppendOnly:
+		return "append-only"
+	default:
+		return fmt.Sprintf("unknown(%d)", uint8(s))
+	}
+}
+
+// MaxRecordSize is the largest record that fits on an empty data page
+const MaxRecordSize = MaxBodySize - slotSize
+
+// NewHeapFile allocates the head page of a new, empty heap file
+func NewHeapFile(pager *Pager) (*HeapFile, error) {
+	head, err := pager.AllocatePage(PageTypeData)
+	if err != nil {
+		return nil, &PagerError{
+			Op:  "NewHeapFile",
+			Err: fmt.Errorf("unable to allocate head page: %w", err),
+		}
+	}
+	freeSpace := newFreeSpaceIndex()
+	freeSpace.update(head.Header.PageID, head.Header.FreeSpace)
+	return &HeapFile{
+		pager:      pager,
+		headPageID: head.Header.PageID,
+		tailPageID: head.Header.PageID,
+		freeSpace:  freeSpace,
+	}, nil
+}
+
+// OpenHeapFile opens an existing heap file by its head PageID, walking the
+// chain to find its tail
+func OpenHeapFile(pager *Pager, headPageID PageID) (*HeapFile, error) {
+	tailPageID := headPageID
+	freeSpace := newFreeSpaceIndex()
+	visited := make(map[PageID]bool)
+	for pageID := headPageID; pageID != 0; {
+		if visited[pageID] {
+			return nil, &PagerError{
+				Op:  "OpenHeapFile",
+				Err: fmt.Errorf("cycle in page chain at page %d", pageID),
+			}
+		}
+		visited[pageID] = true
+
+		page, err := pager.ReadPage(pageID)
+		if err != nil {
+			return nil, &PagerError{
+				Op:  "OpenHeapFile",
+				Err: fmt.Errorf("unable to read page %d: %w", pageID, err),
+			}
+		}
+		if page.Header.PageType != PageTypeData {
+			return nil, &PagerError{
+				Op:  "OpenHeapFile",
+				Err: fmt.Errorf("page %d is not a data page", pageID),
+			}
+		}
+		tailPageID = pageID
+		freeSpace.update(pageID, page.Header.FreeSpace)
+		pageID = page.Header.NextPageID
+	}
+	return &HeapFile{
+		pager:      pager,
+		headPageID: headPageID,
+		tailPageID: tailPageID,
+		freeSpace:  freeSpace,
+	}, nil
+}
+
+// OpenHeapFileWithIndex opens an existing heap file using the free-space index
+// its last Close saved at indexPageID, so the chain does not have to be read.
+// Pages appended after the index was saved are picked up by walking the chain
+// on from the saved tail
+func OpenHeapFileWithIndex(pager *Pager, headPageID PageID, indexPageID PageID) (*HeapFile, error) {
+	freeSpace, tailPageID, err := loadFreeSpaceIndex(pager, indexPageID)
+	if err != nil {
+		return nil, &PagerError{
+			Op:  "OpenHeapFile",
+			Err: fmt.Errorf("unable to load free-space index from page %d: %w", indexPageID, err),
+		}
+	}
+	if !freeSpace.contains(headPageID) || !freeSpace.contains(tailPageID) {
+		return nil, &PagerError{
+			Op:  "OpenHeapFile",
+			Err: fmt.Errorf("free-space index at page %d does not belong to heap %d", indexPageID, headPageID),
+		}
+	}
+
+	for {
+		tail, err := pager.ReadPage(tailPageID)
+		if err != nil {
+			return nil, &PagerError{
+				Op:  "OpenHeapFile",
+				Err: fmt.Errorf("unable to read page %d: %w", tailPageID, err),
+			}
+		}
+		if tail.Header.PageType != PageTypeData {
+			return nil, &PagerError{
+				Op:  "OpenHeapFile",
+				Err: fmt.Errorf("page %d is not a data page", tailPageID),
+			}
+		}
+		freeSpace.update(tailPageID, tail.Header.FreeSpace)
+		next := tail.Header.NextPageID
+		if next == 0 {
+			break
+		}
+		if freeSpace.contains(next) {
+			return nil, &PagerError{
+				Op:  "OpenHeapFile",
+				Err: fmt.Errorf("cycle in page chain at page %d", next),
+			}
+		}
+		tailPageID = next
+	}
+
+	return &HeapFile{
+		pager:       pager,
+		headPageID:  headPageID,
+		tailPageID:  tailPageID,
+		freeSpace:   freeSpace,
+		indexPageID: indexPageID,
+	}, nil
+}
+
+// HeadPageID returns the first page of the heap file, which is what a catalog
+// stores to find the heap again
+func (h *HeapFile) HeadPageID() PageID {
+	return h.headPageID
+}
+
+// IndexPageID returns the first page of the free-space index saved by the last
+// Close, which OpenHeapFileWithIndex takes alongside the head PageID
+func (h *HeapFile) IndexPageID() PageID {
+	h.mutex.Lock()
+	defer h.mutex.Unlock()
+	return h.indexPageID
+}
+
+// Close saves the free-space index to metadata pages, replacing the copy saved
+// by any earlier Close
+func (h *HeapFile) Close() error {
+	h.mutex.Lock()
+	defer h.mutex.Unlock()
+
+	if h.indexPageID != 0 {
+		var old []PageID
+		err := h.pager.WalkFrom(h.indexPageID, func(page *Page) error {
+			old = append(old, page.Header.PageID)
+			return nil
+		})
+		if err != nil {
+			return &PagerError{
+				Op:  "HeapClose",
+				Err: fmt.Errorf("unable to read old free-space index: %w", err),
+			}
+		}
+		for _, pageID := range old {
+			if err := h.pager.DeallocatePage(pageID); err != nil {
+				return err
+			}
+		}
+		h.indexPageID = 0
+	}
+
+	indexPageID, err := h.freeSpace.save(h.pager, h.tailPageID)
+	if err != nil {
+		return &PagerError{
+			Op:  "HeapClose",
+			Err: fmt.Errorf("unable to save free-space index: %w", err),
+		}
+	}
+	h.indexPageID = indexPageID
+	return nil
+}
+
+// SetInsertStrategy changes how later inserts choose their page. The default
+// is InsertFirstFit
+func (h *HeapFile) SetInsertStrategy(strategy InsertStrategy) {
+	h.mutex.Lock()
+	defer h.mutex.Unlock()
+	h.strategy = strategy
+}
+
+// Drop deallocates every page of the heap file, including the overflow chains
+// of spilled records and the free-space index saved by Close. The heap file
+// must not be used afterwards
+func (h *HeapFile) Drop() error {
+	h.mutex.Lock()
+	defer h.mutex.Unlock()
+
+	pageIDs, overflows, err := h.ownedPages()
+	if err != nil {
+		return &PagerError{
+			Op:  "HeapDrop",
+			Err: fmt.Errorf("unable to read heap file: %w", err),
+		}
+	}
+
+	for _, locator := range overflows {
+		if err := freeOverflow(h.pager, locator); err != nil {
+			return err
+		}
+	}
+	for _, pageID := range pageIDs {
+		if err := h.pager.DeallocatePage(pageID); err != nil {
+			return err
+		}
+	}
+	h.freeSpace = newFreeSpaceIndex()
+	h.indexPageID = 0
+	return nil
+}
+
+// ownedPages returns the data pages of the heap file and the pages of its
+// saved free-space index, along with the locators of the overflow chains its
+// records spilled into; the caller must hold h.mutex
+func (h *HeapFile) ownedPages() ([]PageID, []LOBLocator, error) {
+	var pageIDs []PageID
+	var overflows []LOBLocator
+	err := h.pager.WalkFrom(h.headPageID, func(page *Page) error {
+		pageIDs = append(pageIDs, page.Header.PageID)
+		for slot := uint16(0); uint32(slot) < page.Header.RecordCount; slot++ {
+			flags, err := page.recordFlags(slot)
+			if err != nil || flags&slotFlagOverflow == 0 {
+				continue
+			}
+			data, _ := page.Record(slot)
+			locator, err := DecodeLOBLocator(data)
+			if err != nil {
+				return err
+			}
+			overflows = append(overflows, locator)
+		}
+		return nil
+	})
+	if h.indexPageID != 0 && err == nil {
+		err = h.pager.WalkFrom(h.indexPageID, func(page *Page) error {
+			pageIDs = append(pageIDs, page.Header.PageID)
+			return nil
+		})
+	}
+	return pageIDs, overflows, err
+}
+
+// ownsPage reports whether pageID is one of the pages the heap file uses: a
+// data page, a page of its saved free-space index or a page of an overflow
+// chain
+func (h *HeapFile) ownsPage(pageID PageID) (bool, error) {
+	h.mutex.Lock()
+	defer h.mutex.Unlock()
+
+	pageIDs, overflows, err := h.ownedPages()
+	if err != nil {
+		return false, err
+	}
+	if slices.Contains(pageIDs, pageID) {
+		return true, nil
+	}
+	errOwned := errors.New("page is owned")
+	for _, locator := range overflows {
+		err := h.pager.WalkFrom(locator.FirstPageID, func(page *Page) error {
+			if page.Header.PageID == pageID {
+				return errOwned
+			}
+			return nil
+		})
+		if errors.Is(err, errOwned) {
+			return true, nil
+		}
+		if err != nil {
+			return false, err
+		}
+	}
+	return false, nil
+}
+
+// FindPageForInsert returns a page of the heap file with room for a record of
+// size bytes, chosen by the heap's InsertStrategy, without reading any pages
+func (h *HeapFile) FindPageForInsert(size uint32) (PageID, bool) {
+	h.mutex.Lock()
+	defer h.mutex.Unlock()
+	return h.findPage(size + slotSize)
+}
+
+// findPage returns a page with need free bytes according to h.strategy; the
+// caller must hold h.mutex
+func (h *HeapFile) findPage(need uint32) (PageID, bool) {
+	switch h.strategy {
+	case InsertBestFit:
+		return h.freeSpace.bestFit(need)
+	case InsertAppendOnly:
+		if h.freeSpace.free[h.tailPageID] >= need {
+			return h.tailPageID, true
+		}
+		return 0, false
+	default:
+		return h.freeSpace.find(need)
+	}
+}
+
+// AppendPage allocates a new data page and links it onto the end of the chain
+func (h *HeapFile) AppendPage() (*Page, error) {
+	h.mutex.Lock()
+	defer h.mutex.Unlock()
+	return h.appendPage()
+}
+
+// appendPage is AppendPage without locking; the caller must hold h.mutex
+func (h *HeapFile) appendPage() (*Page, error) {
+	page, err := h.pager.AllocatePage(PageTypeData)
+	if err != nil {
+		return nil, &PagerError{
+			Op:  "AppendPage",
+			Err: fmt.Errorf("unable to allocate page: %w", err),
+		}
+	}
+
+	// Read the tail after allocating so the allocation cannot evict it
+	tail, err := h.pager.ReadPage(h.tailPageID)
+	if err != nil {
+		return nil, &PagerError{
+			Op:  "AppendPage",
+			Err: fmt.Errorf("unable to read tail page %d: %w", h.tailPageID, err),
+		}
+	}
+	LinkPages(tail, page)
+
+	if err := h.pager.WritePage(tail); err != nil {
+		return nil, err
+	}
+	if err := h.pager.WritePage(page); err != nil {
+		return nil, err
+	}
+	h.tailPageID = page.Header.PageID
+	h.freeSpace.update(page.Header.PageID, page.Header.FreeSpace)
+	return page, nil
+}
+
+// Insert stores a record on a page with enough room, appending a new page to
+// the chain when none has space, and returns the record's RID
+func (h *HeapFile) Insert(data []byte) (RID, error) {
+	h.mutex.Lock()
+	defer h.mutex.Unlock()
+
+	stored, flags, err := h.encodeRecord(data)
+	if err != nil {
+		return RID{}, err
+	}
+	if len(stored) > MaxRecordSize {
+		return RID{}, &PagerError{
+			Op:  "HeapInsert",
+			Err: fmt.Errorf("record of %d bytes exceeds maximum of %d", len(stored), MaxRecordSize),
+		}
+	}
+	return h.insert(data, stored, flags)
+}
+
+// InsertRecordAnywhere stores a record of any size, placing it like Insert.
+// A record too large for a data page is written to an overflow chain and the
+// data page keeps a small stub in its place; Get, Scan and Delete follow the
+// stub transparently
+func (h *HeapFile) InsertRecordAnywhere(data []byte) (RID, error) {
+	h.mutex.Lock()
+	defer h.mutex.Unlock()
+
+	stored, flags, err := h.encodeRecord(data)
+	if err != nil {
+		return RID{}, err
+	}
+	if len(stored) <= MaxRecordSize {
+		return h.insert(data, stored, flags)
+	}
+	stub, err := writeOverflow(h.pager, stored)
+	if err != nil {
+		return RID{}, &PagerError{
+			Op:  "HeapInsert",
+			Err: fmt.Errorf("unable to write overflow chain: %w", err),
+		}
+	}
+	rid, err := h.insert(data, stub.Encode(), flags|slotFlagOverflow)
+	if err != nil {
+		// Best effort: the chain is unreachable without its stub
+		freeOverflow(h.pager, stub)
+		return RID{}, err
+	}
+	return rid, nil
+}
+
+// SetRecordCompression makes later inserts compress records longer than
+// threshold bytes with codec, for values such as text that compress well even
+// when their page as a whole is not worth compressing. Records that would not
+// shrink are stored as they are. CompressionNone turns it off again
+func (h *HeapFile) SetRecordCompression(codec Compression, threshold int) {
+	h.mutex.Lock()
+	defer h.mutex.Unlock()
+	h.recordCodec = codec
+	h.compressAbove = threshold
+}
+
+// SetKeyFilter makes later inserts keep a key filter over the records of the
+// pages they place records on, so Lookup can skip pages that cannot hold the
+// record it is after. A page that already has a filter keeps it up to date
+// whatever the setting
+func (h *HeapFile) SetKeyFilter(enabled bool) {
+	h.mutex.Lock()
+	defer h.mutex.Unlock()
+	h.keyFilter = enabled
+}
+
+// rebuildKeyFilter builds page's key filter afresh from the records it holds.
+// If a record cannot be read the page is left without a filter, which only
+// costs lookups a scan of the page
+func rebuildKeyFilter(pager *Pager, page *Page) {
+	page.ResetKeyFilter()
+	for slot := uint16(0); uint32(slot) < page.Header.RecordCount; slot++ {
+		data, err := readRecord(pager, page, slot)
+		if errors.Is(err, ErrRecordNotFound) {
+			continue
+		}
+		if err != nil {
+			page.dropKeyFilter()
+			return
+		}
+		page.AddKey(data)
+	}
+}
+
+// encodeRecord returns the bytes to store for data and the slot flags
+// describing them; the caller must hold h.mutex
+func (h *HeapFile) encodeRecord(data []byte) ([]byte, uint16, error) {
+	if h.recordCodec == CompressionNone || len(data) <= h.compressAbove {
+		return data, 0, nil
+	}
+	stored, ok, err := compressRecord(data, h.recordCodec)
+	if err != nil {
+		return nil, 0, &PagerError{
+			Op:  "HeapInsert",
+			Err: fmt.Errorf("unable to compress record: %w", err),
+		}
+	}
+	if !ok {
+		stored = data
+	}
+	recordCompression(h.pager.metrics, MetricRecordUncompressedBytes, MetricRecordCompressedBytes,
+		MetricRecordCompressionSkipped, len(data), len(stored))
+	if !ok {
+		return data, 0, nil
+	}
+	return stored, slotFlagCompressed, nil
+}
+
+// insert stores the encoded bytes of record with the given slot flags; the
+// caller must hold h.mutex
+func (h *HeapFile) insert(record []byte, data []byte, flags uint16) (RID, error) {
+	for {
+		pageID, ok := h.findPage(uint32(len(data) + slotSize))
+		if !ok {
+			page, err := h.appendPage()
+			if err != nil {
+				return RID{}, err
+			}
+			pageID = page.Header.PageID
+		}
+
+		page, err := h.pager.ReadPage(pageID)
+		if err != nil {
+			return RID{}, &PagerError{
+				Op:  "HeapInsert",
+				Err: fmt.Errorf("unable to read page %d: %w", pageID, err),
+			}
+		}
+		filtered := page.HasKeyFilter()
+		slot, err := page.insertRecord(data, flags)
+		if errors.Is(err, ErrPageFull) && ok {
+			// The index entry was stale; correct it and look again
+			h.freeSpace.update(pageID, page.Header.FreeSpace)
+			continue
+		}
+		if err != nil {
+			return RID{}, &PagerError{
+				Op:  "HeapInsert",
+				Err: fmt.Errorf("unable to insert into page %d: %w", pageID, err),
+			}
+		}
+		if filtered {
+			page.AddKey(record)
+		} else if h.keyFilter {
+			rebuildKeyFilter(h.pager, page)
+		}
+		if err := h.pager.WritePage(page); err != nil {
+			return RID{}, err
+		}
+		h.freeSpace.update(pageID, page.Header.FreeSpace)
+		return RID{PageID: pageID, Slot: slot}, nil
+	}
+}
+
+// Get returns a copy of the record identified by rid
+func (h *HeapFile) Get(rid RID) ([]byte, error) {
+	h.mutex.Lock()
+	defer h.mutex.Unlock()
+
+	if !h.freeSpace.contains(rid.PageID) {
+		return nil, &PagerError{
+			Op:  "HeapGet",
+			Err: fmt.Errorf("page %d is not part of this heap file", rid.PageID),
+		}
+	}
+	page, err := h.pager.ReadPage(rid.PageID)
+	if err != nil {
+		return nil, &PagerError{
+			Op:  "HeapGet",
+			Err: fmt.Errorf("unable to read page %d: %w", rid.PageID, err),
+		}
+	}
+	data, err := readRecord(h.pager, page, rid.Slot)
+	if err != nil {
+		return nil, &PagerError{
+			Op:  "HeapGet",
+			Err: fmt.Errorf("unable to read record %v: %w", rid, err),
+		}
+	}
+	return data, nil
+}
+
+// readRecord returns a copy of the record in a slot of page, following its
+// overflow chain if it spilled and decompressing it if it was compressed
+func readRecord(pager *Pager, page *Page, slot uint16) ([]byte, error) {
+	data, err := page.Record(slot)
+	if err != nil {
+		return nil, err
+	}
+	flags, _ := page.recordFlags(slot)
+	if flags&slotFlagOverflow != 0 {
+		stub, err := DecodeLOBLocator(data)
+		if err != nil {
+			return nil, err
+		}
+		if data, err = readOverflow(pager, stub); err != nil {
+			return nil, err
+		}
+	}
+	if flags&slotFlagCompressed != 0 {
+		return decompressRecord(data)
+	}
+	if flags&slotFlagOverflow != 0 {
+		return data, nil
+	}
+	return append([]byte(nil), data...), nil
+}
+
+// Delete tombstones the record identified by rid
+func (h *HeapFile) Delete(rid RID) error {
+	h.mutex.Lock()
+	defer h.mutex.Unlock()
+
+	if !h.freeSpace.contains(rid.PageID) {
+		return &PagerError{
+			Op:  "HeapDelete",
+			Err: fmt.Errorf("page %d is not part of this heap file", rid.PageID),
+		}
+	}
+	page, err := h.pager.ReadPage(rid.PageID)
+	if err != nil {
+		return &PagerError{
+			Op:  "HeapDelete",
+			Err: fmt.Errorf("unable to read page %d: %w", rid.PageID, err),
+		}
+	}
+	// Read the stub before the record is tombstoned
+	var stub *LOBLocator
+	if flags, err := page.recordFlags(rid.Slot); err == nil && flags&slotFlagOverflow != 0 {
+		data, _ := page.Record(rid.Slot)
+		decoded, err := DecodeLOBLocator(data)
+		if err != nil {
+			return &PagerError{
+				Op:  "HeapDelete",
+				Err: fmt.Errorf("unable to read record %v: %w", rid, err),
+			}
+		}
+		stub = &decoded
+	}
+	filtered := page.HasKeyFilter()
+	if err := page.DeleteRecord(rid.Slot); err != nil {
+		return &PagerError{
+			Op:  "HeapDelete",
+			Err: fmt.Errorf("unable to delete record %v: %w", rid, err),
+		}
+	}
+	// A Bloom filter cannot forget a key, so the filter is built again from
+	// the records left
+	if filtered {
+		rebuildKeyFilter(h.pager, page)
+	}
+	if err := h.pager.WritePage(page); err != nil {
+		return err
+	}
+	h.freeSpace.update(rid.PageID, page.Header.FreeSpace)
+	if stub != nil {
+		if err := freeOverflow(h.pager, *stub); err != nil {
+			return &PagerError{
+				Op:  "HeapDelete",
+				Err: fmt.Errorf("unable to free overflow chain of record %v: %w", rid, err),
+			}
+		}
+	}
+	return nil
+}
+
+// Lookup returns the RID of a record equal to data, or ErrRecordNotFound.
+// Pages whose key filter rules data out are passed over without reading
+// their bodies; the rest are scanned
+func (h *HeapFile) Lookup(data []byte) (RID, error) {
+	h.mutex.Lock()
+	defer h.mutex.Unlock()
+
+	for _, pageID := range slices.Sorted(maps.Keys(h.freeSpace.free)) {
+		ok, err := h.pager.MayContainKey(pageID, data)
+		if err != nil {
+			return RID{}, &PagerError{
+				Op:  "HeapLookup",
+				Err: fmt.Errorf("unable to check key filter of page %d: %w", pageID, err),
+			}
+		}
+		if !ok {
+			continue
+		}
+		page, err := h.pager.ReadPage(pageID)
+		if err != nil {
+			return RID{}, &PagerError{
+				Op:  "HeapLookup",
+				Err: fmt.Errorf("unable to read page %d: %w", pageID, err),
+			}
+		}
+		for slot := uint16(0); uint32(slot) < page.Header.RecordCount; slot++ {
+			record, err := readRecord(h.pager, page, slot)
+			if errors.Is(err, ErrRecordNotFound) {
+				continue
+			}
+			if err != nil {
+				return RID{}, &PagerError{
+					Op:  "HeapLookup",
+					Err: fmt.Errorf("unable to read record %d on page %d: %w", slot, pageID, err),
+				}
+			}
+			if bytes.Equal(record, data) {
+				return RID{PageID: pageID, Slot: slot}, nil
+			}
+		}
+	}
+	return RID{}, ErrRecordNotFound
+}
+
+// Scan returns an iterator over every live record in the heap file
+func (h *HeapFile) Scan() iter.Seq2[HeapRecord, error] {
+	return HeapScan(h.pager, h.headPageID)
+}
+
+// HeapRecord is a record yielded while scanning a heap
+type HeapRecord struct {
+	RID  RID
+	Data []byte
+}
+
+// HeapScan returns an iterator over every live record in the chain of data
+// pages starting at firstPageID, following NextPageID until it reaches 0.
+// Records are yielded in page order and slot order within a page, with
+// spilled records read back from their overflow chains. If a page cannot be
+// read the iterator yields the error and stops
+func HeapScan(pager *Pager, firstPageID PageID) iter.Seq2[HeapRecord, error] {
+	return func(yield func(HeapRecord, error) bool) {
+		visited := make(map[PageID]bool)
+		for pageID := firstPageID; pageID != 0; {
+			if visited[pageID] {
+				yield(HeapRecord{}, &PagerError{
+					Op:  "HeapScan",
+					Err: fmt.Errorf("cycle in page chain at page %d", pageID),
+				})
+				return
+			}
+			visited[pageID] = true
+
+			page, err := pager.ReadPage(pageID)
+			if err != nil {
+				yield(HeapRecord{}, &PagerError{
+					Op:  "HeapScan",
+					Err: fmt.Errorf("unable to read page %d: %w", pageID, err),
+				})
+				return
+			}
+
+			// Copy out the records before yielding so the caller never holds
+			// a slice into a cached page body
+			var records []HeapRecord
+			for slot := uint16(0); uint32(slot) < page.Header.RecordCount; slot++ {
+				data, err := readRecord(pager, page, slot)
+				if errors.Is(err, ErrRecordNotFound) {
+					continue
+				}
+				if err != nil {
+					yield(HeapRecord{}, &PagerError{
+						Op:  "HeapScan",
+						Err: fmt.Errorf("unable to read record %d on page %d: %w", slot, pageID, err),
+					})
+					return
+				}
+				records = append(records, HeapRecord{
+					RID:  RID{PageID: pageID, Slot: slot},
+					Data: data,
+				})
+			}
+			next := page.Header.NextPageID
+
+			for _, record := range records {
+				if !yield(record, nil) {
+					return
+				}
+			}
+			pageID = next
+		}
+	}
+}
@@ -0,0 +1,515 @@
+package engine
+
+import (
+	"bytes"
+	"slices"
+	"testing"
+)
+
+func TestHeapScanThreePageChain(t *testing.T) {
+	pager := newTestPager(t)
+
+	var chain []*Page
+	for i := 0; i < 3; i++ {
+		page, err := pager.AllocatePage(PageTypeData)
+		if err != nil {
+			t.Fatalf(`AllocatePage() got %q wanted nil`, err)
+		}
+		chain = append(chain, page)
+	}
+	chain[0].Header.NextPageID = chain[1].Header.PageID
+	chain[1].Header.PrevPageID = chain[0].Header.PageID
+	chain[1].Header.NextPageID = chain[2].Header.PageID
+	chain[2].Header.PrevPageID = chain[1].Header.PageID
+
+	// The middle page is left empty
+	want := []string{"alpha", "beta", "gamma", "delta", "epsilon"}
+	for i, value := range want {
+		page := chain[0]
+		if i >= 3 {
+			page = chain[2]
+		}
+		if _, err := page.InsertRecord([]byte(value)); err != nil {
+			t.Fatalf(`InsertRecord(%q) got %q wanted nil`, value, err)
+		}
+	}
+	for _, page := range chain {
+		if err := pager.WritePage(page); err != nil {
+			t.Fatalf(`WritePage() got %q wanted nil`, err)
+		}
+	}
+
+	var got []string
+	for record, err := range HeapScan(pager, chain[0].Header.PageID) {
+		if err != nil {
+			t.Fatalf(`HeapScan() yielded %q wanted nil`, err)
+		}
+		got = append(got, string(record.Data))
+	}
+	if len(got) != len(want) {
+		t.Fatalf(`HeapScan() returned %d records; want %d`, len(got), len(want))
+	}
+	for i := range want {
+		if got[i] != want[i] {
+			t.Errorf(`record %d = %q; want %q`, i, got[i], want[i])
+		}
+	}
+
+	for record := range HeapScan(pager, chain[0].Header.PageID) {
+		if record.RID != (RID{PageID: chain[0].Header.PageID, Slot: 0}) {
+			t.Errorf(`first RID = %v; want (%d:0)`, record.RID, chain[0].Header.PageID)
+		}
+		break
+	}
+}
+
+func TestHeapScanReportsCycle(t *testing.T) {
+	pager := newTestPager(t)
+
+	page, err := pager.AllocatePage(PageTypeData)
+	if err != nil {
+		t.Fatalf(`AllocatePage() got %q wanted nil`, err)
+	}
+	page.Header.NextPageID = page.Header.PageID
+
+	var scanErr error
+	for _, err := range HeapScan(pager, page.Header.PageID) {
+		scanErr = err
+	}
+	if scanErr == nil {
+		t.Errorf(`HeapScan() over a cyclic chain got nil wanted error`)
+	}
+}
+
+func TestHeapFileSpansMultiplePages(t *testing.T) {
+	pager := newTestPager(t)
+
+	heap, err := NewHeapFile(pager)
+	if err != nil {
+		t.Fatalf(`NewHeapFile() got %q wanted nil`, err)
+	}
+
+	pageIDs := []PageID{heap.HeadPageID()}
+	for i := 0; i < 3; i++ {
+		page, err := heap.AppendPage()
+		if err != nil {
+			t.Fatalf(`AppendPage() got %q wanted nil`, err)
+		}
+		pageIDs = append(pageIDs, page.Header.PageID)
+	}
+
+	for i, pageID := range pageIDs {
+		page, err := pager.ReadPage(pageID)
+		if err != nil {
+			t.Fatalf(`ReadPage(%d) got %q wanted nil`, pageID, err)
+		}
+		var wantPrev, wantNext PageID
+		if i > 0 {
+			wantPrev = pageIDs[i-1]
+		}
+		if i < len(pageIDs)-1 {
+			wantNext = pageIDs[i+1]
+		}
+		if page.Header.PrevPageID != wantPrev || page.Header.NextPageID != wantNext {
+			t.Errorf(`page %d links = (prev %d, next %d); want (prev %d, next %d)`,
+				pageID, page.Header.PrevPageID, page.Header.NextPageID, wantPrev, wantNext)
+		}
+		if _, err := page.InsertRecord([]byte{byte(i)}); err != nil {
+			t.Fatalf(`InsertRecord() got %q wanted nil`, err)
+		}
+		if err := pager.WritePage(page); err != nil {
+			t.Fatalf(`WritePage() got %q wanted nil`, err)
+		}
+	}
+
+	reopened, err := OpenHeapFile(pager, heap.HeadPageID())
+	if err != nil {
+		t.Fatalf(`OpenHeapFile() got %q wanted nil`, err)
+	}
+	var got []byte
+	for record, err := range reopened.Scan() {
+		if err != nil {
+			t.Fatalf(`Scan() yielded %q wanted nil`, err)
+		}
+		got = append(got, record.Data...)
+	}
+	if string(got) != string([]byte{0, 1, 2, 3}) {
+		t.Errorf(`Scan() = %v; want [0 1 2 3]`, got)
+	}
+	if reopened.tailPageID != pageIDs[len(pageIDs)-1] {
+		t.Errorf(`reopened tail = %d; want %d`, reopened.tailPageID, pageIDs[len(pageIDs)-1])
+	}
+}
+
+func TestHeapFileInsertAndDelete(t *testing.T) {
+	pager := newTestPager(t)
+
+	heap, err := NewHeapFile(pager)
+	if err != nil {
+		t.Fatalf(`NewHeapFile() got %q wanted nil`, err)
+	}
+
+	// Three records of this size cannot share a page, so six fill three pages
+	record := make([]byte, MaxBodySize/3)
+	var rids []RID
+	for i := 0; i < 6; i++ {
+		record[0] = byte(i)
+		rid, err := heap.Insert(record)
+		if err != nil {
+			t.Fatalf(`Insert() got %q wanted nil`, err)
+		}
+		rids = append(rids, rid)
+	}
+
+	pages := make(map[PageID]bool)
+	for _, rid := range rids {
+		pages[rid.PageID] = true
+	}
+	if len(pages) != 3 {
+		t.Errorf(`records landed on %d pages; want 3`, len(pages))
+	}
+
+	if err := heap.Delete(rids[1]); err != nil {
+		t.Fatalf(`Delete(%v) got %q wanted nil`, rids[1], err)
+	}
+	if _, err := heap.Get(rids[1]); err == nil {
+		t.Errorf(`Get(%v) after delete got nil wanted error`, rids[1])
+	}
+	if err := heap.Delete(rids[1]); err == nil {
+		t.Errorf(`Delete(%v) twice got nil wanted error`, rids[1])
+	}
+
+	var seen []byte
+	for record, err := range heap.Scan() {
+		if err != nil {
+			t.Fatalf(`Scan() yielded %q wanted nil`, err)
+		}
+		seen = append(seen, record.Data[0])
+	}
+	if len(seen) != 5 {
+		t.Errorf(`Scan() after delete returned %d records; want 5`, len(seen))
+	}
+
+	// The freed space is reused by the next insert
+	rid, err := heap.Insert(record)
+	if err != nil {
+		t.Fatalf(`Insert() got %q wanted nil`, err)
+	}
+	if rid.PageID != rids[1].PageID {
+		t.Errorf(`Insert() after delete went to page %d; want reuse of page %d`, rid.PageID, rids[1].PageID)
+	}
+}
+
+func TestHeapInsertReadsOnePage(t *testing.T) {
+	pager := newTestPager(t)
+
+	heap, err := NewHeapFile(pager)
+	if err != nil {
+		t.Fatalf(`NewHeapFile() got %q wanted nil`, err)
+	}
+
+	// Fill 50 pages, leaving each with a different amount of room
+	for i := 0; i < 50; i++ {
+		if _, err := heap.Insert(make([]byte, MaxRecordSize-100-i*64)); err != nil {
+			t.Fatalf(`Insert() got %q wanted nil`, err)
+		}
+	}
+
+	for _, size := range []int{10, 500, 1500, 3000} {
+		before := pager.Stats()
+		rid, err := heap.Insert(make([]byte, size))
+		if err != nil {
+			t.Fatalf(`Insert(%d bytes) got %q wanted nil`, size, err)
+		}
+		after := pager.Stats()
+
+		// Any scan of the chain would read far more than the page written to
+		// and, when nothing has room, the tail it is linked from
+		if reads := after.CacheHits + after.CacheMisses - before.CacheHits - before.CacheMisses; reads > 2 {
+			t.Errorf(`Insert(%d bytes) read %d pages; want at most 2`, size, reads)
+		}
+		if _, err := heap.Get(rid); err != nil {
+			t.Errorf(`Get(%v) got %q wanted nil`, rid, err)
+		}
+	}
+}
+
+func TestFindPageForInsert(t *testing.T) {
+	pager := newTestPager(t)
+
+	heap, err := NewHeapFile(pager)
+	if err != nil {
+		t.Fatalf(`NewHeapFile() got %q wanted nil`, err)
+	}
+	if _, err := heap.Insert(make([]byte, MaxRecordSize-1000)); err != nil {
+		t.Fatalf(`Insert() got %q wanted nil`, err)
+	}
+
+	pageID, ok := heap.FindPageForInsert(500)
+	if !ok || pageID != heap.HeadPageID() {
+		t.Errorf(`FindPageForInsert(500) = (%d, %v); want (%d, true)`, pageID, ok, heap.HeadPageID())
+	}
+	if pageID, ok := heap.FindPageForInsert(2000); ok {
+		t.Errorf(`FindPageForInsert(2000) = (%d, true); want no page`, pageID)
+	}
+
+	rid, err := heap.Insert(make([]byte, 2000))
+	if err != nil {
+		t.Fatalf(`Insert() got %q wanted nil`, err)
+	}
+	if rid.PageID == heap.HeadPageID() {
+		t.Errorf(`Insert(2000 bytes) went to the full head page`)
+	}
+	page, err := pager.ReadPage(rid.PageID)
+	if err != nil {
+		t.Fatalf(`ReadPage(%d) got %q wanted nil`, rid.PageID, err)
+	}
+	if pageID, ok := heap.FindPageForInsert(page.Header.FreeSpace - slotSize); !ok || pageID != rid.PageID {
+		t.Errorf(`FindPageForInsert(%d) = (%d, %v); want (%d, true)`,
+			page.Header.FreeSpace-slotSize, pageID, ok, rid.PageID)
+	}
+}
+
+func TestHeapFileCloseSavesFreeSpaceIndex(t *testing.T) {
+	pager := newTestPager(t)
+
+	heap, err := NewHeapFile(pager)
+	if err != nil {
+		t.Fatalf(`NewHeapFile() got %q wanted nil`, err)
+	}
+	record := make([]byte, MaxBodySize/3)
+	for i := 0; i < 5; i++ {
+		if _, err := heap.Insert(record); err != nil {
+			t.Fatalf(`Insert() got %q wanted nil`, err)
+		}
+	}
+	if err := heap.Close(); err != nil {
+		t.Fatalf(`Close() got %q wanted nil`, err)
+	}
+	if heap.IndexPageID() == 0 {
+		t.Fatalf(`IndexPageID() after Close() = 0`)
+	}
+
+	// A page appended after the index was saved is found from the saved tail
+	appended, err := heap.AppendPage()
+	if err != nil {
+		t.Fatalf(`AppendPage() got %q wanted nil`, err)
+	}
+
+	reopened, err := OpenHeapFileWithIndex(pager, heap.HeadPageID(), heap.IndexPageID())
+	if err != nil {
+		t.Fatalf(`OpenHeapFileWithIndex() got %q wanted nil`, err)
+	}
+	if reopened.tailPageID != appended.Header.PageID {
+		t.Errorf(`reopened tail = %d; want %d`, reopened.tailPageID, appended.Header.PageID)
+	}
+	for pageID, free := range heap.freeSpace.free {
+		if got := reopened.freeSpace.free[pageID]; got != free {
+			t.Errorf(`reopened free space of page %d = %d; want %d`, pageID, got, free)
+		}
+	}
+
+	// Closing again replaces the saved index instead of leaking its pages
+	before, err := pager.Stat()
+	if err != nil {
+		t.Fatalf(`Stat() got %q wanted nil`, err)
+	}
+	if err := reopened.Close(); err != nil {
+		t.Fatalf(`Close() got %q wanted nil`, err)
+	}
+	after, err := pager.Stat()
+	if err != nil {
+		t.Fatalf(`Stat() got %q wanted nil`, err)
+	}
+	if after.PageCount != before.PageCount {
+		t.Errorf(`page count after second Close() = %d; want %d`, after.PageCount, before.PageCount)
+	}
+}
+
+func TestInsertRecordAnywhereMixedSizes(t *testing.T) {
+	pager := newTestPager(t)
+
+	heap, err := NewHeapFile(pager)
+	if err != nil {
+		t.Fatalf(`NewHeapFile() got %q wanted nil`, err)
+	}
+
+	sizes := []int{0, 1, 100, MaxRecordSize, MaxRecordSize + 1, 3 * MaxBodySize, 700, 2 * overflowChunkSize, 50}
+	records := make(map[RID][]byte)
+	for i, size := range sizes {
+		data := make([]byte, size)
+		for j := range data {
+			data[j] = byte(i + j)
+		}
+		rid, err := heap.InsertRecordAnywhere(data)
+		if err != nil {
+			t.Fatalf(`InsertRecordAnywhere(%d bytes) got %q wanted nil`, size, err)
+		}
+		records[rid] = data
+	}
+
+	for rid, want := range records {
+		got, err := heap.Get(rid)
+		if err != nil {
+			t.Fatalf(`Get(%v) got %q wanted nil`, rid, err)
+		}
+		if !bytes.Equal(got, want) {
+			t.Errorf(`Get(%v) returned %d bytes; want the %d inserted`, rid, len(got), len(want))
+		}
+	}
+
+	scanned := 0
+	for record, err := range heap.Scan() {
+		if err != nil {
+			t.Fatalf(`Scan() yielded %q wanted nil`, err)
+		}
+		if !bytes.Equal(record.Data, records[record.RID]) {
+			t.Errorf(`Scan() record %v does not match what was inserted`, record.RID)
+		}
+		scanned++
+	}
+	if scanned != len(records) {
+		t.Errorf(`Scan() returned %d records; want %d`, scanned, len(records))
+	}
+
+	// Deleting a spilled record frees its overflow chain
+	var spilled RID
+	for rid, data := range records {
+		if len(data) == 3*MaxBodySize {
+			spilled = rid
+		}
+	}
+	before, err := pager.FreePages()
+	if err != nil {
+		t.Fatalf(`FreePages() got %q wanted nil`, err)
+	}
+	if err := heap.Delete(spilled); err != nil {
+		t.Fatalf(`Delete(%v) got %q wanted nil`, spilled, err)
+	}
+	after, err := pager.FreePages()
+	if err != nil {
+		t.Fatalf(`FreePages() got %q wanted nil`, err)
+	}
+	if len(after)-len(before) != 4 {
+		t.Errorf(`Delete() of a spilled record freed %d pages; want 4`, len(after)-len(before))
+	}
+}
+
+func TestInsertStrategies(t *testing.T) {
+	// Every case starts from four pages with this much free space each
+	frees := []uint32{1000, 3000, 600, 2000}
+	tests := []struct {
+		strategy InsertStrategy
+		size     int
+		// want is the index into frees of the page the record should land
+		// on, or -1 for a newly appended page
+		want int
+	}{
+		{InsertFirstFit, 2500, 1},
+		{InsertBestFit, 500, 2},
+		{InsertBestFit, 900, 0},
+		{InsertBestFit, 1200, 3},
+		{InsertAppendOnly, 500, 3},
+		{InsertAppendOnly, 2500, -1},
+	}
+
+	for _, test := range tests {
+		pager := newTestPager(t)
+		heap, err := NewHeapFile(pager)
+		if err != nil {
+			t.Fatalf(`NewHeapFile() got %q wanted nil`, err)
+		}
+		pageIDs := []PageID{heap.HeadPageID()}
+		for range frees[1:] {
+			page, err := heap.AppendPage()
+			if err != nil {
+				t.Fatalf(`AppendPage() got %q wanted nil`, err)
+			}
+			pageIDs = append(pageIDs, page.Header.PageID)
+		}
+		for i, free := range frees {
+			page, err := pager.ReadPage(pageIDs[i])
+			if err != nil {
+				t.Fatalf(`ReadPage(%d) got %q wanted nil`, pageIDs[i], err)
+			}
+			if _, err := page.InsertRecord(make([]byte, MaxBodySize-free-slotSize)); err != nil {
+				t.Fatalf(`InsertRecord() got %q wanted nil`, err)
+			}
+			if err := pager.WritePage(page); err != nil {
+				t.Fatalf(`WritePage() got %q wanted nil`, err)
+			}
+		}
+		heap, err = OpenHeapFile(pager, heap.HeadPageID())
+		if err != nil {
+			t.Fatalf(`OpenHeapFile() got %q wanted nil`, err)
+		}
+		heap.SetInsertStrategy(test.strategy)
+
+		rid, err := heap.Insert(make([]byte, test.size))
+		if err != nil {
+			t.Fatalf(`%v: Insert(%d bytes) got %q wanted nil`, test.strategy, test.size, err)
+		}
+		if test.want < 0 {
+			if slices.Contains(pageIDs, rid.PageID) {
+				t.Errorf(`%v: Insert(%d bytes) went to page %d; want a new page`, test.strategy, test.size, rid.PageID)
+			}
+		} else if rid.PageID != pageIDs[test.want] {
+			t.Errorf(`%v: Insert(%d bytes) went to page %d; want page %d`,
+				test.strategy, test.size, rid.PageID, pageIDs[test.want])
+		}
+	}
+}
+
+func TestRecordCompression(t *testing.T) {
+	pager := newTestPager(t)
+
+	heap, err := NewHeapFile(pager)
+	if err != nil {
+		t.Fatalf(`NewHeapFile() got %q wanted nil`, err)
+	}
+	heap.SetRecordCompression(CompressionFlate, 256)
+
+	large := bytes.Repeat([]byte(`{"name":"gopher","tags":["db","go"]},`), 200)
+	small := bytes.Repeat([]byte("ab"), 50)
+	for _, data := range [][]byte{large, small} {
+		before, err := pager.ReadPage(heap.HeadPageID())
+		if err != nil {
+			t.Fatalf(`ReadPage() got %q wanted nil`, err)
+		}
+		freeBefore := before.Header.FreeSpace
+
+		// The large value is bigger than a page but compresses to fit on one
+		rid, err := heap.Insert(data)
+		if err != nil {
+			t.Fatalf(`Insert(%d bytes) got %q wanted nil`, len(data), err)
+		}
+		if rid.PageID != heap.HeadPageID() {
+			t.Fatalf(`Insert(%d bytes) went to page %d; want head page %d`, len(data), rid.PageID, heap.HeadPageID())
+		}
+
+		page, err := pager.ReadPage(rid.PageID)
+		if err != nil {
+			t.Fatalf(`ReadPage() got %q wanted nil`, err)
+		}
+		used := int(freeBefore-page.Header.FreeSpace) - slotSize
+		flags, err := page.recordFlags(rid.Slot)
+		if err != nil {
+			t.Fatalf(`recordFlags() got %q wanted nil`, err)
+		}
+		if len(data) > 256 {
+			if used >= len(data) || flags&slotFlagCompressed == 0 {
+				t.Errorf(`%d byte record stored %d bytes with flags %#x; want fewer, compressed`, len(data), used, flags)
+			}
+		} else if used != len(data) || flags != 0 {
+			t.Errorf(`%d byte record stored %d bytes with flags %#x; want it stored as is`, len(data), used, flags)
+		}
+
+		got, err := heap.Get(rid)
+		if err != nil {
+			t.Fatalf(`Get(%v) got %q wanted nil`, rid, err)
+		}
+		if !bytes.Equal(got, data) {
+			t.Errorf(`Get(%v) did not return the original %d byte record`, rid, len(data))
+		}
+	}
+}
@@ -0,0 +1,82 @@
+package engine
+
+import (
+	"maps"
+	"time"
+)
+
+// defaultAccessDecay is how often access counts halve when
+// PagerConfig.AccessDecay is not set
+const defaultAccessDecay = time.Minute
+
+// heatmap counts the reads and writes of each page. Counts halve every decay
+// period, so they reflect the recent workload rather than the whole life of
+// the pager. Decay is applied lazily, catching up on every period that has
+// passed whenever the heatmap is touched. It is only used with p.mutex held,
+// so counting an access costs a map increment under a lock the access
+// already takes
+type heatmap struct {
+	counts map[PageID]uint64
+	decay  time.Duration
+	// decayed is the end of the last decay period applied
+	decayed time.Time
+	now     func() time.Time
+}
+
+func newHeatmap(decay time.Duration) *heatmap {
+	if decay <= 0 {
+		decay = defaultAccessDecay
+	}
+	return &heatmap{
+		counts:  make(map[PageID]uint64),
+		decay:   decay,
+		decayed: time.Now(),
+		now:     time.Now,
+	}
+}
+
+// record counts one access to a page
+func (h *heatmap) record(pageID PageID) {
+	h.age()
+	h.counts[pageID]++
+}
+
+// age halves every count once for each decay period that has passed, and
+// forgets pages whose count reaches zero
+func (h *heatmap) age() {
+	periods := h.now().Sub(h.decayed) / h.decay
+	if periods <= 0 {
+		return
+	}
+	h.decayed = h.decayed.Add(periods * h.decay)
+	shift := min(uint64(periods), 63)
+	for pageID, count := range h.counts {
+		if count >>= shift; count == 0 {
+			delete(h.counts, pageID)
+		} else {
+			h.counts[pageID] = count
+		}
+	}
+}
+
+// recordHeat counts an access to a page when access tracking is enabled. The
+// caller must hold p.mutex
+func (p *Pager) recordHeat(pageID PageID) {
+	if p.heat != nil {
+		p.heat.record(pageID)
+	}
+}
+
+// Heatmap returns the decayed read and write count of every page accessed
+// recently, when PagerConfig.TrackAccess is set, and nil otherwise. Reads
+// count whether or not the cache served them
+func (p *Pager) Heatmap() map[PageID]uint64 {
+	p.mutex.Lock()
+	defer p.mutex.Unlock()
+
+	if p.heat == nil {
+		return nil
+	}
+	p.heat.age()
+	return maps.Clone(p.heat.counts)
+}
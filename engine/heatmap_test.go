@@ -0,0 +1,84 @@
+package engine
+
+import (
+	"testing"
+	"time"
+)
+
+func TestHeatmapFindsHotPage(t *testing.T) {
+	pager, err := NewMemoryPager(PagerConfig{MaxCacheSize: 100, TrackAccess: true})
+	if err != nil {
+		t.Fatalf(`NewMemoryPager() got %q wanted nil`, err)
+	}
+	defer pager.Close()
+
+	var pageIDs []PageID
+	for i := 0; i < 5; i++ {
+		page, err := pager.AllocatePage(PageTypeData)
+		if err != nil {
+			t.Fatalf(`AllocatePage() got %q wanted nil`, err)
+		}
+		pageIDs = append(pageIDs, page.Header.PageID)
+	}
+	hot := pageIDs[2]
+	for i := 0; i < 50; i++ {
+		if _, err := pager.ReadPage(hot); err != nil {
+			t.Fatalf(`ReadPage() got %q wanted nil`, err)
+		}
+	}
+	for _, pageID := range pageIDs {
+		page, err := pager.ReadPage(pageID)
+		if err != nil {
+			t.Fatalf(`ReadPage() got %q wanted nil`, err)
+		}
+		if err := pager.WritePage(page); err != nil {
+			t.Fatalf(`WritePage() got %q wanted nil`, err)
+		}
+	}
+
+	heat := pager.Heatmap()
+	if len(heat) != len(pageIDs) {
+		t.Errorf(`Heatmap() has %d pages; want %d`, len(heat), len(pageIDs))
+	}
+	for pageID, count := range heat {
+		if pageID != hot && count >= heat[hot] {
+			t.Errorf(`page %d has %d accesses, as many as hot page %d with %d`, pageID, count, hot, heat[hot])
+		}
+	}
+	// The allocation write, 51 reads and a write
+	if heat[hot] != 53 {
+		t.Errorf(`Heatmap()[%d] = %d; want 53`, hot, heat[hot])
+	}
+
+	untracked := newTestPager(t)
+	if heat := untracked.Heatmap(); heat != nil {
+		t.Errorf(`Heatmap() without TrackAccess = %v; want nil`, heat)
+	}
+}
+
+func TestHeatmapDecays(t *testing.T) {
+	now := time.Unix(0, 0)
+	heat := newHeatmap(time.Second)
+	heat.now = func() time.Time { return now }
+	heat.decayed = now
+
+	for i := 0; i < 8; i++ {
+		heat.record(1)
+	}
+	heat.record(2)
+
+	now = now.Add(time.Second)
+	heat.age()
+	if heat.counts[1] != 4 {
+		t.Errorf(`count after one period = %d; want 4`, heat.counts[1])
+	}
+	if _, ok := heat.counts[2]; ok {
+		t.Errorf(`page 2 is still in the heatmap after its count decayed to 0`)
+	}
+
+	now = now.Add(2500 * time.Millisecond)
+	heat.age()
+	if heat.counts[1] != 1 {
+		t.Errorf(`count after three periods = %d; want 1`, heat.counts[1])
+	}
+}
@@ -0,0 +1,471 @@
+package engine
+
+import (
+	"encoding/binary"
+	"fmt"
+	"io"
+)
+
+// Large objects (LOBs) are values too big for a data page, stored in a chain
+// of overflow pages linked through NextPageID. Each overflow page body starts
+// with the uint32 number of value bytes it holds, followed by those bytes. The
+// value is reached through a LOBLocator, which is small enough to keep in a
+// record; the heap stores one in the slot of a record it spilled, flagged with
+// slotFlagOverflow
+const (
+	overflowChunkSize = MaxBodySize - 4
+
+	// LOBLocatorSize is the length of an encoded LOBLocator
+	LOBLocatorSize = 12
+)
+
+// LOBLocator identifies a large object by the first page of its overflow chain
+// and its total length
+type LOBLocator struct {
+	FirstPageID PageID
+	Length      uint32
+}
+
+// Encode returns the LOBLocatorSize byte form of the locator, for storing in a
+// record
+func (locator LOBLocator) Encode() []byte {
+	buffer := make([]byte, LOBLocatorSize)
+	binary.LittleEndian.PutUint64(buffer, uint64(locator.FirstPageID))
+	binary.LittleEndian.PutUint32(buffer[8:], locator.Length)
+	return buffer
+}
+
+// DecodeLOBLocator parses a locator produced by Encode
+func DecodeLOBLocator(data []byte) (LOBLocator, error) {
+	if len(data) != LOBLocatorSize {
+		return LOBLocator{}, fmt.Errorf("LOB locator is %d bytes, expected %d", len(data), LOBLocatorSize)
+	}
+	return LOBLocator{
+		FirstPageID: PageID(binary.LittleEndian.Uint64(data)),
+		Length:      binary.LittleEndian.Uint32(data[8:]),
+	}, nil
+}
+
+// WriteLOB stores data in a new overflow chain and returns its locator
+func WriteLOB(pager *Pager, data []byte) (LOBLocator, error) {
+	if uint64(len(data)) > uint64(^uint32(0)) {
+		return LOBLocator{}, &PagerError{
+			Op:  "WriteLOB",
+			Err: fmt.Errorf("value of %d bytes exceeds maximum of %d", len(data), ^uint32(0)),
+		}
+	}
+	locator, err := writeOverflow(pager, data)
+	if err != nil {
+		return LOBLocator{}, &PagerError{
+			Op:  "WriteLOB",
+			Err: fmt.Errorf("unable to write overflow chain: %w", err),
+		}
+	}
+	return locator, nil
+}
+
+// ReadLOB returns the whole value locator points at
+func ReadLOB(pager *Pager, locator LOBLocator) ([]byte, error) {
+	data, err := readOverflow(pager, locator)
+	if err != nil {
+		return nil, &PagerError{
+			Op:  "ReadLOB",
+			Err: fmt.Errorf("unable to read LOB at page %d: %w", locator.FirstPageID, err),
+		}
+	}
+	return data, nil
+}
+
+// ReadLOBAt returns up to n bytes of the value locator points at, starting at
+// offset. Pages before offset are read for their links but not copied, and the
+// chain is not followed past the last byte wanted. A chain that ends early
+// returns ErrEndOfChain
+func ReadLOBAt(pager *Pager, locator LOBLocator, offset uint32, n uint32) ([]byte, error) {
+	if offset > locator.Length {
+		return nil, &PagerError{
+			Op:  "ReadLOB",
+			Err: fmt.Errorf("offset %d is past the end of a %d byte LOB", offset, locator.Length),
+		}
+	}
+	end := offset + min(n, locator.Length-offset)
+	data := make([]byte, 0, end-offset)
+
+	var position uint32
+	for pageID := locator.FirstPageID; position < end; {
+		page, err := pager.linkedPage("ReadLOB", pageID)
+		if err != nil {
+			return nil, err
+		}
+		chunk, err := overflowChunk(page)
+		if err == nil && len(chunk) == 0 {
+			err = fmt.Errorf("overflow page %d is empty", pageID)
+		}
+		if err != nil {
+			return nil, &PagerError{
+				Op:  "ReadLOB",
+				Err: fmt.Errorf("unable to read LOB at page %d: %w", locator.FirstPageID, err),
+			}
+		}
+		chunkEnd := position + uint32(len(chunk))
+		if chunkEnd > offset {
+			data = append(data, chunk[max(offset, position)-position:min(end, chunkEnd)-position]...)
+		}
+		position = chunkEnd
+		pageID = page.Header.NextPageID
+	}
+	return data, nil
+}
+
+// OpenLOBReader returns a reader that streams the value locator points at one
+// overflow page at a time. Only the page currently being read is pinned in
+// the cache, so a value of any size can be copied out without buffering it.
+// Close releases that pin
+func OpenLOBReader(pager *Pager, locator LOBLocator) io.ReadCloser {
+	return &lobReader{
+		pager:     pager,
+		locator:   locator,
+		next:      locator.FirstPageID,
+		remaining: locator.Length,
+	}
+}
+
+type lobReader struct {
+	pager   *Pager
+	locator LOBLocator
+	next    PageID
+	// pinned is the page chunk aliases, or 0 between pages
+	pinned    PageID
+	chunk     []byte
+	remaining uint32
+	closed    bool
+}
+
+func (r *lobReader) Read(buffer []byte) (int, error) {
+	if r.closed {
+		return 0, &PagerError{Op: "ReadLOB", Err: fmt.Errorf("read from closed LOB reader")}
+	}
+	if len(buffer) == 0 {
+		return 0, nil
+	}
+	for len(r.chunk) == 0 {
+		if err := r.unpin(); err != nil {
+			return 0, err
+		}
+		if r.remaining == 0 {
+			return 0, io.EOF
+		}
+		if err := r.advance(); err != nil {
+			return 0, err
+		}
+	}
+
+	n := copy(buffer, r.chunk)
+	r.chunk = r.chunk[n:]
+	r.remaining -= uint32(n)
+	return n, nil
+}
+
+// advance pins the next page of the chain and points chunk at its bytes
+func (r *lobReader) advance() error {
+	if r.next == 0 {
+		return &PagerError{
+			Op:  "ReadLOB",
+			Err: fmt.Errorf("LOB at page %d ends %d bytes short: %w", r.locator.FirstPageID, r.remaining, ErrEndOfChain),
+		}
+	}
+	page, err := r.pager.PinPage(r.next)
+	if err != nil {
+		return &PagerError{
+			Op:  "ReadLOB",
+			Err: fmt.Errorf("unable to read page %d: %w", r.next, err),
+		}
+	}
+	r.pinned = r.next
+
+	chunk, err := overflowChunk(page)
+	if err == nil && (len(chunk) == 0 || uint32(len(chunk)) > r.remaining) {
+		err = fmt.Errorf("overflow page %d holds %d bytes with %d left to read", r.next, len(chunk), r.remaining)
+	}
+	if err != nil {
+		return &PagerError{
+			Op:  "ReadLOB",
+			Err: fmt.Errorf("unable to read LOB at page %d: %w", r.locator.FirstPageID, err),
+		}
+	}
+	r.chunk = chunk
+	r.next = page.Header.NextPageID
+	return nil
+}
+
+func (r *lobReader) unpin() error {
+	if r.pinned == 0 {
+		return nil
+	}
+	pageID := r.pinned
+	r.pinned = 0
+	r.chunk = nil
+	return r.pager.UnpinPage(pageID)
+}
+
+// Close releases the page pinned by the reader
+func (r *lobReader) Close() error {
+	if r.closed {
+		return nil
+	}
+	r.closed = true
+	return r.unpin()
+}
+
+// LOBWriter streams a value into a new overflow chain as it is written,
+// allocating and linking pages as bytes arrive so the value never has to be
+// held in memory. Only the page being filled is pinned. The locator is
+// available from Locator once Close has written the last page
+type LOBWriter struct {
+	pager *Pager
+	wal   *WriteAheadLog
+	txnID uint64
+
+	locator LOBLocator
+	// page is the page being filled and fill the value bytes on it so far
+	page   *Page
+	fill   int
+	closed bool
+	err    error
+}
+
+// OpenLOBWriter returns a writer that stores a new LOB in pager
+func OpenLOBWriter(pager *Pager) *LOBWriter {
+	return &LOBWriter{pager: pager}
+}
+
+// OpenLoggedLOBWriter is OpenLOBWriter logging every page it writes to wal as
+// part of transaction txnID, so recovery redoes the value once the transaction
+// commits and undoes it otherwise. Configure the pager with the same log as
+// PagerConfig.WAL so pages never reach disk ahead of their log entries
+func OpenLoggedLOBWriter(pager *Pager, wal *WriteAheadLog, txnID uint64) *LOBWriter {
+	return &LOBWriter{pager: pager, wal: wal, txnID: txnID}
+}
+
+func (w *LOBWriter) Write(data []byte) (int, error) {
+	if w.closed {
+		return 0, &PagerError{Op: "WriteLOB", Err: fmt.Errorf("write to closed LOB writer")}
+	}
+	if w.err != nil {
+		return 0, w.err
+	}
+	if uint64(w.locator.Length)+uint64(len(data)) > uint64(^uint32(0)) {
+		w.err = &PagerError{
+			Op:  "WriteLOB",
+			Err: fmt.Errorf("value exceeds maximum of %d bytes", ^uint32(0)),
+		}
+		return 0, w.err
+	}
+
+	written := 0
+	for len(data) > 0 {
+		if w.page == nil || w.fill == overflowChunkSize {
+			if err := w.nextPage(); err != nil {
+				w.err = err
+				return written, err
+			}
+		}
+		n := copy(w.page.Body[4+w.fill:4+overflowChunkSize], data)
+		w.fill += n
+		w.locator.Length += uint32(n)
+		data = data[n:]
+		written += n
+	}
+	return written, nil
+}
+
+// nextPage allocates and pins a new page, linking it after the page being
+// filled and writing that one out
+func (w *LOBWriter) nextPage() error {
+	page, err := w.pager.AllocatePage(PageTypeOverflow)
+	if err != nil {
+		return err
+	}
+	if _, err := w.pager.PinPage(page.Header.PageID); err != nil {
+		return err
+	}
+
+	if w.page == nil {
+		w.locator.FirstPageID = page.Header.PageID
+	} else {
+		LinkPages(w.page, page)
+		if err := w.writePage(); err != nil {
+			w.pager.UnpinPage(page.Header.PageID)
+			return err
+		}
+	}
+	w.page = page
+	w.fill = 0
+	return nil
+}
+
+// writePage logs and writes the page being filled and releases its pin
+func (w *LOBWriter) writePage() error {
+	page := w.page
+	binary.LittleEndian.PutUint32(page.Body, uint32(w.fill))
+
+	if w.wal != nil {
+		before := NewPage(PageTypeOverflow)
+		before.Header.PageID = page.Header.PageID
+		entry := &WriteAheadLogEntry{TxnID: w.txnID, Type: EntryTypeWrite, PageID: page.Header.PageID}
+		oldImage, err := w.pager.encodePage(before)
+		if err != nil {
+			return err
+		}
+		newImage, err := w.pager.encodePage(page)
+		if err != nil {
+			return err
+		}
+		copy(entry.OldData[:], oldImage)
+		copy(entry.NewData[:], newImage)
+		if err := w.wal.Append(entry); err != nil {
+			return &PagerError{
+				Op:  "WriteLOB",
+				Err: fmt.Errorf("unable to log page %d: %w", page.Header.PageID, err),
+			}
+		}
+		page.MarkDirtyLSN(entry.LSN)
+	}
+
+	if err := w.pager.WritePage(page); err != nil {
+		return err
+	}
+	return w.pager.UnpinPage(page.Header.PageID)
+}
+
+// Close writes the last page of the value. Closing an empty writer stores
+// nothing and yields a locator for the empty value
+func (w *LOBWriter) Close() error {
+	if w.closed {
+		return nil
+	}
+	w.closed = true
+	if w.err != nil {
+		if w.page != nil {
+			w.pager.UnpinPage(w.page.Header.PageID)
+		}
+		return w.err
+	}
+	if w.page != nil {
+		if err := w.writePage(); err != nil {
+			w.err = err
+			return err
+		}
+		w.page = nil
+	}
+	return nil
+}
+
+// Locator returns the locator of the value written, once Close has succeeded
+func (w *LOBWriter) Locator() (LOBLocator, error) {
+	if !w.closed {
+		return LOBLocator{}, &PagerError{Op: "WriteLOB", Err: fmt.Errorf("LOB writer is not closed")}
+	}
+	if w.err != nil {
+		return LOBLocator{}, w.err
+	}
+	return w.locator, nil
+}
+
+// DeleteLOB deallocates every page of the overflow chain locator points at
+func DeleteLOB(pager *Pager, locator LOBLocator) error {
+	if err := freeOverflow(pager, locator); err != nil {
+		return &PagerError{
+			Op:  "DeleteLOB",
+			Err: fmt.Errorf("unable to free LOB at page %d: %w", locator.FirstPageID, err),
+		}
+	}
+	return nil
+}
+
+// overflowChunk returns the value bytes held by an overflow page. The returned
+// slice aliases the page body
+func overflowChunk(page *Page) ([]byte, error) {
+	if page.Header.PageType != PageTypeOverflow {
+		return nil, fmt.Errorf("page %d is not an overflow page", page.Header.PageID)
+	}
+	chunk := int(binary.LittleEndian.Uint32(page.Body))
+	if chunk > overflowChunkSize {
+		return nil, fmt.Errorf("overflow page %d claims to hold %d bytes", page.Header.PageID, chunk)
+	}
+	return page.Body[4 : 4+chunk], nil
+}
+
+// writeOverflow stores data in a new chain of overflow pages and returns its
+// locator
+func writeOverflow(pager *Pager, data []byte) (LOBLocator, error) {
+	locator := LOBLocator{Length: uint32(len(data))}
+	var prev *Page
+	for len(data) > 0 {
+		page, err := pager.AllocatePage(PageTypeOverflow)
+		if err != nil {
+			return LOBLocator{}, err
+		}
+		chunk := min(len(data), overflowChunkSize)
+		binary.LittleEndian.PutUint32(page.Body, uint32(chunk))
+		copy(page.Body[4:], data[:chunk])
+		data = data[chunk:]
+
+		if prev == nil {
+			locator.FirstPageID = page.Header.PageID
+		} else {
+			LinkPages(prev, page)
+			if err := pager.WritePage(prev); err != nil {
+				return LOBLocator{}, err
+			}
+		}
+		prev = page
+	}
+	if prev != nil {
+		if err := pager.WritePage(prev); err != nil {
+			return LOBLocator{}, err
+		}
+	}
+	return locator, nil
+}
+
+// readOverflow returns the value stored in the overflow chain locator points
+// at
+func readOverflow(pager *Pager, locator LOBLocator) ([]byte, error) {
+	data := make([]byte, 0, locator.Length)
+	err := pager.WalkFrom(locator.FirstPageID, func(page *Page) error {
+		chunk, err := overflowChunk(page)
+		if err != nil {
+			return err
+		}
+		if len(data)+len(chunk) > int(locator.Length) {
+			return fmt.Errorf("overflow page %d holds %d bytes, more than the value has left", page.Header.PageID, len(chunk))
+		}
+		data = append(data, chunk...)
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	if len(data) != int(locator.Length) {
+		return nil, fmt.Errorf("overflow chain at page %d holds %d bytes, expected %d", locator.FirstPageID, len(data), locator.Length)
+	}
+	return data, nil
+}
+
+// freeOverflow deallocates every page of the overflow chain locator points at
+func freeOverflow(pager *Pager, locator LOBLocator) error {
+	var pageIDs []PageID
+	err := pager.WalkFrom(locator.FirstPageID, func(page *Page) error {
+		pageIDs = append(pageIDs, page.Header.PageID)
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+	for _, pageID := range pageIDs {
+		if err := pager.DeallocatePage(pageID); err != nil {
+			return err
+		}
+	}
+	return nil
+}
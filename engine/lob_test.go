@@ -0,0 +1,290 @@
+package engine
+
+import (
+	"bytes"
+	"errors"
+	"io"
+	"testing"
+)
+
+// lobValue returns a deterministic n byte value that differs on every page
+func lobValue(n int) []byte {
+	value := make([]byte, n)
+	for i := range value {
+		value[i] = byte(i*7 + i/overflowChunkSize)
+	}
+	return value
+}
+
+func TestLOBRoundTrip(t *testing.T) {
+	pager := newTestPager(t)
+
+	value := lobValue(3 << 20)
+	locator, err := WriteLOB(pager, value)
+	if err != nil {
+		t.Fatalf(`WriteLOB() got %q wanted nil`, err)
+	}
+	if locator.Length != uint32(len(value)) {
+		t.Errorf(`locator length = %d; want %d`, locator.Length, len(value))
+	}
+
+	// The locator is what a record stores
+	decoded, err := DecodeLOBLocator(locator.Encode())
+	if err != nil {
+		t.Fatalf(`DecodeLOBLocator() got %q wanted nil`, err)
+	}
+	if decoded != locator {
+		t.Errorf(`DecodeLOBLocator(Encode()) = %+v; want %+v`, decoded, locator)
+	}
+
+	got, err := ReadLOB(pager, decoded)
+	if err != nil {
+		t.Fatalf(`ReadLOB() got %q wanted nil`, err)
+	}
+	if !bytes.Equal(got, value) {
+		t.Errorf(`ReadLOB() did not return the %d byte value written`, len(value))
+	}
+
+	pages := 0
+	if err := pager.WalkFrom(locator.FirstPageID, func(*Page) error { pages++; return nil }); err != nil {
+		t.Fatalf(`WalkFrom() got %q wanted nil`, err)
+	}
+	if want := (len(value) + overflowChunkSize - 1) / overflowChunkSize; pages != want {
+		t.Errorf(`LOB spans %d pages; want %d`, pages, want)
+	}
+
+	if err := DeleteLOB(pager, locator); err != nil {
+		t.Fatalf(`DeleteLOB() got %q wanted nil`, err)
+	}
+	// Freeing the chain at the end of the file truncates it away entirely
+	if _, err := pager.ReadPage(locator.FirstPageID); err == nil {
+		t.Errorf(`ReadPage(%d) after DeleteLOB() got nil wanted error`, locator.FirstPageID)
+	}
+}
+
+func TestReadLOBAt(t *testing.T) {
+	pager := newTestPager(t)
+
+	value := lobValue(10 * overflowChunkSize)
+	locator, err := WriteLOB(pager, value)
+	if err != nil {
+		t.Fatalf(`WriteLOB() got %q wanted nil`, err)
+	}
+
+	tests := []struct {
+		offset uint32
+		n      uint32
+	}{
+		{0, 10},
+		{overflowChunkSize - 5, 10},
+		{3*overflowChunkSize + 1, 2 * overflowChunkSize},
+		{uint32(len(value)) - 3, 100},
+		{uint32(len(value)), 1},
+	}
+	for _, test := range tests {
+		got, err := ReadLOBAt(pager, locator, test.offset, test.n)
+		if err != nil {
+			t.Fatalf(`ReadLOBAt(%d, %d) got %q wanted nil`, test.offset, test.n, err)
+		}
+		end := min(int(test.offset+test.n), len(value))
+		if !bytes.Equal(got, value[test.offset:end]) {
+			t.Errorf(`ReadLOBAt(%d, %d) returned %d bytes not matching the value`, test.offset, test.n, len(got))
+		}
+	}
+
+	if _, err := ReadLOBAt(pager, locator, uint32(len(value))+1, 1); err == nil {
+		t.Errorf(`ReadLOBAt() past the end got nil wanted error`)
+	}
+
+	// A locator claiming more than the chain holds runs off its end
+	overlong := locator
+	overlong.Length += 10
+	if _, err := ReadLOBAt(pager, overlong, uint32(len(value)), 10); !errors.Is(err, ErrEndOfChain) {
+		t.Errorf(`ReadLOBAt() past the chain got %v wanted ErrEndOfChain`, err)
+	}
+	if _, err := ReadLOB(pager, overlong); err == nil {
+		t.Errorf(`ReadLOB() with a wrong length got nil wanted error`)
+	}
+}
+
+// pinnedPages counts the cached pages holding at least one pin
+func pinnedPages(pager *Pager) int {
+	pager.mutex.RLock()
+	defer pager.mutex.RUnlock()
+	pinned := 0
+	for _, page := range pager.pageCache {
+		if page.pins > 0 {
+			pinned++
+		}
+	}
+	return pinned
+}
+
+func TestLOBReaderStreams(t *testing.T) {
+	pager := newTestPager(t)
+
+	value := lobValue(4 << 20)
+	locator, err := WriteLOB(pager, value)
+	if err != nil {
+		t.Fatalf(`WriteLOB() got %q wanted nil`, err)
+	}
+
+	reader := OpenLOBReader(pager, locator)
+	var got bytes.Buffer
+	buffer := make([]byte, 1000)
+	for {
+		n, err := reader.Read(buffer)
+		got.Write(buffer[:n])
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			t.Fatalf(`Read() got %q wanted nil`, err)
+		}
+		if pinned := pinnedPages(pager); pinned > 1 {
+			t.Fatalf(`%d pages pinned while streaming; want at most 1`, pinned)
+		}
+		if cached := pager.Stats().CachedPages; cached > 100 {
+			t.Fatalf(`%d pages cached while streaming; want at most the cache size of 100`, cached)
+		}
+	}
+	if err := reader.Close(); err != nil {
+		t.Fatalf(`Close() got %q wanted nil`, err)
+	}
+	if !bytes.Equal(got.Bytes(), value) {
+		t.Errorf(`streamed %d bytes not matching the %d byte value`, got.Len(), len(value))
+	}
+	if pinned := pinnedPages(pager); pinned != 0 {
+		t.Errorf(`%d pages pinned after Close(); want 0`, pinned)
+	}
+}
+
+func TestLOBReaderClosedEarly(t *testing.T) {
+	pager := newTestPager(t)
+
+	locator, err := WriteLOB(pager, lobValue(3*overflowChunkSize))
+	if err != nil {
+		t.Fatalf(`WriteLOB() got %q wanted nil`, err)
+	}
+	reader := OpenLOBReader(pager, locator)
+	if _, err := reader.Read(make([]byte, 10)); err != nil {
+		t.Fatalf(`Read() got %q wanted nil`, err)
+	}
+	if err := reader.Close(); err != nil {
+		t.Fatalf(`Close() got %q wanted nil`, err)
+	}
+	if pinned := pinnedPages(pager); pinned != 0 {
+		t.Errorf(`%d pages pinned after Close(); want 0`, pinned)
+	}
+	if _, err := reader.Read(make([]byte, 10)); err == nil {
+		t.Errorf(`Read() after Close() got nil wanted error`)
+	}
+
+	// The pin released, the chain can be freed
+	if err := DeleteLOB(pager, locator); err != nil {
+		t.Errorf(`DeleteLOB() got %q wanted nil`, err)
+	}
+}
+
+func TestLOBWriterStreams(t *testing.T) {
+	pager := newTestPager(t)
+
+	value := lobValue(5 << 20)
+	writer := OpenLOBWriter(pager)
+	if _, err := writer.Locator(); err == nil {
+		t.Errorf(`Locator() before Close() got nil wanted error`)
+	}
+	// An odd buffer size makes writes straddle page boundaries
+	if _, err := io.CopyBuffer(writer, bytes.NewReader(value), make([]byte, 777)); err != nil {
+		t.Fatalf(`io.CopyBuffer() got %q wanted nil`, err)
+	}
+	if pinned := pinnedPages(pager); pinned != 1 {
+		t.Errorf(`%d pages pinned while writing; want 1`, pinned)
+	}
+	if err := writer.Close(); err != nil {
+		t.Fatalf(`Close() got %q wanted nil`, err)
+	}
+	if pinned := pinnedPages(pager); pinned != 0 {
+		t.Errorf(`%d pages pinned after Close(); want 0`, pinned)
+	}
+
+	locator, err := writer.Locator()
+	if err != nil {
+		t.Fatalf(`Locator() got %q wanted nil`, err)
+	}
+	got, err := ReadLOB(pager, locator)
+	if err != nil {
+		t.Fatalf(`ReadLOB() got %q wanted nil`, err)
+	}
+	if !bytes.Equal(got, value) {
+		t.Errorf(`ReadLOB() did not return the %d bytes streamed in`, len(value))
+	}
+	if _, err := writer.Write([]byte{1}); err == nil {
+		t.Errorf(`Write() after Close() got nil wanted error`)
+	}
+
+	empty := OpenLOBWriter(pager)
+	if err := empty.Close(); err != nil {
+		t.Fatalf(`Close() got %q wanted nil`, err)
+	}
+	locator, err = empty.Locator()
+	if err != nil {
+		t.Fatalf(`Locator() got %q wanted nil`, err)
+	}
+	if got, err := ReadLOB(pager, locator); err != nil || len(got) != 0 {
+		t.Errorf(`ReadLOB() of an empty LOB = (%d bytes, %v); want (0 bytes, nil)`, len(got), err)
+	}
+}
+
+func TestLoggedLOBWriterRecovers(t *testing.T) {
+	pager := newTestPager(t)
+	wal := newTestWAL(t)
+
+	value := lobValue(20 * overflowChunkSize)
+	writer := OpenLoggedLOBWriter(pager, wal, 3)
+	if _, err := writer.Write(value); err != nil {
+		t.Fatalf(`Write() got %q wanted nil`, err)
+	}
+	if err := writer.Close(); err != nil {
+		t.Fatalf(`Close() got %q wanted nil`, err)
+	}
+	locator, err := writer.Locator()
+	if err != nil {
+		t.Fatalf(`Locator() got %q wanted nil`, err)
+	}
+	if err := wal.Append(&WriteAheadLogEntry{TxnID: 3, Type: EntryTypeCommit}); err != nil {
+		t.Fatalf(`Append() got %q wanted nil`, err)
+	}
+	if err := wal.Flush(); err != nil {
+		t.Fatalf(`Flush() got %q wanted nil`, err)
+	}
+
+	entries, err := wal.Replay()
+	if err != nil {
+		t.Fatalf(`Replay() got %q wanted nil`, err)
+	}
+	if len(entries) != 21 {
+		t.Errorf(`log holds %d entries; want one per page and the commit`, len(entries))
+	}
+
+	// Lose a page of the value, as if it never reached disk
+	lost := NewPage(PageTypeOverflow)
+	lost.Header.PageID = entries[7].PageID
+	if err := pager.WritePage(lost); err != nil {
+		t.Fatalf(`WritePage() got %q wanted nil`, err)
+	}
+	if _, err := ReadLOB(pager, locator); err == nil {
+		t.Fatalf(`ReadLOB() with a lost page got nil wanted error`)
+	}
+
+	if err := Recover(pager, wal); err != nil {
+		t.Fatalf(`Recover() got %q wanted nil`, err)
+	}
+	got, err := ReadLOB(pager, locator)
+	if err != nil {
+		t.Fatalf(`ReadLOB() after Recover() got %q wanted nil`, err)
+	}
+	if !bytes.Equal(got, value) {
+		t.Errorf(`ReadLOB() after Recover() did not return the value written`)
+	}
+}
@@ -3,29 +3,65 @@ package engine
 import (
 	"bufio"
 	"bytes"
+	"context"
 	"encoding/binary"
 	"encoding/gob"
+	"errors"
 	"fmt"
+	"hash/crc32"
 	"io"
 	"os"
+	"sort"
+	"sync"
+	"sync/atomic"
+	"time"
 )
 
 type WALEntryType int
 
-const ENTRY_SIZE int = 8216
+// ENTRY_SIZE is the size of a serialized entry: LSN, TxnID, Type, PageID,
+// Offset, Timestamp, OldData, NewData and a trailing CRC32C over everything
+// before it
+const ENTRY_SIZE int = 8 + 8 + 4 + 8 + 4 + 8 + PageSize + PageSize + 4
 
 const (
 	EntryTypeWrite WALEntryType = iota
 	EntryTypeCommit
+	// EntryTypeCheckpoint marks a point by which every page change logged
+	// before it is on disk. NewData holds the transactions still active
+	EntryTypeCheckpoint
 )
 
+var ErrCorruptEntry = errors.New("corrupt log entry")
+
+// ErrLogClosed is returned when flushing a log that has been closed
+var ErrLogClosed = errors.New("log is closed")
+
+func (t WALEntryType) String() string {
+	switch t {
+	case EntryTypeWrite:
+		return "WRITE"
+	case EntryTypeCommit:
+		return "COMMIT"
+	case EntryTypeCheckpoint:
+		return "CHECKPOINT"
+	default:
+		return fmt.Sprintf("UNKNOWN(%d)", int(t))
+	}
+}
+
 type WriteAheadLogEntry struct {
-	TxnID   uint64
-	Type    WALEntryType
-	PageID  PageID
-	Offset  uint32
-	OldData [PageSize]byte
-	NewData [PageSize]byte
+	LSN    uint64
+	TxnID  uint64
+	Type   WALEntryType
+	PageID PageID
+	Offset uint32
+	// Timestamp is when the entry was appended, in Unix nanoseconds, unless
+	// the appender set it already
+	Timestamp int64
+	OldData   [PageSize]byte
+	NewData   [PageSize]byte
+	Checksum  uint32
 }
 
 type WriteAheadLogs struct {
@@ -38,6 +74,52 @@ type WriteAheadLog struct {
 	FilePath string
 	File     *os.File
 	Writer   *bufio.Writer
+	// Tracer receives a span for each traced operation; nil disables tracing
+	Tracer Tracer
+	// Metrics receives the latencies of Append and Flush; nil disables them
+	Metrics Metrics
+	mutex   sync.Mutex
+	nextLSN uint64
+	// durableLSN is the highest LSN known to be synced to the log file
+	durableLSN atomic.Uint64
+	syncPolicy WALSyncPolicy
+	// active maps each transaction that has logged a write but not committed
+	// to the LSN of its first write
+	active map[uint64]uint64
+	// queue and writerDone are set in async mode, where a background
+	// goroutine owns Writer
+	queue      chan walRequest
+	writerDone chan struct{}
+	// failed holds the error the async writer failed with
+	failed atomic.Pointer[error]
+	// archiveDir receives a copy of each segment sealed by Rotate
+	archiveDir string
+}
+
+// WALSyncPolicy controls when appended entries are fsynced without an
+// explicit Flush
+type WALSyncPolicy int
+
+const (
+	// SyncOnFlush only syncs when Flush is called
+	SyncOnFlush WALSyncPolicy = iota
+	// SyncOnCommit syncs whenever a commit entry is appended
+	SyncOnCommit
+	// SyncAlways syncs after every append
+	SyncAlways
+)
+
+type WriteAheadLogConfig struct {
+	FilePath   string
+	Tracer     Tracer
+	Metrics    Metrics
+	SyncPolicy WALSyncPolicy
+	// Async hands appends to a background writer that batches them, so many
+	// concurrent appenders share each fsync
+	Async bool
+	// ArchiveDir, when set, receives a copy of every segment of the log that
+	// Rotate or Checkpoint seals, before the log file is reused
+	ArchiveDir string
 }
 
 type WALInterface interface {
@@ -48,61 +130,387 @@ type WALInterface interface {
 	Close() error
 }
 
-func (wal *WriteAheadLog) Create() error {
-	_, err := os.Stat(wal.File.Name())
+// NewWriteAheadLog opens or creates the log file described by config and
+// positions it to continue after the last complete entry
+func NewWriteAheadLog(config WriteAheadLogConfig) (*WriteAheadLog, error) {
+	if len(config.FilePath) == 0 {
+		return nil, fmt.Errorf("filepath cannot be empty")
+	}
+	wal := &WriteAheadLog{
+		FilePath:   config.FilePath,
+		Tracer:     config.Tracer,
+		Metrics:    config.Metrics,
+		nextLSN:    1,
+		syncPolicy: config.SyncPolicy,
+		active:     make(map[uint64]uint64),
+		archiveDir: config.ArchiveDir,
+	}
+	if err := wal.Create(); err != nil {
+		return nil, fmt.Errorf("unable to open log `%s`: %w", config.FilePath, err)
+	}
+
+	// Resume numbering after the last intact entry, cutting off the torn or
+	// corrupt tail a crash mid-append leaves so new entries stay aligned
+	last, err := wal.trimTail()
 	if err != nil {
-		file, err := os.OpenFile(wal.FilePath, os.O_RDWR|os.O_CREATE, 0644)
+		wal.File.Close()
+		return nil, err
+	}
+	if last != nil {
+		wal.nextLSN = last.LSN + 1
+		wal.durableLSN.Store(last.LSN)
+	} else if len(config.ArchiveDir) > 0 {
+		// A log emptied by rotation continues after its archived segments
+		last, err := lastArchivedLSN(config.ArchiveDir)
 		if err != nil {
-			return err
+			wal.File.Close()
+			return nil, err
 		}
-		wal.File = file
+		wal.nextLSN = last + 1
+		wal.durableLSN.Store(last)
+	}
+
+	if config.Async {
+		wal.startAsyncWriter()
+	}
+	return wal, nil
+}
+
+// trimTail truncates what a crash mid-append can leave at the end of the log
+// file: a partial entry, and a last full entry that fails its checksum. It
+// returns the last intact entry, or nil if the log holds none. Any earlier
+// entry failing its checksum is damage rather than a torn append, and is
+// reported with ErrCorruptEntry instead of being cut off
+func (wal *WriteAheadLog) trimTail() (*WriteAheadLogEntry, error) {
+	info, err := wal.File.Stat()
+	if err != nil {
+		return nil, fmt.Errorf("unable to get log file info: %w", err)
 	}
+	complete := info.Size() / int64(ENTRY_SIZE)
+	var last *WriteAheadLogEntry
+	for cut := int64(0); complete > 0; cut++ {
+		last, err = readEntryAt(wal.File, (complete-1)*int64(ENTRY_SIZE))
+		if err == nil {
+			break
+		}
+		if !errors.Is(err, ErrCorruptEntry) {
+			return nil, fmt.Errorf("unable to read log entry %d: %w", complete-1, err)
+		}
+		if cut > 0 {
+			return nil, fmt.Errorf("log entry %d before the tail: %w", complete-1, err)
+		}
+		last = nil
+		complete--
+	}
+
+	if size := complete * int64(ENTRY_SIZE); size != info.Size() {
+		if err := wal.File.Truncate(size); err != nil {
+			return nil, fmt.Errorf("unable to truncate torn log tail: %w", err)
+		}
+		if err := wal.File.Sync(); err != nil {
+			return nil, fmt.Errorf("unable to sync log file: %w", err)
+		}
+	}
+	return last, nil
+}
+
+// Create opens the log file if it is not already open
+func (wal *WriteAheadLog) Create() error {
+	if wal.File != nil {
+		return nil
+	}
+	file, err := os.OpenFile(wal.FilePath, os.O_RDWR|os.O_CREATE|os.O_APPEND, 0644)
+	if err != nil {
+		return err
+	}
+	wal.File = file
+	wal.Writer = bufio.NewWriterSize(file, 4*ENTRY_SIZE)
 	return nil
 }
 
+// Append assigns the entry the next LSN and buffers it for writing. The entry
+// is durable once Flush returns, or on return when the sync policy requires a
+// sync for it. In async mode Append waits for the background writer
 func (wal *WriteAheadLog) Append(entry *WriteAheadLogEntry) error {
+	defer observeSince(metricsOrNoop(wal.Metrics), MetricWALAppendSeconds, time.Now())
+	wal.mutex.Lock()
+	async := wal.queue != nil
+	wal.mutex.Unlock()
+	if async {
+		return <-wal.AppendAsync(entry)
+	}
+
 	err := wal.Create()
 	if err != nil {
 		return err
 	}
-	serialized, err := SerializeData(entry)
-	if err != nil {
+
+	wal.mutex.Lock()
+	defer wal.mutex.Unlock()
+
+	if wal.nextLSN == 0 {
+		wal.nextLSN = 1
+	}
+	entry.LSN = wal.nextLSN
+	if err := wal.prepare(entry); err != nil {
 		return err
 	}
+	serialized := encodeEntry(entry)
 
 	_, err = wal.Writer.Write(serialized)
 	if err != nil {
 		return err
 	}
+	wal.nextLSN++
 
+	if wal.needsSync(entry) {
+		return wal.flushThrough(entry.LSN)
+	}
+	return nil
+}
+
+// prepare timestamps an entry that has just been given its LSN, updates the
+// active transaction table for it and fills in the table for checkpoint
+// entries. The caller must hold wal.mutex
+func (wal *WriteAheadLog) prepare(entry *WriteAheadLogEntry) error {
+	if wal.active == nil {
+		wal.active = make(map[uint64]uint64)
+	}
+	if entry.Timestamp == 0 {
+		entry.Timestamp = time.Now().UnixNano()
+	}
+	switch entry.Type {
+	case EntryTypeWrite:
+		if _, ok := wal.active[entry.TxnID]; !ok {
+			wal.active[entry.TxnID] = entry.LSN
+		}
+	case EntryTypeCommit:
+		delete(wal.active, entry.TxnID)
+	case EntryTypeCheckpoint:
+		return encodeActiveTxns(entry, wal.active)
+	}
 	return nil
 }
 
+// needsSync reports whether the sync policy requires a sync after entry
+func (wal *WriteAheadLog) needsSync(entry *WriteAheadLogEntry) bool {
+	switch wal.syncPolicy {
+	case SyncAlways:
+		return true
+	case SyncOnCommit:
+		return entry.Type == EntryTypeCommit
+	default:
+		return false
+	}
+}
+
+// LastLSN returns the LSN of the last entry appended, or 0 if there is none
+func (wal *WriteAheadLog) LastLSN() uint64 {
+	wal.mutex.Lock()
+	defer wal.mutex.Unlock()
+	return max(wal.nextLSN, 1) - 1
+}
+
+// Flush writes buffered entries to the log file and syncs it
 func (wal *WriteAheadLog) Flush() error {
-	panic("Implement this functino")
+	return wal.FlushContext(context.Background())
+}
+
+// FlushContext is Flush with a context used to parent its trace span
+func (wal *WriteAheadLog) FlushContext(ctx context.Context) (err error) {
+	_, span := tracerOrNoop(wal.Tracer).StartSpan(ctx, "wal.Flush")
+	defer func() { span.End(err) }()
+	defer observeSince(metricsOrNoop(wal.Metrics), MetricWALFlushSeconds, time.Now())
+
+	wal.mutex.Lock()
+	if done := wal.queueFlush(); done != nil {
+		wal.mutex.Unlock()
+		return <-done
+	}
+	defer wal.mutex.Unlock()
+	return wal.flushSync()
+}
+
+// flushLocked is Flush for a caller already holding wal.mutex. In async mode
+// the flush is handed to the writer, which does not need the mutex
+func (wal *WriteAheadLog) flushLocked() error {
+	if done := wal.queueFlush(); done != nil {
+		return <-done
+	}
+	return wal.flushSync()
+}
+
+// flushSync flushes every entry appended so far outside async mode. The
+// caller must hold wal.mutex
+func (wal *WriteAheadLog) flushSync() error {
+	if wal.File == nil {
+		return ErrLogClosed
+	}
+	return wal.flushThrough(wal.nextLSN - 1)
 }
 
+// FlushTo makes every entry up to and including lsn durable, flushing only if
+// an earlier flush has not already covered it
+func (wal *WriteAheadLog) FlushTo(lsn uint64) error {
+	if wal.durableLSN.Load() >= lsn {
+		return nil
+	}
+	return wal.Flush()
+}
+
+// flushThrough flushes the buffer, which holds every entry up to lsn, and
+// records lsn as durable. The caller must own Writer as for flush
+func (wal *WriteAheadLog) flushThrough(lsn uint64) error {
+	if err := wal.flush(); err != nil {
+		return err
+	}
+	if lsn > wal.durableLSN.Load() {
+		wal.durableLSN.Store(lsn)
+	}
+	return nil
+}
+
+// flush writes out the buffer and syncs the file. The caller must own Writer:
+// hold wal.mutex, or be the async writer goroutine
+func (wal *WriteAheadLog) flush() error {
+	if err := wal.Writer.Flush(); err != nil {
+		return fmt.Errorf("unable to flush log buffer: %w", err)
+	}
+	if err := wal.File.Sync(); err != nil {
+		return fmt.Errorf("unable to sync log file: %w", err)
+	}
+	return nil
+}
+
+// Replay returns every complete entry in the log in LSN order. A torn entry at
+// the tail, left by a crash mid-write, ends the replay; a corrupt entry
+// anywhere else is an error
 func (wal *WriteAheadLog) Replay() ([]WriteAheadLogEntry, error) {
-	var entries []WriteAheadLogEntry
+	return wal.ReplayFrom(0)
+}
 
-	for {
-		serialized_entry := make([]byte, ENTRY_SIZE)
-		_, err := wal.File.Read(serialized_entry)
-		if err == io.EOF {
-			break
-		}
-		deserialized, err := DeserializeData(serialized_entry, ENTRY_SIZE)
+// ReplayFrom is Replay for only the entries with an LSN of at least startLSN.
+// LSNs increase through the file, so the first such entry is found by binary
+// search rather than by reading the entries before it
+func (wal *WriteAheadLog) ReplayFrom(startLSN uint64) ([]WriteAheadLogEntry, error) {
+	info, err := wal.File.Stat()
+	if err != nil {
+		return nil, fmt.Errorf("unable to get log file info: %w", err)
+	}
+	complete := info.Size() / int64(ENTRY_SIZE)
+	start, err := wal.search(complete, startLSN)
+	if err != nil {
+		return nil, err
+	}
+
+	var entries []WriteAheadLogEntry
+	for i := start; i < complete; i++ {
+		entry, err := readEntryAt(wal.File, i*int64(ENTRY_SIZE))
 		if err != nil {
-			return entries, fmt.Errorf("unable to deserialize data")
+			if i == complete-1 && errors.Is(err, ErrCorruptEntry) {
+				break
+			}
+			return entries, fmt.Errorf("unable to read entry %d: %w", i, err)
 		}
-		entries = append(entries, *deserialized)
+		entries = append(entries, *entry)
 	}
 
 	return entries, nil
 }
 
-func (wal *WriteAheadLog) Close() {
-	panic("Implement this function")
+// search returns the index of the first of the complete entries in the log
+// with an LSN of at least lsn, or complete if there is none
+func (wal *WriteAheadLog) search(complete int64, lsn uint64) (int64, error) {
+	var searchErr error
+	index := sort.Search(int(complete), func(i int) bool {
+		entry, err := readEntryAt(wal.File, int64(i)*int64(ENTRY_SIZE))
+		if err != nil {
+			// A torn tail sorts after everything; other damage stops the search
+			if !(int64(i) == complete-1 && errors.Is(err, ErrCorruptEntry)) && searchErr == nil {
+				searchErr = fmt.Errorf("unable to read entry %d: %w", i, err)
+			}
+			return true
+		}
+		return entry.LSN >= lsn
+	})
+	if searchErr != nil {
+		return 0, searchErr
+	}
+	return int64(index), nil
+}
+
+// entryOffset returns the file offset of the entry with the given LSN, which
+// must already have been flushed
+func (wal *WriteAheadLog) entryOffset(lsn uint64) (int64, error) {
+	info, err := wal.File.Stat()
+	if err != nil {
+		return 0, fmt.Errorf("unable to get log file info: %w", err)
+	}
+	complete := info.Size() / int64(ENTRY_SIZE)
+	index, err := wal.search(complete, lsn)
+	if err != nil {
+		return 0, err
+	}
+	offset := index * int64(ENTRY_SIZE)
+	if index == complete {
+		return 0, fmt.Errorf("no entry with LSN %d in the log", lsn)
+	}
+	if entry, err := readEntryAt(wal.File, offset); err != nil || entry.LSN != lsn {
+		return 0, fmt.Errorf("no entry with LSN %d in the log", lsn)
+	}
+	return offset, nil
+}
+
+// Close flushes any buffered entries and closes the log file. Once it is
+// closed, flushing the log fails with ErrLogClosed
+func (wal *WriteAheadLog) Close() error {
+	wal.stopAsyncWriter()
+
+	wal.mutex.Lock()
+	defer wal.mutex.Unlock()
+	if wal.File == nil {
+		return nil
+	}
+	flushErr := wal.failure()
+	if flushErr == nil {
+		flushErr = wal.flushSync()
+	}
+	closeErr := wal.File.Close()
+	wal.File = nil
+	if flushErr != nil {
+		return flushErr
+	}
+	if closeErr != nil {
+		return fmt.Errorf("unable to close log file: %w", closeErr)
+	}
+	return nil
+}
+
+// readEntryAt reads and verifies the entry starting at offset
+func readEntryAt(file io.ReaderAt, offset int64) (*WriteAheadLogEntry, error) {
+	serialized_entry := make([]byte, ENTRY_SIZE)
+	if _, err := file.ReadAt(serialized_entry, offset); err != nil {
+		return nil, err
+	}
+	return DeserializeData(serialized_entry, ENTRY_SIZE)
+}
+
+// encodeEntry serializes an entry into its fixed-size form, computing and
+// storing its checksum
+func encodeEntry(entry *WriteAheadLogEntry) []byte {
+	buf := bytes.NewBuffer(make([]byte, 0, ENTRY_SIZE))
+	binary.Write(buf, binary.LittleEndian, entry.LSN)
+	binary.Write(buf, binary.LittleEndian, entry.TxnID)
+	binary.Write(buf, binary.LittleEndian, int32(entry.Type))
+	binary.Write(buf, binary.LittleEndian, entry.PageID)
+	binary.Write(buf, binary.LittleEndian, entry.Offset)
+	binary.Write(buf, binary.LittleEndian, entry.Timestamp)
+	buf.Write(entry.OldData[:])
+	buf.Write(entry.NewData[:])
+
+	entry.Checksum = crc32.Checksum(buf.Bytes(), checksumTable)
+	binary.Write(buf, binary.LittleEndian, entry.Checksum)
+	return buf.Bytes()
 }
 
 // HELPER FUNCTIONS FOR SERIALIZING AND DESERIALIZING DATA
@@ -116,20 +524,31 @@ func SerializeData[T any](data T) ([]byte, error) {
 	return bytes_buffer.Bytes(), nil
 }
 
+// DeserializeData decodes a fixed-size entry, rejecting it with
+// ErrCorruptEntry if its checksum does not match its contents
 func DeserializeData(data []byte, size int) (*WriteAheadLogEntry, error) {
 	entry := &WriteAheadLogEntry{}
-	if len(data) != size {
+	if len(data) != size || size != ENTRY_SIZE {
 		return entry, fmt.Errorf("invalid entry size")
 	}
 
 	buf := bytes.NewReader(data)
 
+	var entryType int32
+	binary.Read(buf, binary.LittleEndian, &entry.LSN)
 	binary.Read(buf, binary.LittleEndian, &entry.TxnID)
-	binary.Read(buf, binary.LittleEndian, &entry.Type)
+	binary.Read(buf, binary.LittleEndian, &entryType)
 	binary.Read(buf, binary.LittleEndian, &entry.PageID)
 	binary.Read(buf, binary.LittleEndian, &entry.Offset)
+	binary.Read(buf, binary.LittleEndian, &entry.Timestamp)
 	buf.Read(entry.OldData[:])
 	buf.Read(entry.NewData[:])
+	binary.Read(buf, binary.LittleEndian, &entry.Checksum)
+	entry.Type = WALEntryType(entryType)
+
+	if checksum := crc32.Checksum(data[:size-4], checksumTable); checksum != entry.Checksum {
+		return entry, fmt.Errorf("%w: LSN %d stored checksum %08x, computed %08x", ErrCorruptEntry, entry.LSN, entry.Checksum, checksum)
+	}
 
 	return entry, nil
 }
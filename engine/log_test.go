@@ -1 +1,281 @@
 package engine
+
+import (
+	"bytes"
+	"errors"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"testing"
+)
+
+// newTestWAL opens a log on a fresh file in a temporary directory
+func newTestWAL(t *testing.T) *WriteAheadLog {
+	t.Helper()
+	wal, err := NewWriteAheadLog(WriteAheadLogConfig{
+		FilePath: filepath.Join(t.TempDir(), "test.wal"),
+	})
+	if err != nil {
+		t.Fatalf(`NewWriteAheadLog() got %q wanted nil`, err)
+	}
+	t.Cleanup(func() { wal.Close() })
+	return wal
+}
+
+func TestAppendReplayRoundTrip(t *testing.T) {
+	wal := newTestWAL(t)
+
+	write := &WriteAheadLogEntry{TxnID: 7, Type: EntryTypeWrite, PageID: 3, Offset: 12}
+	write.NewData[0] = 0xAB
+	commit := &WriteAheadLogEntry{TxnID: 7, Type: EntryTypeCommit}
+	for _, entry := range []*WriteAheadLogEntry{write, commit} {
+		if err := wal.Append(entry); err != nil {
+			t.Fatalf(`Append() got %q wanted nil`, err)
+		}
+	}
+	if write.LSN != 1 || commit.LSN != 2 {
+		t.Errorf(`assigned LSNs = (%d, %d); want (1, 2)`, write.LSN, commit.LSN)
+	}
+	if err := wal.Flush(); err != nil {
+		t.Fatalf(`Flush() got %q wanted nil`, err)
+	}
+
+	entries, err := wal.Replay()
+	if err != nil {
+		t.Fatalf(`Replay() got %q wanted nil`, err)
+	}
+	if len(entries) != 2 {
+		t.Fatalf(`Replay() returned %d entries; want 2`, len(entries))
+	}
+	if entries[0].PageID != 3 || entries[0].Offset != 12 || entries[0].NewData[0] != 0xAB {
+		t.Errorf(`replayed write = (PageID %d, Offset %d, NewData[0] %#x); want (3, 12, 0xab)`,
+			entries[0].PageID, entries[0].Offset, entries[0].NewData[0])
+	}
+	if entries[1].Type != EntryTypeCommit {
+		t.Errorf(`replayed entry 2 type = %s; want COMMIT`, entries[1].Type)
+	}
+
+	// Reopening continues numbering after the last entry
+	if err := wal.Close(); err != nil {
+		t.Fatalf(`Close() got %q wanted nil`, err)
+	}
+	reopened, err := NewWriteAheadLog(WriteAheadLogConfig{FilePath: wal.FilePath})
+	if err != nil {
+		t.Fatalf(`NewWriteAheadLog() got %q wanted nil`, err)
+	}
+	defer reopened.Close()
+	next := &WriteAheadLogEntry{TxnID: 8, Type: EntryTypeCommit}
+	if err := reopened.Append(next); err != nil {
+		t.Fatalf(`Append() got %q wanted nil`, err)
+	}
+	if next.LSN != 3 {
+		t.Errorf(`LSN after reopen = %d; want 3`, next.LSN)
+	}
+}
+
+func TestReplayFrom(t *testing.T) {
+	wal := newTestWAL(t)
+	for i := 0; i < 10; i++ {
+		entry := &WriteAheadLogEntry{TxnID: uint64(i), Type: EntryTypeWrite, PageID: PageID(i + 1)}
+		if err := wal.Append(entry); err != nil {
+			t.Fatalf(`Append() got %q wanted nil`, err)
+		}
+	}
+	if err := wal.Flush(); err != nil {
+		t.Fatalf(`Flush() got %q wanted nil`, err)
+	}
+
+	for _, test := range []struct {
+		startLSN uint64
+		want     []uint64
+	}{
+		{startLSN: 7, want: []uint64{7, 8, 9, 10}},
+		{startLSN: 10, want: []uint64{10}},
+		{startLSN: 11, want: nil},
+		{startLSN: 0, want: []uint64{1, 2, 3, 4, 5, 6, 7, 8, 9, 10}},
+	} {
+		entries, err := wal.ReplayFrom(test.startLSN)
+		if err != nil {
+			t.Fatalf(`ReplayFrom(%d) got %q wanted nil`, test.startLSN, err)
+		}
+		var lsns []uint64
+		for _, entry := range entries {
+			lsns = append(lsns, entry.LSN)
+		}
+		if !slices.Equal(lsns, test.want) {
+			t.Errorf(`ReplayFrom(%d) LSNs = %v; want %v`, test.startLSN, lsns, test.want)
+		}
+	}
+}
+
+func TestFlushTo(t *testing.T) {
+	wal := newTestWAL(t)
+	for i := 0; i < 3; i++ {
+		if err := wal.Append(&WriteAheadLogEntry{TxnID: 1, Type: EntryTypeWrite}); err != nil {
+			t.Fatalf(`Append() got %q wanted nil`, err)
+		}
+	}
+	if err := wal.FlushTo(2); err != nil {
+		t.Fatalf(`FlushTo() got %q wanted nil`, err)
+	}
+	if durable := wal.durableLSN.Load(); durable != 3 {
+		t.Errorf(`durable LSN after FlushTo(2) = %d; want 3`, durable)
+	}
+	entries, err := wal.Replay()
+	if err != nil {
+		t.Fatalf(`Replay() got %q wanted nil`, err)
+	}
+	if len(entries) != 3 {
+		t.Errorf(`Replay() after FlushTo returned %d entries; want 3`, len(entries))
+	}
+}
+
+func TestReopenTrimsTornTail(t *testing.T) {
+	tests := []struct {
+		name   string
+		damage func(file *os.File)
+		// want is the LSNs replayed once an entry is appended after reopening
+		want []uint64
+	}{
+		{"partial entry", func(file *os.File) {
+			file.WriteAt(make([]byte, 100), 3*int64(ENTRY_SIZE))
+		}, []uint64{1, 2, 3, 4}},
+		{"corrupt last entry", func(file *os.File) {
+			file.WriteAt([]byte{0xff}, 2*int64(ENTRY_SIZE)+100)
+		}, []uint64{1, 2, 3}},
+	}
+	for _, test := range tests {
+		path := filepath.Join(t.TempDir(), "test.wal")
+		wal, err := NewWriteAheadLog(WriteAheadLogConfig{FilePath: path})
+		if err != nil {
+			t.Fatalf(`NewWriteAheadLog() got %q wanted nil`, err)
+		}
+		for i := 0; i < 3; i++ {
+			if err := wal.Append(&WriteAheadLogEntry{TxnID: 1, Type: EntryTypeWrite, PageID: PageID(i + 1)}); err != nil {
+				t.Fatalf(`Append() got %q wanted nil`, err)
+			}
+		}
+		if err := wal.Close(); err != nil {
+			t.Fatalf(`Close() got %q wanted nil`, err)
+		}
+		file, err := os.OpenFile(path, os.O_RDWR, 0644)
+		if err != nil {
+			t.Fatalf(`OpenFile() got %q wanted nil`, err)
+		}
+		test.damage(file)
+		file.Close()
+
+		wal, err = NewWriteAheadLog(WriteAheadLogConfig{FilePath: path})
+		if err != nil {
+			t.Fatalf(`%s: NewWriteAheadLog() got %q wanted nil`, test.name, err)
+		}
+		entry := &WriteAheadLogEntry{TxnID: 2, Type: EntryTypeCommit}
+		if err := wal.Append(entry); err != nil {
+			t.Fatalf(`Append() got %q wanted nil`, err)
+		}
+		if err := wal.Flush(); err != nil {
+			t.Fatalf(`Flush() got %q wanted nil`, err)
+		}
+		entries, err := wal.Replay()
+		if err != nil {
+			t.Fatalf(`%s: Replay() after reopening got %q wanted nil`, test.name, err)
+		}
+		var lsns []uint64
+		for _, entry := range entries {
+			lsns = append(lsns, entry.LSN)
+		}
+		if !slices.Equal(lsns, test.want) {
+			t.Errorf(`%s: Replay() after reopening = LSNs %v; want %v`, test.name, lsns, test.want)
+		}
+		if report, err := ValidateWAL(path); err != nil || !report.OK() || report.TornBytes != 0 {
+			t.Errorf(`%s: ValidateWAL() = %+v, %v; want an intact log`, test.name, report, err)
+		}
+		wal.Close()
+	}
+}
+
+func TestReopenRefusesCorruptHistory(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "test.wal")
+	wal, err := NewWriteAheadLog(WriteAheadLogConfig{FilePath: path})
+	if err != nil {
+		t.Fatalf(`NewWriteAheadLog() got %q wanted nil`, err)
+	}
+	for i := 0; i < 3; i++ {
+		if err := wal.Append(&WriteAheadLogEntry{TxnID: 1, Type: EntryTypeWrite, PageID: PageID(i + 1)}); err != nil {
+			t.Fatalf(`Append() got %q wanted nil`, err)
+		}
+	}
+	if err := wal.Close(); err != nil {
+		t.Fatalf(`Close() got %q wanted nil`, err)
+	}
+
+	// A crash can only tear the last entry, so a damaged one before it is
+	// reported rather than cut off along with everything after it
+	file, err := os.OpenFile(path, os.O_RDWR, 0644)
+	if err != nil {
+		t.Fatalf(`OpenFile() got %q wanted nil`, err)
+	}
+	file.WriteAt([]byte{0xff}, int64(ENTRY_SIZE)+100)
+	file.WriteAt([]byte{0xff}, 2*int64(ENTRY_SIZE)+100)
+	file.Close()
+
+	if _, err := NewWriteAheadLog(WriteAheadLogConfig{FilePath: path}); !errors.Is(err, ErrCorruptEntry) {
+		t.Fatalf(`NewWriteAheadLog() got %v wanted ErrCorruptEntry`, err)
+	}
+	info, err := os.Stat(path)
+	if err != nil {
+		t.Fatalf(`Stat() got %q wanted nil`, err)
+	}
+	if info.Size() != 3*int64(ENTRY_SIZE) {
+		t.Errorf(`log file after a refused reopen = %d bytes; want all 3 entries kept`, info.Size())
+	}
+}
+
+func TestDumpWAL(t *testing.T) {
+	wal := newTestWAL(t)
+
+	for _, entry := range []*WriteAheadLogEntry{
+		{TxnID: 1, Type: EntryTypeWrite, PageID: 4, Offset: 0},
+		{TxnID: 1, Type: EntryTypeWrite, PageID: 5, Offset: 64},
+		{TxnID: 1, Type: EntryTypeCommit},
+	} {
+		entry.NewData[0] = 0xFF
+		if err := wal.Append(entry); err != nil {
+			t.Fatalf(`Append() got %q wanted nil`, err)
+		}
+	}
+	if err := wal.Close(); err != nil {
+		t.Fatalf(`Close() got %q wanted nil`, err)
+	}
+
+	// Corrupt the second entry and leave a torn entry at the tail
+	file, err := os.OpenFile(wal.FilePath, os.O_RDWR, 0644)
+	if err != nil {
+		t.Fatalf(`OpenFile() got %q wanted nil`, err)
+	}
+	file.WriteAt([]byte{0x01}, int64(ENTRY_SIZE)+100)
+	file.WriteAt(make([]byte, 10), 3*int64(ENTRY_SIZE))
+	file.Close()
+
+	var out bytes.Buffer
+	if err := DumpWAL(&out, wal.FilePath); err != nil {
+		t.Fatalf(`DumpWAL() got %q wanted nil`, err)
+	}
+	lines := strings.Split(strings.TrimSpace(out.String()), "\n")
+	want := []string{
+		"offset=0 LSN=1 TxnID=1 Type=WRITE PageID=4 Offset=0 Old=00000000000000000000000000000000 New=ff000000000000000000000000000000",
+		"offset=8236 CORRUPT LSN=2 TxnID=1 Type=WRITE PageID=5 Offset=64 Old=00000000000000000000000000000000 New=ff000000000000000000000000000000",
+		"offset=16472 LSN=3 TxnID=1 Type=COMMIT PageID=0 Offset=0 Old=00000000000000000000000000000000 New=ff000000000000000000000000000000",
+		"offset=24708 TORN partial entry of 10 bytes",
+		"3 entries, 1 corrupt",
+	}
+	if len(lines) != len(want) {
+		t.Fatalf("DumpWAL() printed %d lines; want %d:\n%s", len(lines), len(want), out.String())
+	}
+	for i := range want {
+		if lines[i] != want[i] {
+			t.Errorf("line %d = %q\nwant %q", i, lines[i], want[i])
+		}
+	}
+}
@@ -0,0 +1,146 @@
+package engine
+
+// walQueueSize bounds how many requests can wait for the async writer
+const walQueueSize = 1024
+
+// walRequest is an entry to write, or a flush request when entry is nil. The
+// writer reports the outcome on done, which must be buffered
+type walRequest struct {
+	entry *WriteAheadLogEntry
+	done  chan error
+}
+
+// AppendAsync assigns the entry the next LSN and queues it for the background
+// writer, returning a channel that receives the result once the entry has been
+// written, and synced if the sync policy calls for it. Entries are written in
+// LSN order. Without async mode the append happens synchronously. Once the
+// writer has failed every append fails with its error and takes no LSN
+func (wal *WriteAheadLog) AppendAsync(entry *WriteAheadLogEntry) <-chan error {
+	done := make(chan error, 1)
+
+	// Assigning the LSN and enqueueing under one lock keeps queue order and
+	// LSN order identical
+	wal.mutex.Lock()
+	if wal.queue == nil {
+		wal.mutex.Unlock()
+		done <- wal.Append(entry)
+		return done
+	}
+	if err := wal.failure(); err != nil {
+		wal.mutex.Unlock()
+		done <- err
+		return done
+	}
+	entry.LSN = wal.nextLSN
+	if err := wal.prepare(entry); err != nil {
+		wal.mutex.Unlock()
+		done <- err
+		return done
+	}
+	wal.nextLSN++
+	wal.queue <- walRequest{entry: entry, done: done}
+	wal.mutex.Unlock()
+	return done
+}
+
+func (wal *WriteAheadLog) startAsyncWriter() {
+	wal.queue = make(chan walRequest, walQueueSize)
+	wal.writerDone = make(chan struct{})
+	go wal.runAsyncWriter(wal.queue)
+}
+
+// stopAsyncWriter drains the queue and waits for the writer to exit, after
+// which the log behaves synchronously. Requests are only ever sent under
+// wal.mutex, so none can be sent once the queue is taken away here
+func (wal *WriteAheadLog) stopAsyncWriter() {
+	wal.mutex.Lock()
+	queue := wal.queue
+	wal.queue = nil
+	wal.mutex.Unlock()
+	if queue == nil {
+		return
+	}
+
+	close(queue)
+	<-wal.writerDone
+}
+
+// queueFlush hands a flush to the async writer and returns the channel its
+// result arrives on, or nil when the log is not in async mode. The caller
+// must hold wal.mutex
+func (wal *WriteAheadLog) queueFlush() <-chan error {
+	if wal.queue == nil {
+		return nil
+	}
+	done := make(chan error, 1)
+	if err := wal.failure(); err != nil {
+		done <- err
+		return done
+	}
+	wal.queue <- walRequest{done: done}
+	return done
+}
+
+// failure returns the error the async writer failed with, or nil
+func (wal *WriteAheadLog) failure() error {
+	if err := wal.failed.Load(); err != nil {
+		return *err
+	}
+	return nil
+}
+
+// runAsyncWriter owns Writer in async mode. It takes whatever requests are
+// waiting on queue, writes them as one batch, syncs once if any of them needs
+// it, then completes them all. The queue is passed in because stopAsyncWriter
+// clears wal.queue before closing it. The first error fails the log: the
+// entries after the failed one already have LSNs, so writing any later entry
+// would leave a hole, and every request from then on gets the same error
+func (wal *WriteAheadLog) runAsyncWriter(queue <-chan walRequest) {
+	defer close(wal.writerDone)
+
+	// lastLSN is the last entry handed to Writer, so a sync covers it
+	var lastLSN uint64
+	for request := range queue {
+		batch := []walRequest{request}
+	drain:
+		for len(batch) < walQueueSize {
+			select {
+			case next, ok := <-queue:
+				if !ok {
+					break drain
+				}
+				batch = append(batch, next)
+			default:
+				break drain
+			}
+		}
+
+		err := wal.failure()
+		sync := false
+		for _, request := range batch {
+			if request.entry == nil {
+				sync = true
+				continue
+			}
+			if err == nil {
+				_, err = wal.Writer.Write(encodeEntry(request.entry))
+				lastLSN = request.entry.LSN
+			}
+			sync = sync || wal.needsSync(request.entry)
+		}
+		if err == nil {
+			if sync {
+				err = wal.flushThrough(lastLSN)
+			} else {
+				err = wal.Writer.Flush()
+			}
+		}
+		if err != nil {
+			wal.failed.CompareAndSwap(nil, &err)
+		}
+
+		for _, request := range batch {
+			request.done <- err
+		}
+	}
+}
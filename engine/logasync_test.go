@@ -0,0 +1,184 @@
+package engine
+
+import (
+	"bufio"
+	"errors"
+	"io"
+	"path/filepath"
+	"slices"
+	"sync"
+	"testing"
+)
+
+// failAfterWriter passes the first left writes through to w and fails the rest
+type failAfterWriter struct {
+	w    io.Writer
+	left int
+}
+
+func (f *failAfterWriter) Write(buffer []byte) (int, error) {
+	if f.left == 0 {
+		return 0, ErrInjectedFault
+	}
+	f.left--
+	return f.w.Write(buffer)
+}
+
+func TestAsyncAppendsAreDurableAndOrdered(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "async.wal")
+	wal, err := NewWriteAheadLog(WriteAheadLogConfig{
+		FilePath:   path,
+		SyncPolicy: SyncOnCommit,
+		Async:      true,
+	})
+	if err != nil {
+		t.Fatalf(`NewWriteAheadLog() got %q wanted nil`, err)
+	}
+
+	const writers, perWriter = 8, 50
+	var wg sync.WaitGroup
+	errs := make(chan error, writers*perWriter)
+	for w := 0; w < writers; w++ {
+		wg.Add(1)
+		go func(txnID uint64) {
+			defer wg.Done()
+			for i := 0; i < perWriter-1; i++ {
+				errs <- wal.Append(&WriteAheadLogEntry{TxnID: txnID, Type: EntryTypeWrite, PageID: PageID(i + 1)})
+			}
+			errs <- <-wal.AppendAsync(&WriteAheadLogEntry{TxnID: txnID, Type: EntryTypeCommit})
+		}(uint64(w + 1))
+	}
+	wg.Wait()
+	close(errs)
+	for err := range errs {
+		if err != nil {
+			t.Fatalf(`Append() got %q wanted nil`, err)
+		}
+	}
+
+	// Every commit has completed, so everything is on disk before Close
+	reader, err := NewWriteAheadLog(WriteAheadLogConfig{FilePath: path})
+	if err != nil {
+		t.Fatalf(`NewWriteAheadLog() got %q wanted nil`, err)
+	}
+	defer reader.Close()
+	entries, err := reader.Replay()
+	if err != nil {
+		t.Fatalf(`Replay() got %q wanted nil`, err)
+	}
+	if len(entries) != writers*perWriter {
+		t.Fatalf(`Replay() returned %d entries; want %d`, len(entries), writers*perWriter)
+	}
+	for i, entry := range entries {
+		if entry.LSN != uint64(i+1) {
+			t.Fatalf(`entry %d has LSN %d; want %d`, i, entry.LSN, i+1)
+		}
+	}
+
+	if err := wal.Close(); err != nil {
+		t.Fatalf(`Close() got %q wanted nil`, err)
+	}
+}
+
+func TestAsyncFlushAndClose(t *testing.T) {
+	wal, err := NewWriteAheadLog(WriteAheadLogConfig{
+		FilePath: filepath.Join(t.TempDir(), "async.wal"),
+		Async:    true,
+	})
+	if err != nil {
+		t.Fatalf(`NewWriteAheadLog() got %q wanted nil`, err)
+	}
+	done := wal.AppendAsync(&WriteAheadLogEntry{TxnID: 1, Type: EntryTypeWrite})
+	if err := wal.Flush(); err != nil {
+		t.Fatalf(`Flush() got %q wanted nil`, err)
+	}
+	if err := <-done; err != nil {
+		t.Fatalf(`AppendAsync() completed with %q wanted nil`, err)
+	}
+	if err := wal.Close(); err != nil {
+		t.Fatalf(`Close() got %q wanted nil`, err)
+	}
+
+}
+
+func TestAsyncFlushDuringClose(t *testing.T) {
+	wal, err := NewWriteAheadLog(WriteAheadLogConfig{
+		FilePath: filepath.Join(t.TempDir(), "async.wal"),
+		Async:    true,
+	})
+	if err != nil {
+		t.Fatalf(`NewWriteAheadLog() got %q wanted nil`, err)
+	}
+
+	var wg sync.WaitGroup
+	errs := make(chan error, 8*20)
+	for w := 0; w < 8; w++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := 0; i < 20; i++ {
+				errs <- wal.Flush()
+			}
+		}()
+	}
+	if err := wal.Close(); err != nil {
+		t.Fatalf(`Close() got %q wanted nil`, err)
+	}
+	wg.Wait()
+	close(errs)
+	for err := range errs {
+		if err != nil && !errors.Is(err, ErrLogClosed) {
+			t.Errorf(`Flush() during Close() got %q wanted nil or ErrLogClosed`, err)
+		}
+	}
+	if err := wal.Flush(); !errors.Is(err, ErrLogClosed) {
+		t.Errorf(`Flush() after Close() got %v wanted ErrLogClosed`, err)
+	}
+}
+
+func TestAsyncWriteErrorFailsLog(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "async.wal")
+	wal, err := NewWriteAheadLog(WriteAheadLogConfig{FilePath: path, Async: true})
+	if err != nil {
+		t.Fatalf(`NewWriteAheadLog() got %q wanted nil`, err)
+	}
+	// Only the first batch reaches the file
+	wal.Writer = bufio.NewWriterSize(&failAfterWriter{w: wal.File, left: 1}, 4*ENTRY_SIZE)
+
+	if err := wal.Append(&WriteAheadLogEntry{TxnID: 1, Type: EntryTypeWrite}); err != nil {
+		t.Fatalf(`Append() got %q wanted nil`, err)
+	}
+	if err := wal.Append(&WriteAheadLogEntry{TxnID: 1, Type: EntryTypeWrite}); !errors.Is(err, ErrInjectedFault) {
+		t.Fatalf(`Append() of the failing batch got %v wanted ErrInjectedFault`, err)
+	}
+	later := &WriteAheadLogEntry{TxnID: 1, Type: EntryTypeCommit}
+	if err := wal.Append(later); !errors.Is(err, ErrInjectedFault) {
+		t.Errorf(`Append() after the failure got %v wanted ErrInjectedFault`, err)
+	}
+	if later.LSN != 0 || wal.LastLSN() != 2 {
+		t.Errorf(`Append() after the failure assigned LSN %d, last LSN %d; want none, 2`, later.LSN, wal.LastLSN())
+	}
+	if err := wal.Flush(); !errors.Is(err, ErrInjectedFault) {
+		t.Errorf(`Flush() after the failure got %v wanted ErrInjectedFault`, err)
+	}
+	if err := wal.Close(); !errors.Is(err, ErrInjectedFault) {
+		t.Errorf(`Close() after the failure got %v wanted ErrInjectedFault`, err)
+	}
+
+	reader, err := NewWriteAheadLog(WriteAheadLogConfig{FilePath: path})
+	if err != nil {
+		t.Fatalf(`NewWriteAheadLog() got %q wanted nil`, err)
+	}
+	defer reader.Close()
+	entries, err := reader.Replay()
+	if err != nil {
+		t.Fatalf(`Replay() got %q wanted nil`, err)
+	}
+	var lsns []uint64
+	for _, entry := range entries {
+		lsns = append(lsns, entry.LSN)
+	}
+	if want := []uint64{1}; !slices.Equal(lsns, want) {
+		t.Errorf(`log after the failure holds LSNs %v; want %v`, lsns, want)
+	}
+}
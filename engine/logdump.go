@@ -0,0 +1,55 @@
+package engine
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"os"
+)
+
+// dumpHexBytes is how many leading bytes of OldData/NewData DumpWAL prints
+const dumpHexBytes = 16
+
+// DumpWAL writes a human-readable listing of every entry in the log at path to
+// w, one line per entry. Entries failing their checksum are flagged CORRUPT
+// and a partial entry at the end of the file is flagged TORN
+func DumpWAL(w io.Writer, path string) error {
+	file, err := os.Open(path)
+	if err != nil {
+		return fmt.Errorf("unable to open log `%s`: %w", path, err)
+	}
+	defer file.Close()
+
+	info, err := file.Stat()
+	if err != nil {
+		return fmt.Errorf("unable to get log file info: %w", err)
+	}
+
+	var count, corrupt int
+	offset := int64(0)
+	for ; offset+int64(ENTRY_SIZE) <= info.Size(); offset += int64(ENTRY_SIZE) {
+		count++
+		entry, err := readEntryAt(file, offset)
+		if errors.Is(err, ErrCorruptEntry) {
+			corrupt++
+			fmt.Fprintf(w, "offset=%d CORRUPT %s\n", offset, formatEntry(entry))
+			continue
+		}
+		if err != nil {
+			return fmt.Errorf("unable to read entry at offset %d: %w", offset, err)
+		}
+		fmt.Fprintf(w, "offset=%d %s\n", offset, formatEntry(entry))
+	}
+
+	if tail := info.Size() - offset; tail > 0 {
+		fmt.Fprintf(w, "offset=%d TORN partial entry of %d bytes\n", offset, tail)
+	}
+	fmt.Fprintf(w, "%d entries, %d corrupt\n", count, corrupt)
+	return nil
+}
+
+func formatEntry(entry *WriteAheadLogEntry) string {
+	return fmt.Sprintf("LSN=%d TxnID=%d Type=%s PageID=%d Offset=%d Old=%x New=%x",
+		entry.LSN, entry.TxnID, entry.Type, entry.PageID, entry.Offset,
+		entry.OldData[:dumpHexBytes], entry.NewData[:dumpHexBytes])
+}
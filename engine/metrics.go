@@ -0,0 +1,205 @@
+package engine
+
+import (
+	"math"
+	"slices"
+	"sync"
+	"time"
+)
+
+// Metrics receives measurements of storage operations. Implementations can
+// bridge to a monitoring system; MemoryMetrics keeps them in memory
+type Metrics interface {
+	// Observe records one value of the named histogram
+	Observe(name string, value float64)
+	// Add increments the named counter by delta
+	Add(name string, delta float64)
+}
+
+// Metric names. Latencies are observed in seconds
+const (
+	MetricWALAppendSeconds = "wal.append.seconds"
+	MetricWALFlushSeconds  = "wal.flush.seconds"
+
+	// Compression counters, for pages of the types a pager compresses and
+	// for the records a heap compresses. Bytes count what was written before
+	// and after compression, with skipped pages and records counted at their
+	// full size on both sides, so their ratio is how much compression saves
+	MetricPageUncompressedBytes    = "pager.compression.uncompressed.bytes"
+	MetricPageCompressedBytes      = "pager.compression.compressed.bytes"
+	MetricPageCompressionSkipped   = "pager.compression.skipped"
+	MetricRecordUncompressedBytes  = "heap.compression.uncompressed.bytes"
+	MetricRecordCompressedBytes    = "heap.compression.compressed.bytes"
+	MetricRecordCompressionSkipped = "heap.compression.skipped"
+)
+
+// LatencyBuckets are the upper bounds, in seconds, of the histogram buckets
+// MemoryMetrics sorts latencies into: 1-2.5-5 steps from a microsecond to ten
+// seconds, and everything slower in a final bucket
+var LatencyBuckets = []float64{
+	1e-6, 2.5e-6, 5e-6,
+	1e-5, 2.5e-5, 5e-5,
+	1e-4, 2.5e-4, 5e-4,
+	1e-3, 2.5e-3, 5e-3,
+	1e-2, 2.5e-2, 5e-2,
+	0.1, 0.25, 0.5,
+	1, 2.5, 5, 10,
+}
+
+type noopMetrics struct{}
+
+func (noopMetrics) Observe(name string, value float64) {}
+
+func (noopMetrics) Add(name string, delta float64) {}
+
+// metricsOrNoop returns metrics, or a Metrics that records nothing when it is
+// nil
+func metricsOrNoop(metrics Metrics) Metrics {
+	if metrics == nil {
+		return noopMetrics{}
+	}
+	return metrics
+}
+
+// recordCompression counts one write of size bytes that compression brought
+// down to stored bytes, or skipped if it would not have shrunk them
+func recordCompression(metrics Metrics, uncompressed, compressed, skipped string, size, stored int) {
+	metrics.Add(uncompressed, float64(size))
+	metrics.Add(compressed, float64(stored))
+	if stored == size {
+		metrics.Add(skipped, 1)
+	}
+}
+
+// observeSince records the time since start in the named histogram
+func observeSince(metrics Metrics, name string, start time.Time) {
+	metrics.Observe(name, time.Since(start).Seconds())
+}
+
+// Histogram is a snapshot of a histogram kept by MemoryMetrics. Counts[i] is
+// the number of values at most Buckets[i] and above the bucket before it;
+// the last count, one past the buckets, holds the values above them all
+type Histogram struct {
+	Buckets []float64
+	Counts  []uint64
+	Count   uint64
+	Sum     float64
+}
+
+// Quantile estimates the q-th quantile, for q between 0 and 1, as the upper
+// bound of the bucket it falls in. Values past the last bucket report +Inf,
+// and an empty histogram reports 0
+func (h Histogram) Quantile(q float64) float64 {
+	if h.Count == 0 {
+		return 0
+	}
+	rank := max(uint64(math.Ceil(q*float64(h.Count))), 1)
+	var seen uint64
+	for i, count := range h.Counts {
+		seen += count
+		if seen >= rank {
+			if i < len(h.Buckets) {
+				return h.Buckets[i]
+			}
+			break
+		}
+	}
+	return math.Inf(1)
+}
+
+// MemoryMetrics is a Metrics that keeps counters and LatencyBuckets
+// histograms in memory. It is safe for concurrent use
+type MemoryMetrics struct {
+	mutex      sync.Mutex
+	counters   map[string]float64
+	histograms map[string]*Histogram
+}
+
+// NewMemoryMetrics returns a MemoryMetrics with nothing recorded
+func NewMemoryMetrics() *MemoryMetrics {
+	return &MemoryMetrics{
+		counters:   make(map[string]float64),
+		histograms: make(map[string]*Histogram),
+	}
+}
+
+func (m *MemoryMetrics) Observe(name string, value float64) {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+
+	histogram, ok := m.histograms[name]
+	if !ok {
+		histogram = &Histogram{
+			Buckets: LatencyBuckets,
+			Counts:  make([]uint64, len(LatencyBuckets)+1),
+		}
+		m.histograms[name] = histogram
+	}
+	bucket, _ := slices.BinarySearch(histogram.Buckets, value)
+	histogram.Counts[bucket]++
+	histogram.Count++
+	histogram.Sum += value
+}
+
+func (m *MemoryMetrics) Add(name string, delta float64) {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+	m.counters[name] += delta
+}
+
+// Histogram returns a snapshot of the named histogram, which is empty if
+// nothing has been observed in it
+func (m *MemoryMetrics) Histogram(name string) Histogram {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+
+	histogram, ok := m.histograms[name]
+	if !ok {
+		return Histogram{Buckets: LatencyBuckets, Counts: make([]uint64, len(LatencyBuckets)+1)}
+	}
+	snapshot := *histogram
+	snapshot.Counts = slices.Clone(histogram.Counts)
+	return snapshot
+}
+
+// Counter returns the value of the named counter
+func (m *MemoryMetrics) Counter(name string) float64 {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+	return m.counters[name]
+}
+
+// CompressionStats is the compression counters of pages or records as a
+// MemoryMetrics recorded them
+type CompressionStats struct {
+	UncompressedBytes float64
+	CompressedBytes   float64
+	Skipped           float64
+}
+
+// Ratio returns the compressed bytes as a fraction of the uncompressed ones,
+// or 1 if nothing has been written
+func (s CompressionStats) Ratio() float64 {
+	if s.UncompressedBytes == 0 {
+		return 1
+	}
+	return s.CompressedBytes / s.UncompressedBytes
+}
+
+// PageCompression returns the counters of page compression
+func (m *MemoryMetrics) PageCompression() CompressionStats {
+	return CompressionStats{
+		UncompressedBytes: m.Counter(MetricPageUncompressedBytes),
+		CompressedBytes:   m.Counter(MetricPageCompressedBytes),
+		Skipped:           m.Counter(MetricPageCompressionSkipped),
+	}
+}
+
+// RecordCompression returns the counters of record compression
+func (m *MemoryMetrics) RecordCompression() CompressionStats {
+	return CompressionStats{
+		UncompressedBytes: m.Counter(MetricRecordUncompressedBytes),
+		CompressedBytes:   m.Counter(MetricRecordCompressedBytes),
+		Skipped:           m.Counter(MetricRecordCompressionSkipped),
+	}
+}
@@ -0,0 +1,74 @@
+package engine
+
+import (
+	"math"
+	"path/filepath"
+	"testing"
+)
+
+func TestWALLatencyHistograms(t *testing.T) {
+	metrics := NewMemoryMetrics()
+	wal, err := NewWriteAheadLog(WriteAheadLogConfig{
+		FilePath: filepath.Join(t.TempDir(), "test.wal"),
+		Metrics:  metrics,
+	})
+	if err != nil {
+		t.Fatalf(`NewWriteAheadLog() got %q wanted nil`, err)
+	}
+	defer wal.Close()
+
+	for i := 0; i < 25; i++ {
+		if err := wal.Append(&WriteAheadLogEntry{TxnID: 1, Type: EntryTypeWrite, PageID: 1}); err != nil {
+			t.Fatalf(`Append() got %q wanted nil`, err)
+		}
+	}
+	if err := wal.Flush(); err != nil {
+		t.Fatalf(`Flush() got %q wanted nil`, err)
+	}
+
+	appends := metrics.Histogram(MetricWALAppendSeconds)
+	if appends.Count != 25 {
+		t.Errorf(`append histogram holds %d observations; want 25`, appends.Count)
+	}
+	var bucketed uint64
+	for _, count := range appends.Counts {
+		bucketed += count
+	}
+	if bucketed != appends.Count {
+		t.Errorf(`append histogram buckets hold %d observations; want %d`, bucketed, appends.Count)
+	}
+	if p50, p99 := appends.Quantile(0.5), appends.Quantile(0.99); p50 <= 0 || p99 < p50 {
+		t.Errorf(`append latency p50 = %g, p99 = %g; want 0 < p50 <= p99`, p50, p99)
+	}
+	if flushes := metrics.Histogram(MetricWALFlushSeconds); flushes.Count != 1 {
+		t.Errorf(`flush histogram holds %d observations; want 1`, flushes.Count)
+	}
+}
+
+func TestHistogramQuantile(t *testing.T) {
+	metrics := NewMemoryMetrics()
+	for i := 0; i < 98; i++ {
+		metrics.Observe("latency", 3e-6)
+	}
+	metrics.Observe("latency", 0.2)
+	metrics.Observe("latency", 60)
+
+	histogram := metrics.Histogram("latency")
+	for _, test := range []struct {
+		q    float64
+		want float64
+	}{
+		{0, 5e-6},
+		{0.5, 5e-6},
+		{0.98, 5e-6},
+		{0.99, 0.25},
+		{1, math.Inf(1)},
+	} {
+		if got := histogram.Quantile(test.q); got != test.want {
+			t.Errorf(`Quantile(%g) = %g; want %g`, test.q, got, test.want)
+		}
+	}
+	if got := metrics.Histogram("missing").Quantile(0.5); got != 0 {
+		t.Errorf(`Quantile() of an empty histogram = %g; want 0`, got)
+	}
+}
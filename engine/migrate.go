@@ -0,0 +1,187 @@
+package engine
+
+import "fmt"
+
+// MovePage moves one page of a plain page chain from srcPager's file to a
+// newly allocated page in dstPager's file. The moved page keeps its contents,
+// its neighbors' NextPageID/PrevPageID links are pointed at its new location,
+// possibly across files, and the source page is freed. pageID may be local to
+// the source file or global; the returned PageID is global.
+//
+// MovePage is not a tablespace rebalancer: it cannot move table data. A heap
+// file lives in one file and finds its pages by local PageID, so its data
+// pages must not be moved, and Database.MovePage refuses them. Overflow and
+// free-space index pages are refused here too, since the records and indexes
+// that point at them are not rewritten. Index pages do not yet store child
+// PageIDs in their bodies, so the header links are the only references
+// updated.
+//
+// A link into another file can only be followed by Database.WalkFrom:
+// Pager.WalkFrom, NextPage, PrevPage and HeapScan read a single file and fail
+// on it. The page's neighbors must live in the source or destination file,
+// and the chain must not be in use while it moves.
+func MovePage(srcPager, dstPager *Pager, pageID PageID) (PageID, error) {
+	srcFile, dstFile := srcPager.fileID, dstPager.fileID
+	if srcPager == dstPager || srcFile == dstFile {
+		return 0, &PagerError{
+			Op:  "MovePage",
+			Err: fmt.Errorf("source and destination are both file %d", srcFile),
+		}
+	}
+	file, local := SplitPageID(pageID)
+	if file != srcFile && file != 0 {
+		return 0, &PagerError{
+			Op:  "MovePage",
+			Err: fmt.Errorf("page %d is in file %d, not source file %d", pageID, file, srcFile),
+		}
+	}
+	if local == 0 {
+		return 0, &PagerError{Op: "MovePage", Err: fmt.Errorf("cannot move the superblock")}
+	}
+
+	page, err := srcPager.ReadPage(local)
+	if err != nil {
+		return 0, &PagerError{
+			Op:  "MovePage",
+			Err: fmt.Errorf("unable to read page %d: %w", local, err),
+		}
+	}
+	switch page.Header.PageType {
+	case PageTypeFree:
+		return 0, &PagerError{
+			Op:  "MovePage",
+			Err: fmt.Errorf("page %d is free", local),
+		}
+	case PageTypeOverflow, PageTypeMetadata:
+		return 0, &PagerError{
+			Op:  "MovePage",
+			Err: fmt.Errorf("page %d has type %d, whose references MovePage cannot rewrite", local, page.Header.PageType),
+		}
+	}
+
+	// Read both neighbors before changing anything, so a neighbor in a third
+	// file fails the move cleanly
+	pagerOf := func(file FileID) *Pager {
+		switch file {
+		case srcFile:
+			return srcPager
+		case dstFile:
+			return dstPager
+		}
+		return nil
+	}
+	prevID := translateLink(srcFile, page.Header.PrevPageID)
+	nextID := translateLink(srcFile, page.Header.NextPageID)
+	var neighbors []*Page
+	var neighborFiles []FileID
+	for _, neighborID := range []PageID{prevID, nextID} {
+		if neighborID == 0 {
+			neighbors = append(neighbors, nil)
+			neighborFiles = append(neighborFiles, 0)
+			continue
+		}
+		file, neighborLocal := SplitPageID(neighborID)
+		pager := pagerOf(file)
+		if pager == nil {
+			return 0, &PagerError{
+				Op:  "MovePage",
+				Err: fmt.Errorf("page %d links to file %d, which is neither source nor destination", local, file),
+			}
+		}
+		neighbor, err := pager.ReadPage(neighborLocal)
+		if err != nil {
+			return 0, &PagerError{
+				Op:  "MovePage",
+				Err: fmt.Errorf("unable to read neighbor %d of page %d: %w", neighborID, local, err),
+			}
+		}
+		neighbors = append(neighbors, neighbor)
+		neighborFiles = append(neighborFiles, file)
+	}
+
+	moved, err := dstPager.AllocatePage(page.Header.PageType)
+	if err != nil {
+		return 0, err
+	}
+	newID := GlobalPageID(dstFile, moved.Header.PageID)
+	header := page.Header
+	header.PageID = moved.Header.PageID
+	header.PrevPageID = translateLink(dstFile, prevID)
+	header.NextPageID = translateLink(dstFile, nextID)
+	moved.Header = header
+	copy(moved.Body, page.Body)
+	// The footer carries the page's key filter, which the header flags as
+	// complete
+	moved.Footer = page.Footer
+	moved.MarkDirty()
+	if err := dstPager.WritePage(moved); err != nil {
+		return 0, err
+	}
+
+	if prev := neighbors[0]; prev != nil {
+		prev.Header.NextPageID = translateLink(neighborFiles[0], newID)
+		prev.MarkDirty()
+		if err := pagerOf(neighborFiles[0]).WritePage(prev); err != nil {
+			return 0, err
+		}
+	}
+	if next := neighbors[1]; next != nil {
+		next.Header.PrevPageID = translateLink(neighborFiles[1], newID)
+		next.MarkDirty()
+		if err := pagerOf(neighborFiles[1]).WritePage(next); err != nil {
+			return 0, err
+		}
+	}
+
+	if err := srcPager.DeallocatePage(local); err != nil {
+		return 0, err
+	}
+	return newID, nil
+}
+
+// MovePage moves the page with the global PageID pageID into the tablespace
+// dst like the package-level MovePage, and like it is no rebalancer. It
+// refuses the pages of the catalog and of the database's tables: a heap file
+// lives in one file and tracks its pages, records and overflow chains by
+// local PageID, so a page moved out of it would leave its free-space index and
+// RIDs pointing at a freed page
+func (db *Database) MovePage(pageID PageID, dst FileID) (PageID, error) {
+	db.mutex.Lock()
+	defer db.mutex.Unlock()
+
+	file, local := SplitPageID(pageID)
+	src, ok := db.tablespaces[file]
+	if !ok {
+		return 0, &PagerError{Op: "MovePage", Err: fmt.Errorf("page %d is in unknown file %d", pageID, file)}
+	}
+	target, ok := db.tablespaces[dst]
+	if !ok {
+		return 0, &PagerError{Op: "MovePage", Err: fmt.Errorf("unknown destination file %d", dst)}
+	}
+
+	var heaps []*HeapFile
+	if file == DefaultTablespace {
+		heaps = append(heaps, db.catalog)
+	}
+	for _, table := range db.tables {
+		if table.Tablespace == file {
+			heaps = append(heaps, table.heap)
+		}
+	}
+	for _, heap := range heaps {
+		owned, err := heap.ownsPage(local)
+		if err != nil {
+			return 0, &PagerError{
+				Op:  "MovePage",
+				Err: fmt.Errorf("unable to check the owner of page %d: %w", pageID, err),
+			}
+		}
+		if owned {
+			return 0, &PagerError{
+				Op:  "MovePage",
+				Err: fmt.Errorf("page %d belongs to a heap file and cannot be moved", pageID),
+			}
+		}
+	}
+	return MovePage(src.pager, target.pager, pageID)
+}
@@ -0,0 +1,228 @@
+package engine
+
+import (
+	"bytes"
+	"slices"
+	"testing"
+)
+
+// walkBodies returns the global PageID and first body byte of every page of
+// the chain from startID
+func walkBodies(t *testing.T, db *Database, startID PageID) ([]PageID, []byte) {
+	t.Helper()
+	var pageIDs []PageID
+	var bodies []byte
+	err := db.WalkFrom(startID, func(pageID PageID, page *Page) error {
+		pageIDs = append(pageIDs, pageID)
+		bodies = append(bodies, page.Body[0])
+		return nil
+	})
+	if err != nil {
+		t.Fatalf(`WalkFrom() got %q wanted nil`, err)
+	}
+	return pageIDs, bodies
+}
+
+func TestMovePageAcrossFiles(t *testing.T) {
+	db := openTestDatabase(t, t.TempDir())
+	defer db.Close()
+
+	second, err := db.CreateTablespace("second")
+	if err != nil {
+		t.Fatalf(`CreateTablespace() got %q wanted nil`, err)
+	}
+	main, _ := db.Tablespace(DefaultTablespace)
+	other, _ := db.Tablespace(second)
+
+	chain := buildChain(t, main.Pager(), 3)
+	for i, page := range chain {
+		page.Body[0] = byte(i + 1)
+		if err := main.Pager().WritePage(page); err != nil {
+			t.Fatalf(`WritePage() got %q wanted nil`, err)
+		}
+	}
+	head, middle, tail := chain[0].Header.PageID, chain[1].Header.PageID, chain[2].Header.PageID
+
+	movedID, err := MovePage(main.Pager(), other.Pager(), middle)
+	if err != nil {
+		t.Fatalf(`MovePage() got %q wanted nil`, err)
+	}
+	if file, _ := SplitPageID(movedID); file != second {
+		t.Errorf(`MovePage() = %d in file %d; want file %d`, movedID, file, second)
+	}
+
+	pageIDs, bodies := walkBodies(t, db, head)
+	if want := []PageID{head, movedID, tail}; !slices.Equal(pageIDs, want) {
+		t.Errorf(`chain after move = %v; want %v`, pageIDs, want)
+	}
+	if !slices.Equal(bodies, []byte{1, 2, 3}) {
+		t.Errorf(`chain bodies after move = %v; want [1 2 3]`, bodies)
+	}
+
+	// The back links lead the same way in reverse
+	last, err := main.Pager().ReadPage(tail)
+	if err != nil {
+		t.Fatalf(`ReadPage() got %q wanted nil`, err)
+	}
+	if prev := translateLink(DefaultTablespace, last.Header.PrevPageID); prev != movedID {
+		t.Errorf(`tail PrevPageID resolves to %d; want %d`, prev, movedID)
+	}
+	_, movedLocal := SplitPageID(movedID)
+	moved, err := other.Pager().ReadPage(movedLocal)
+	if err != nil {
+		t.Fatalf(`ReadPage() got %q wanted nil`, err)
+	}
+	if prev := translateLink(second, moved.Header.PrevPageID); prev != head {
+		t.Errorf(`moved PrevPageID resolves to %d; want %d`, prev, head)
+	}
+
+	free, err := main.Pager().FreePages()
+	if err != nil {
+		t.Fatalf(`FreePages() got %q wanted nil`, err)
+	}
+	if !slices.Contains(free, middle) {
+		t.Errorf(`source page %d is not free after the move`, middle)
+	}
+
+	// Moving it back leaves an ordinary single-file chain
+	backID, err := MovePage(other.Pager(), main.Pager(), movedID)
+	if err != nil {
+		t.Fatalf(`MovePage() back got %q wanted nil`, err)
+	}
+	var local []byte
+	err = main.Pager().WalkFrom(head, func(page *Page) error {
+		local = append(local, page.Body[0])
+		return nil
+	})
+	if err != nil {
+		t.Fatalf(`WalkFrom() got %q wanted nil`, err)
+	}
+	if !slices.Equal(local, []byte{1, 2, 3}) {
+		t.Errorf(`chain bodies after moving page back to %d = %v; want [1 2 3]`, backID, local)
+	}
+}
+
+func TestMovePageKeepsKeyFilter(t *testing.T) {
+	db := openTestDatabase(t, t.TempDir())
+	defer db.Close()
+
+	second, err := db.CreateTablespace("second")
+	if err != nil {
+		t.Fatalf(`CreateTablespace() got %q wanted nil`, err)
+	}
+	main, _ := db.Tablespace(DefaultTablespace)
+	other, _ := db.Tablespace(second)
+
+	page := buildChain(t, main.Pager(), 1)[0]
+	if _, err := page.InsertRecord([]byte("key")); err != nil {
+		t.Fatalf(`InsertRecord() got %q wanted nil`, err)
+	}
+	page.ResetKeyFilter()
+	page.AddKey([]byte("key"))
+	if err := main.Pager().WritePage(page); err != nil {
+		t.Fatalf(`WritePage() got %q wanted nil`, err)
+	}
+
+	movedID, err := MovePage(main.Pager(), other.Pager(), page.Header.PageID)
+	if err != nil {
+		t.Fatalf(`MovePage() got %q wanted nil`, err)
+	}
+	_, movedLocal := SplitPageID(movedID)
+	for _, key := range []string{"key", "absent"} {
+		want := key == "key"
+		got, err := other.Pager().MayContainKey(movedLocal, []byte(key))
+		if err != nil {
+			t.Fatalf(`MayContainKey() got %q wanted nil`, err)
+		}
+		if got != want {
+			t.Errorf(`MayContainKey(%q) on the moved page = %t; want %t`, key, got, want)
+		}
+	}
+}
+
+func TestDatabaseMovePageRefusesHeapPages(t *testing.T) {
+	db := openTestDatabase(t, t.TempDir())
+	defer db.Close()
+
+	second, err := db.CreateTablespace("second")
+	if err != nil {
+		t.Fatalf(`CreateTablespace() got %q wanted nil`, err)
+	}
+	table, err := db.CreateTable("users", nil)
+	if err != nil {
+		t.Fatalf(`CreateTable() got %q wanted nil`, err)
+	}
+	rid, err := table.Insert([]byte("alice"))
+	if err != nil {
+		t.Fatalf(`Insert() got %q wanted nil`, err)
+	}
+	spilled, err := table.Insert(bytes.Repeat([]byte("b"), 2*MaxRecordSize))
+	if err != nil {
+		t.Fatalf(`Insert() got %q wanted nil`, err)
+	}
+	spilledPage, err := db.tablespaces[DefaultTablespace].pager.ReadPage(spilled.PageID)
+	if err != nil {
+		t.Fatalf(`ReadPage() got %q wanted nil`, err)
+	}
+	stub, _ := spilledPage.Record(spilled.Slot)
+	locator, err := DecodeLOBLocator(stub)
+	if err != nil {
+		t.Fatalf(`DecodeLOBLocator() got %q wanted nil`, err)
+	}
+
+	for name, pageID := range map[string]PageID{
+		"table page":    rid.PageID,
+		"overflow page": locator.FirstPageID,
+		"catalog page":  catalogHeadPageID,
+	} {
+		if _, err := db.MovePage(pageID, second); err == nil {
+			t.Errorf(`MovePage() of a %s got nil wanted error`, name)
+		}
+	}
+
+	// The table carries on as before
+	if _, err := table.Insert([]byte("bob")); err != nil {
+		t.Fatalf(`Insert() after refused MovePage() got %q wanted nil`, err)
+	}
+	got, err := table.Get(rid)
+	if err != nil {
+		t.Fatalf(`Get() got %q wanted nil`, err)
+	}
+	if string(got) != "alice" {
+		t.Errorf(`Get(%v) = %q; want "alice"`, rid, got)
+	}
+	if _, err := table.Get(spilled); err != nil {
+		t.Errorf(`Get() of the spilled record got %q wanted nil`, err)
+	}
+
+	// A chain no heap owns moves
+	main, _ := db.Tablespace(DefaultTablespace)
+	page := buildChain(t, main.Pager(), 1)[0]
+	if _, err := db.MovePage(page.Header.PageID, second); err != nil {
+		t.Errorf(`MovePage() of a free-standing page got %q wanted nil`, err)
+	}
+}
+
+func TestMovePageRefusesReferencedPageTypes(t *testing.T) {
+	db := openTestDatabase(t, t.TempDir())
+	defer db.Close()
+
+	second, err := db.CreateTablespace("second")
+	if err != nil {
+		t.Fatalf(`CreateTablespace() got %q wanted nil`, err)
+	}
+	main, _ := db.Tablespace(DefaultTablespace)
+	other, _ := db.Tablespace(second)
+	for _, pageType := range []PageType{PageTypeOverflow, PageTypeMetadata} {
+		page, err := main.Pager().AllocatePage(pageType)
+		if err != nil {
+			t.Fatalf(`AllocatePage() got %q wanted nil`, err)
+		}
+		if _, err := MovePage(main.Pager(), other.Pager(), page.Header.PageID); err == nil {
+			t.Errorf(`MovePage() of a page of type %d got nil wanted error`, pageType)
+		}
+		if _, err := main.Pager().ReadPage(page.Header.PageID); err != nil {
+			t.Errorf(`ReadPage() of the refused page got %q wanted nil`, err)
+		}
+	}
+}
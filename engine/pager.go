@@ -1,10 +1,19 @@
 package engine
 
 import (
+	"bytes"
+	"cmp"
+	"container/list"
+	"context"
 	"encoding/binary"
+	"errors"
 	"fmt"
+	"hash/crc32"
+	"maps"
 	"os"
+	"slices"
 	"sync"
+	"time"
 )
 
 const (
@@ -24,6 +33,19 @@ const (
 	PageTypeIndex
 	PageTypeMetadata
 	PageTypeOverflow
+	PageTypeFree
+)
+
+// valid reports whether t is one of the defined page types
+func (t PageType) valid() bool {
+	return t <= PageTypeFree
+}
+
+var (
+	ErrChecksumMismatch = errors.New("checksum mismatch")
+	ErrReadOnly         = errors.New("pager is read-only")
+	ErrInvalidHeader    = errors.New("invalid page header")
+	ErrTornPage         = errors.New("torn page")
 )
 
 type PageHeader struct {
@@ -34,35 +56,129 @@ type PageHeader struct {
 	FreeSpace   uint32
 	Checksum    uint32
 	PageType    PageType
-	_           [27]byte
+	Flags       uint8
+	_           [2]byte
+	// PageLSN is the LSN of the last logged change applied to the page
+	PageLSN uint64
+	_       [16]byte
 }
 
 type PageFooter struct {
 	Checksum      uint32
 	PageIntegrity uint32
-	_             [24]byte
+	// KeyFilter and its checksum hold the page's key filter when
+	// Header.Flags marks one, see bloom.go, and are otherwise zero
+	KeyFilter         [keyFilterSize]byte
+	KeyFilterChecksum uint32
 }
 
 type Page struct {
 	Header PageHeader
 	Body   []byte
 	Footer PageFooter
-	dirty  bool
-	_      [7]byte
+	elem   *list.Element
+	// recLSN is the LSN of the first logged change since the page was last
+	// clean, or 0 when it is clean or was dirtied without an LSN
+	recLSN uint64
+	// pins counts PinPage calls not yet matched by UnpinPage; a pinned page
+	// is never evicted
+	pins  int
+	dirty bool
+	_     [7]byte
 }
 
 type Pager struct {
-	file       *os.File
-	mutex      sync.RWMutex
-	pageCache  map[PageID]*Page
-	maxPages   int
-	nextPageID PageID
+	file         pageFile
+	mutex        sync.RWMutex
+	pageCache    map[PageID]*Page
+	lru          *list.List
+	maxPages     int
+	nextPageID   PageID
+	freeListHead PageID
+	readOnly     bool
+	// fileID is the pager's file within a multi-file database, see
+	// tablespace.go
+	fileID      FileID
+	tracer      Tracer
+	compression map[PageType]Compression
+	// Cache counters and adaptive sizing state, see cache.go
+	cacheHits      uint64
+	cacheMisses    uint64
+	adaptive       bool
+	minPages       int
+	maxPagesCap    int
+	windowHits     int
+	windowAccesses int
+	memoryPressure func() bool
+	superblock     superblock
+	// superblockDirty is set when the allocator state has changed since the
+	// superblock was last written
+	superblockDirty  bool
+	checksummer      Checksummer
+	subPageWrites    bool
+	secureDeallocate bool
+	wal              LogFlusher
+	onEvict          func(pageID PageID, dirty bool)
+	// heat counts page accesses when access tracking is on, see heatmap.go
+	heat *heatmap
+	// Readahead state, see readahead.go
+	readaheadMax int
+	pattern      accessPattern
+	prefetched   uint64
+	metrics      Metrics
+}
+
+// LogFlusher is the write-ahead log a pager must keep ahead of its writes.
+// FlushTo returns once every entry up to and including lsn is durable
+type LogFlusher interface {
+	FlushTo(lsn uint64) error
 }
 
 type PagerConfig struct {
 	FilePath     string
 	MaxCacheSize int
 	ReadOnly     bool
+	// Tracer receives a span for each traced operation; nil disables tracing
+	Tracer Tracer
+	// Faults injects I/O failures into the backing file, for testing
+	Faults *FaultConfig
+	// Compression selects the codec each page type is stored with; types
+	// without an entry are stored uncompressed
+	Compression map[PageType]Compression
+	// AdaptiveCache lets the cache grow from MaxCacheSize up to
+	// AdaptiveCacheCap pages while the hit rate is poor, and shrink back
+	// under memory pressure
+	AdaptiveCache    bool
+	AdaptiveCacheCap int
+	// MemoryPressure overrides how adaptive sizing detects memory pressure;
+	// by default it compares the heap to the runtime's soft memory limit
+	MemoryPressure func() bool
+	// Checksum selects the page checksum algorithm for a new file. Existing
+	// files keep the algorithm recorded in their superblock
+	Checksum ChecksumAlgorithm
+	// SubPageWrites declares that the backing store persists writes smaller
+	// than a page atomically, letting WritePageRange skip unchanged bytes
+	SubPageWrites bool
+	// SecureDeallocate zeroes the on-disk body of deallocated pages so
+	// deleted records can't be recovered from the raw file
+	SecureDeallocate bool
+	// WAL, when set, is flushed up to a page's PageLSN before the page is
+	// written, so no page reaches disk ahead of the log describing it
+	WAL LogFlusher
+	// OnEvict is called just before a page leaves the cache through eviction,
+	// after it has been written back if it was dirty. It runs with the pager
+	// locked and must not call back into the pager
+	OnEvict func(pageID PageID, dirty bool)
+	// TrackAccess counts the reads and writes of each page for Heatmap. The
+	// counts halve every AccessDecay, or every minute if it is not set
+	TrackAccess bool
+	AccessDecay time.Duration
+	// Readahead is the most pages read into the cache ahead of a sequential
+	// or strided scan once one is detected; 0 disables readahead
+	Readahead int
+	// Metrics receives the pager's compression counters, and those of the
+	// heaps built on it; nil records nothing
+	Metrics Metrics
 }
 
 // NewPager() creates a new pager based on specifics of the PagerConfig
@@ -75,6 +191,9 @@ func NewPager(config PagerConfig) (*Pager, error) {
 			Err: fmt.Errorf("filepath cannot be empty"),
 		}
 	}
+	if err := config.validate(); err != nil {
+		return nil, &PagerError{Op: "NewPager", Err: err}
+	}
 
 	var file *os.File
 	if config.ReadOnly {
@@ -94,14 +213,105 @@ func NewPager(config PagerConfig) (*Pager, error) {
 			}
 		}
 	}
+	return newPager(osFile{file}, config)
+}
+
+// NewMemoryPager creates a pager whose pages live in memory rather than in a
+// file. It behaves like a pager from NewPager, but nothing reaches disk and the
+// contents are discarded on Close. config.FilePath is only used as a name
+func NewMemoryPager(config PagerConfig) (*Pager, error) {
+	if err := config.validate(); err != nil {
+		return nil, &PagerError{Op: "NewPager", Err: err}
+	}
+	name := config.FilePath
+	if len(name) == 0 {
+		name = ":memory:"
+	}
+	return newPager(newMemFile(name), config)
+}
+
+// validate rejects settings a pager cannot work with and options that
+// contradict each other. Page size is fixed, so only the cache and the
+// optional features are checked
+func (config PagerConfig) validate() error {
+	if config.MaxCacheSize <= 0 {
+		return fmt.Errorf("MaxCacheSize must be positive, got %d", config.MaxCacheSize)
+	}
+	if config.AdaptiveCache && config.AdaptiveCacheCap < config.MaxCacheSize {
+		return fmt.Errorf("AdaptiveCacheCap %d is below MaxCacheSize %d", config.AdaptiveCacheCap, config.MaxCacheSize)
+	}
+	if config.Readahead < 0 {
+		return fmt.Errorf("Readahead cannot be negative, got %d", config.Readahead)
+	}
+	if config.AccessDecay < 0 {
+		return fmt.Errorf("AccessDecay cannot be negative, got %s", config.AccessDecay)
+	}
+	if _, err := config.Checksum.checksummer(); err != nil {
+		return err
+	}
+	for pageType, codec := range config.Compression {
+		if !pageType.valid() {
+			return fmt.Errorf("compression configured for unknown page type %d", pageType)
+		}
+		if codec > CompressionLZW {
+			return fmt.Errorf("unknown compression codec %d for page type %d", codec, pageType)
+		}
+	}
+	if config.ReadOnly {
+		switch {
+		case config.SecureDeallocate:
+			return fmt.Errorf("SecureDeallocate needs to write deallocated pages and cannot be used with ReadOnly")
+		case config.WAL != nil:
+			return fmt.Errorf("a WAL protects page writes and cannot be used with ReadOnly")
+		}
+	}
+	return nil
+}
+
+// newPager wraps an opened backing file in a Pager and loads its superblock,
+// closing the file if that fails
+func newPager(file pageFile, config PagerConfig) (*Pager, error) {
 	cache := make(map[PageID]*Page, config.MaxCacheSize)
+	memoryPressure := config.MemoryPressure
+	if memoryPressure == nil {
+		memoryPressure = heapUnderPressure
+	}
 	pager := &Pager{
-		file:       file,
-		pageCache:  cache,
-		maxPages:   config.MaxCacheSize,
-		nextPageID: 1,
+		file:             file,
+		pageCache:        cache,
+		lru:              list.New(),
+		maxPages:         config.MaxCacheSize,
+		nextPageID:       1,
+		readOnly:         config.ReadOnly,
+		tracer:           tracerOrNoop(config.Tracer),
+		compression:      maps.Clone(config.Compression),
+		adaptive:         config.AdaptiveCache,
+		minPages:         config.MaxCacheSize,
+		maxPagesCap:      max(config.MaxCacheSize, config.AdaptiveCacheCap),
+		memoryPressure:   memoryPressure,
+		subPageWrites:    config.SubPageWrites,
+		secureDeallocate: config.SecureDeallocate,
+		wal:              config.WAL,
+		onEvict:          config.OnEvict,
+		readaheadMax:     config.Readahead,
+		metrics:          metricsOrNoop(config.Metrics),
+	}
+	if config.TrackAccess {
+		pager.heat = newHeatmap(config.AccessDecay)
 	}
 
+	if err := pager.loadSuperblock(config); err != nil {
+		file.Close()
+		return nil, &PagerError{
+			Op:  "NewPager",
+			Err: fmt.Errorf("unable to load superblock of `%s`: %w", file.Name(), err),
+		}
+	}
+
+	// Faults are injected only once the file is open
+	if config.Faults != nil {
+		pager.file = newFaultFile(file, *config.Faults)
+	}
 	return pager, nil
 }
 
@@ -110,6 +320,7 @@ func (p *Pager) Close() error {
 	flushErr := p.FlushAll()
 	closeErr := p.file.Close()
 	p.pageCache = make(map[PageID]*Page, p.maxPages)
+	p.lru.Init()
 
 	if flushErr != nil {
 		return &PagerError{
@@ -128,24 +339,70 @@ func (p *Pager) Close() error {
 	return nil
 }
 
-// ReadPage reads a page from disk by PageID
+// ReadPage reads a page by PageID, serving it from the cache when possible.
+// The *Page returned is the cached copy every other caller shares. The
+// goroutine that owns a page may change it without further locking and hand it
+// back with WritePage, as HeapFile does, as long as nothing else uses the page
+// meanwhile and the cached copy is clean. Eviction, FlushAll and Backup encode
+// dirty cached pages at any time, so a page left dirty by MarkDirty must not
+// be changed while other goroutines use the pager
 func (p *Pager) ReadPage(pageID PageID) (*Page, error) {
-	if pageID > PageID(p.maxPages) {
+	return p.ReadPageContext(context.Background(), pageID)
+}
+
+// ReadPageContext is ReadPage with a context used to parent its trace span
+func (p *Pager) ReadPageContext(ctx context.Context, pageID PageID) (*Page, error) {
+	_, span := p.tracer.StartSpan(ctx, "pager.ReadPage")
+	span.SetAttribute("page.id", uint64(pageID))
+
+	p.mutex.Lock()
+	page, err := p.readPage(pageID)
+	p.mutex.Unlock()
+
+	span.End(err)
+	return page, err
+}
+
+// readPage is ReadPage without locking; the caller must hold p.mutex
+func (p *Pager) readPage(pageID PageID) (*Page, error) {
+	if pageID == 0 {
 		return nil, &PagerError{
 			Op:  "ReadPage",
-			Err: fmt.Errorf("unable to read page: %d", pageID),
+			Err: fmt.Errorf("page 0 is reserved"),
 		}
 	}
+	p.recordHeat(pageID)
+
+	if page, ok := p.pageCache[pageID]; ok {
+		p.lru.MoveToFront(page.elem)
+		p.recordAccess(true)
+		p.readahead(pageID)
+		return page, nil
+	}
+	p.recordAccess(false)
+
+	page, err := p.readPageFromDisk(pageID)
+	if err != nil {
+		return nil, err
+	}
+	if err := p.cachePage(page); err != nil {
+		return nil, err
+	}
+	p.readahead(pageID)
+	return page, nil
+}
 
+// readPageFromDisk reads and validates a page, bypassing the cache
+func (p *Pager) readPageFromDisk(pageID PageID) (*Page, error) {
 	offset := int64(pageID) * PageSize
-	file_info, errStat := p.file.Stat()
+	fileSize, errStat := p.file.Size()
 	if errStat != nil {
 		return nil, &PagerError{
 			Op:  "ReadPage",
 			Err: fmt.Errorf("unable to get file info: %w", errStat),
 		}
 	}
-	if offset > file_info.Size() {
+	if offset+PageSize > fileSize {
 		return nil, &PagerError{
 			Op:  "ReadPage",
 			Err: fmt.Errorf("out of bounds of file: %d", pageID),
@@ -162,42 +419,89 @@ func (p *Pager) ReadPage(pageID PageID) (*Page, error) {
 		}
 	}
 
-	// Partition the buffer
-	headerComponent, errHeader := parseHeader(buffer)
-	if errHeader != nil {
+	page, errDecode := decodePage(buffer, p.checksummer)
+	if errDecode != nil {
 		return nil, &PagerError{
 			Op:  "ReadPage",
-			Err: fmt.Errorf("error reading header component for page %d: %w", pageID, errHeader),
+			Err: fmt.Errorf("page %d failed validation: %w", pageID, errDecode),
 		}
 	}
-	footerComponent, errFooter := parseFooter(buffer)
-	if errFooter != nil {
-		return nil, &PagerError{
-			Op:  "ReadPage",
-			Err: fmt.Errorf("error reading footer component for page %d: %w", pageID, errFooter),
+	return page, nil
+}
+
+// cachePage inserts a page into the cache, evicting the least recently used
+// page if the cache is full. The caller must hold p.mutex
+func (p *Pager) cachePage(page *Page) error {
+	pageID := page.Header.PageID
+	if cached, ok := p.pageCache[pageID]; ok {
+		if cached == page {
+			p.lru.MoveToFront(page.elem)
+			return nil
 		}
+		// The new copy takes over the old one's pins
+		page.pins = cached.pins
+		p.lru.Remove(cached.elem)
+		delete(p.pageCache, pageID)
 	}
 
-	bodyComponent := buffer[HeaderSize : HeaderSize+MaxBodySize]
-	if len(bodyComponent) != MaxBodySize {
-		return nil, &PagerError{
-			Op:  "ReadPage",
-			Err: fmt.Errorf("error reading body component for page %d: %w", pageID, errFooter),
+	// When every cached page is pinned the cache grows past its limit
+	for p.maxPages > 0 && len(p.pageCache) >= p.maxPages {
+		evicted, err := p.evictPage()
+		if err != nil {
+			return err
+		}
+		if !evicted {
+			break
 		}
 	}
 
-	page := &Page{
-		Header: headerComponent,
-		Body:   bodyComponent,
-		Footer: footerComponent,
-		dirty:  false,
+	page.elem = p.lru.PushFront(page)
+	p.pageCache[pageID] = page
+	return nil
+}
+
+// evictPage removes the least recently used unpinned page from the cache,
+// writing it back first if it is dirty, and reports whether there was one to
+// evict. The caller must hold p.mutex
+func (p *Pager) evictPage() (bool, error) {
+	elem := p.lru.Back()
+	for elem != nil && elem.Value.(*Page).pins > 0 {
+		elem = elem.Prev()
+	}
+	if elem == nil {
+		return false, nil
+	}
+	victim := elem.Value.(*Page)
+	dirty := victim.dirty
+	if dirty {
+		if err := p.writePage(victim); err != nil {
+			return false, err
+		}
 	}
+	if p.onEvict != nil {
+		p.onEvict(victim.Header.PageID, dirty)
+	}
+	p.dropPage(victim.Header.PageID)
+	return true, nil
+}
 
-	return page, nil
+// dropPage removes a page from the cache without writing it back. The caller
+// must hold p.mutex
+func (p *Pager) dropPage(pageID PageID) {
+	if page, ok := p.pageCache[pageID]; ok {
+		p.lru.Remove(page.elem)
+		page.elem = nil
+		delete(p.pageCache, pageID)
+	}
 }
 
+// parseHeader decodes the header at the start of a page image, rejecting
+// headers whose fields are out of range or inconsistent with each other
 func parseHeader(buffer []byte) (PageHeader, error) {
 	var header PageHeader
+	if len(buffer) < HeaderSize {
+		return header, fmt.Errorf("%w: header needs %d bytes, got %d", ErrInvalidHeader, HeaderSize, len(buffer))
+	}
 	header.PageID = PageID(binary.LittleEndian.Uint64(buffer[0:8]))
 	header.NextPageID = PageID(binary.LittleEndian.Uint64(buffer[8:16]))
 	header.PrevPageID = PageID(binary.LittleEndian.Uint64(buffer[16:24]))
@@ -205,44 +509,620 @@ func parseHeader(buffer []byte) (PageHeader, error) {
 	header.FreeSpace = binary.LittleEndian.Uint32(buffer[28:32])
 	header.Checksum = binary.LittleEndian.Uint32(buffer[32:36])
 	header.PageType = PageType(buffer[36])
+	if !header.PageType.valid() {
+		return header, fmt.Errorf("%w: unknown page type %d", ErrInvalidHeader, header.PageType)
+	}
+	header.Flags = buffer[37]
+	header.PageLSN = binary.LittleEndian.Uint64(buffer[40:48])
+
+	if header.FreeSpace > MaxBodySize {
+		return header, fmt.Errorf("%w: free space %d exceeds body size %d", ErrInvalidHeader, header.FreeSpace, MaxBodySize)
+	}
+	if header.PageType == PageTypeData {
+		if used := uint64(header.RecordCount)*slotSize + uint64(header.FreeSpace); used > MaxBodySize {
+			return header, fmt.Errorf("%w: %d slots and %d bytes free exceed body size %d",
+				ErrInvalidHeader, header.RecordCount, header.FreeSpace, MaxBodySize)
+		}
+	}
 	return header, nil
 }
 
+// parseFooter decodes the footer at the end of a full page image
 func parseFooter(buffer []byte) (PageFooter, error) {
 	var footer PageFooter
+	if len(buffer) < PageSize {
+		return footer, fmt.Errorf("footer needs a %d byte page, got %d bytes", PageSize, len(buffer))
+	}
 	footerStart := HeaderSize + MaxBodySize
 	footer.Checksum = binary.LittleEndian.Uint32(buffer[footerStart : footerStart+4])
 	footer.PageIntegrity = binary.LittleEndian.Uint32(buffer[footerStart+4 : footerStart+8])
+	copy(footer.KeyFilter[:], buffer[footerStart+8:footerStart+8+keyFilterSize])
+	footer.KeyFilterChecksum = binary.LittleEndian.Uint32(buffer[footerStart+FooterSize-4 : footerStart+FooterSize])
 	return footer, nil
 }
 
-// WritePage writes a page to disk
+func serializeHeader(buffer []byte, header PageHeader) {
+	binary.LittleEndian.PutUint64(buffer[0:8], uint64(header.PageID))
+	binary.LittleEndian.PutUint64(buffer[8:16], uint64(header.NextPageID))
+	binary.LittleEndian.PutUint64(buffer[16:24], uint64(header.PrevPageID))
+	binary.LittleEndian.PutUint32(buffer[24:28], header.RecordCount)
+	binary.LittleEndian.PutUint32(buffer[28:32], header.FreeSpace)
+	binary.LittleEndian.PutUint32(buffer[32:36], header.Checksum)
+	buffer[36] = byte(header.PageType)
+	buffer[37] = header.Flags
+	binary.LittleEndian.PutUint64(buffer[40:48], header.PageLSN)
+}
+
+// serializeFooter writes the whole footer into the last FooterSize bytes of a
+// page image
+func serializeFooter(buffer []byte, footer PageFooter) {
+	footerStart := HeaderSize + MaxBodySize
+	binary.LittleEndian.PutUint32(buffer[footerStart:footerStart+4], footer.Checksum)
+	binary.LittleEndian.PutUint32(buffer[footerStart+4:footerStart+8], footer.PageIntegrity)
+	copy(buffer[footerStart+8:footerStart+8+keyFilterSize], footer.KeyFilter[:])
+	binary.LittleEndian.PutUint32(buffer[footerStart+FooterSize-4:footerStart+FooterSize], footer.KeyFilterChecksum)
+}
+
+// encodePage computes a page's checksum and footer and returns its on-disk
+// image with the body stored under codec. The checksum always covers the
+// uncompressed body
+func encodePage(page *Page, codec Compression, checksummer Checksummer) ([]byte, error) {
+	page.Header.Checksum = checksummer.Checksum(page.Body)
+
+	stored, used, err := compressBody(page.Body, codec)
+	if err != nil {
+		return nil, fmt.Errorf("unable to compress page %d: %w", page.Header.PageID, err)
+	}
+	page.Header.Flags = page.Header.Flags&^flagCompressionMask | uint8(used)
+
+	buffer := make([]byte, PageSize)
+	serializeHeader(buffer, page.Header)
+	copy(buffer[HeaderSize:HeaderSize+MaxBodySize], stored)
+	page.Footer = footerFor(page, buffer[:HeaderSize])
+	serializeFooter(buffer, page.Footer)
+	return buffer, nil
+}
+
+// footerFor returns the footer to write with a page, given its serialized
+// header with an up to date checksum. The footer repeats the checksum, so a
+// write torn between the header and the end of the page leaves the two
+// disagreeing, and its PageIntegrity hashes the header, which through the
+// checksum also binds the body. A key filter carries its own checksum
+func footerFor(page *Page, header []byte) PageFooter {
+	footer := page.Footer
+	footer.Checksum = page.Header.Checksum
+	footer.PageIntegrity = pageIntegrity(header)
+	footer.KeyFilterChecksum = 0
+	if page.HasKeyFilter() {
+		footer.KeyFilterChecksum = keyFilterChecksum(footer.KeyFilter)
+	}
+	return footer
+}
+
+// pageIntegrity is the PageIntegrity of a page with the given serialized
+// header. It always uses CRC32C, whatever the file's checksum algorithm
+func pageIntegrity(header []byte) uint32 {
+	return crc32.Checksum(header[:HeaderSize], checksumTable)
+}
+
+// checkFooter reports ErrTornPage when a page's footer does not match its
+// header, and ErrChecksumMismatch when its key filter is damaged. Pages
+// written before footers were filled in have an all-zero footer and are let
+// through
+func checkFooter(header PageHeader, headerBytes []byte, footer PageFooter) error {
+	if footer == (PageFooter{}) {
+		return nil
+	}
+	if footer.Checksum != header.Checksum {
+		return fmt.Errorf("%w: header checksum %08x, footer checksum %08x", ErrTornPage, header.Checksum, footer.Checksum)
+	}
+	if integrity := pageIntegrity(headerBytes); footer.PageIntegrity != integrity {
+		return fmt.Errorf("%w: stored page integrity %08x, computed %08x", ErrTornPage, footer.PageIntegrity, integrity)
+	}
+	return checkKeyFilter(header, footer)
+}
+
+// decodePage is the inverse of encodePage: it parses a full page image,
+// decompresses its body and verifies the footer and the body checksum
+func decodePage(buffer []byte, checksummer Checksummer) (*Page, error) {
+	if len(buffer) != PageSize {
+		return nil, fmt.Errorf("page image must be %d bytes, got %d", PageSize, len(buffer))
+	}
+	header, err := parseHeader(buffer)
+	if err != nil {
+		return nil, err
+	}
+	footer, err := parseFooter(buffer)
+	if err != nil {
+		return nil, err
+	}
+	if err := checkFooter(header, buffer[:HeaderSize], footer); err != nil {
+		return nil, err
+	}
+	codec := Compression(header.Flags & flagCompressionMask)
+	body, err := decompressBody(buffer[HeaderSize:HeaderSize+MaxBodySize], codec, MaxBodySize)
+	if err != nil {
+		return nil, err
+	}
+	if checksum := checksummer.Checksum(body); checksum != header.Checksum {
+		return nil, fmt.Errorf("%w: stored %08x, computed %08x", ErrChecksumMismatch, header.Checksum, checksum)
+	}
+	return &Page{
+		Header: header,
+		Body:   bytes.Clone(body),
+		Footer: footer,
+	}, nil
+}
+
+// SerializePage returns the full PageSize byte image of a page as an
+// uncompressed, CRC32C-checksummed file stores it, first updating the page's
+// header checksum and footer
+func SerializePage(page *Page) ([]byte, error) {
+	if len(page.Body) != MaxBodySize {
+		return nil, &PagerError{
+			Op:  "SerializePage",
+			Err: fmt.Errorf("invalid body size for page %d: %d", page.Header.PageID, len(page.Body)),
+		}
+	}
+	buffer, err := encodePage(page, CompressionNone, crc32cChecksummer{})
+	if err != nil {
+		return nil, &PagerError{Op: "SerializePage", Err: err}
+	}
+	return buffer, nil
+}
+
+// DeserializePage decodes a page image produced by SerializePage, verifying its
+// footer and CRC32C body checksum
+func DeserializePage(buffer []byte) (*Page, error) {
+	page, err := decodePage(buffer, crc32cChecksummer{})
+	if err != nil {
+		return nil, &PagerError{Op: "DeserializePage", Err: err}
+	}
+	return page, nil
+}
+
+// encodePage encodes a page with the pager's compression and checksum settings
+func (p *Pager) encodePage(page *Page) ([]byte, error) {
+	return encodePage(page, p.compression[page.Header.PageType], p.checksummer)
+}
+
+// writePageImage writes a raw page image, as stored in the WAL, over a page
+// and drops any cached copy of it. The caller must hold p.mutex
+func (p *Pager) writePageImage(pageID PageID, image []byte) error {
+	if p.readOnly {
+		return &PagerError{Op: "WritePageImage", Err: ErrReadOnly}
+	}
+	if pageID == 0 || len(image) != PageSize {
+		return &PagerError{
+			Op:  "WritePageImage",
+			Err: fmt.Errorf("invalid image of %d bytes for page %d", len(image), pageID),
+		}
+	}
+	if _, err := p.file.WriteAt(image, int64(pageID)*PageSize); err != nil {
+		return &PagerError{
+			Op:  "WritePageImage",
+			Err: fmt.Errorf("unable to write page %d: %w", pageID, err),
+		}
+	}
+	p.dropPage(pageID)
+	if pageID >= p.nextPageID {
+		p.nextPageID = pageID + 1
+		p.superblockDirty = true
+	}
+	return nil
+}
+
+// WritePage writes a page to disk and syncs the file
 func (p *Pager) WritePage(page *Page) error {
-	// TODO: Implement page writing with ACID compliance
+	return p.WritePageContext(context.Background(), page)
+}
+
+// WritePageContext is WritePage with a context used to parent its trace span
+func (p *Pager) WritePageContext(ctx context.Context, page *Page) (err error) {
+	_, span := p.tracer.StartSpan(ctx, "pager.WritePage")
+	span.SetAttribute("page.id", uint64(page.Header.PageID))
+	defer func() { span.End(err) }()
+
+	p.mutex.Lock()
+	defer p.mutex.Unlock()
+
+	if err := p.writePage(page); err != nil {
+		return err
+	}
+	if err := p.file.Sync(); err != nil {
+		return &PagerError{
+			Op:  "WritePage",
+			Err: fmt.Errorf("unable to sync file: %w", err),
+		}
+	}
+	return p.cachePage(page)
+}
+
+// WritePageRange writes only the header, footer and the body bytes in
+// [offset, offset+length) of a page, for small changes to a page whose other
+// bytes already match what is on disk. It falls back to a full WritePage when
+// the file isn't configured for sub-page writes or the page is compressed,
+// since a compressed body can't be patched in place
+func (p *Pager) WritePageRange(page *Page, offset uint32, length uint32) error {
+	if uint64(offset)+uint64(length) > MaxBodySize {
+		return &PagerError{
+			Op:  "WritePageRange",
+			Err: fmt.Errorf("range [%d, %d) exceeds page body", offset, uint64(offset)+uint64(length)),
+		}
+	}
+
+	p.mutex.Lock()
+	defer p.mutex.Unlock()
+
+	codec := p.compression[page.Header.PageType]
+	storedCodec := Compression(page.Header.Flags & flagCompressionMask)
+	if !p.subPageWrites || codec != CompressionNone || storedCodec != CompressionNone {
+		if err := p.writePage(page); err != nil {
+			return err
+		}
+	} else {
+		if p.readOnly {
+			return &PagerError{Op: "WritePageRange", Err: ErrReadOnly}
+		}
+		if err := p.flushLogFor("WritePageRange", page.Header.PageLSN); err != nil {
+			return err
+		}
+		if page.Header.PageID == 0 || len(page.Body) != MaxBodySize {
+			return &PagerError{
+				Op:  "WritePageRange",
+				Err: fmt.Errorf("invalid page %d", page.Header.PageID),
+			}
+		}
+
+		page.Header.Checksum = p.checksummer.Checksum(page.Body)
+		header := make([]byte, HeaderSize)
+		serializeHeader(header, page.Header)
+		footer := make([]byte, PageSize)
+		page.Footer = footerFor(page, header)
+		serializeFooter(footer, page.Footer)
+		footer = footer[HeaderSize+MaxBodySize:]
+
+		pageOffset := int64(page.Header.PageID) * PageSize
+		if _, err := p.file.WriteAt(page.Body[offset:offset+length], pageOffset+HeaderSize+int64(offset)); err != nil {
+			return &PagerError{
+				Op:  "WritePageRange",
+				Err: fmt.Errorf("unable to write body range of page %d: %w", page.Header.PageID, err),
+			}
+		}
+		if _, err := p.file.WriteAt(footer, pageOffset+HeaderSize+MaxBodySize); err != nil {
+			return &PagerError{
+				Op:  "WritePageRange",
+				Err: fmt.Errorf("unable to write footer of page %d: %w", page.Header.PageID, err),
+			}
+		}
+		if _, err := p.file.WriteAt(header, pageOffset); err != nil {
+			return &PagerError{
+				Op:  "WritePageRange",
+				Err: fmt.Errorf("unable to write header of page %d: %w", page.Header.PageID, err),
+			}
+		}
+		page.markClean()
+		p.recordHeat(page.Header.PageID)
+	}
+
+	if err := p.file.Sync(); err != nil {
+		return &PagerError{
+			Op:  "WritePageRange",
+			Err: fmt.Errorf("unable to sync file: %w", err),
+		}
+	}
+	return p.cachePage(page)
+}
+
+// writePage serializes a page and writes it at its offset without syncing.
+// The caller must hold p.mutex
+func (p *Pager) writePage(page *Page) error {
+	return p.writePages("WritePage", []*Page{page})
+}
+
+// WritePages writes a batch of pages and syncs the file once. Pages are
+// written in PageID order, and runs of contiguous PageIDs are coalesced into a
+// single write
+func (p *Pager) WritePages(pages []*Page) error {
+	p.mutex.Lock()
+	defer p.mutex.Unlock()
+
+	if err := p.writePages("WritePages", pages); err != nil {
+		return err
+	}
+	if err := p.file.Sync(); err != nil {
+		return &PagerError{
+			Op:  "WritePages",
+			Err: fmt.Errorf("unable to sync file: %w", err),
+		}
+	}
+	for _, page := range pages {
+		if err := p.cachePage(page); err != nil {
+			return err
+		}
+	}
 	return nil
 }
 
-// AllocatePage allocates a new page and returns its PageID
+// writePages serializes pages and writes them without syncing, coalescing
+// contiguous PageIDs. A failed write is reported against the first page it
+// did not fully persist. The caller must hold p.mutex
+func (p *Pager) writePages(op string, pages []*Page) error {
+	if p.readOnly {
+		return &PagerError{Op: op, Err: ErrReadOnly}
+	}
+
+	sorted := slices.Clone(pages)
+	slices.SortFunc(sorted, func(a, b *Page) int {
+		return cmp.Compare(a.Header.PageID, b.Header.PageID)
+	})
+	for i, page := range sorted {
+		if page.Header.PageID == 0 {
+			return &PagerError{
+				Op:  op,
+				Err: fmt.Errorf("page 0 is reserved"),
+			}
+		}
+		if len(page.Body) != MaxBodySize {
+			return &PagerError{
+				Op:  op,
+				Err: fmt.Errorf("invalid body size for page %d: %d", page.Header.PageID, len(page.Body)),
+			}
+		}
+		if i > 0 && sorted[i-1].Header.PageID == page.Header.PageID {
+			return &PagerError{
+				Op:  op,
+				Err: fmt.Errorf("page %d appears more than once", page.Header.PageID),
+			}
+		}
+	}
+
+	var maxLSN uint64
+	for _, page := range sorted {
+		maxLSN = max(maxLSN, page.Header.PageLSN)
+	}
+	if err := p.flushLogFor(op, maxLSN); err != nil {
+		return err
+	}
+
+	for start := 0; start < len(sorted); {
+		end := start + 1
+		for end < len(sorted) && sorted[end].Header.PageID == sorted[end-1].Header.PageID+1 {
+			end++
+		}
+		run := sorted[start:end]
+
+		buffer := make([]byte, 0, len(run)*PageSize)
+		for _, page := range run {
+			image, err := p.encodePage(page)
+			if err != nil {
+				return &PagerError{Op: op, Err: err}
+			}
+			buffer = append(buffer, image...)
+		}
+
+		offset := int64(run[0].Header.PageID) * PageSize
+		if n, err := p.file.WriteAt(buffer, offset); err != nil {
+			failed := run[min(n/PageSize, len(run)-1)].Header.PageID
+			return &PagerError{
+				Op:  op,
+				Err: fmt.Errorf("unable to write page %d: %w", failed, err),
+			}
+		}
+		for i, page := range run {
+			page.markClean()
+			p.recordHeat(page.Header.PageID)
+			p.recordPageCompression(page, buffer[i*PageSize:(i+1)*PageSize])
+		}
+		start = end
+	}
+	return nil
+}
+
+// flushLogFor makes the log durable up to lsn before a page carrying that
+// PageLSN is written. The caller must hold p.mutex
+func (p *Pager) flushLogFor(op string, lsn uint64) error {
+	if p.wal == nil || lsn == 0 {
+		return nil
+	}
+	if err := p.wal.FlushTo(lsn); err != nil {
+		return &PagerError{
+			Op:  op,
+			Err: fmt.Errorf("unable to flush log to LSN %d: %w", lsn, err),
+		}
+	}
+	return nil
+}
+
+// AllocatePage allocates a new page, reusing a page from the free list when
+// one is available, and returns it. The page always comes back with a zeroed
+// body and fresh header and footer, and is written that way before it is
+// returned, so nothing from a recycled page's previous life survives
 func (p *Pager) AllocatePage(pageType PageType) (*Page, error) {
-	// TODO: Implement page allocation
-	return nil, nil
+	p.mutex.Lock()
+	defer p.mutex.Unlock()
+
+	if p.readOnly {
+		return nil, &PagerError{Op: "AllocatePage", Err: ErrReadOnly}
+	}
+	if !pageType.valid() {
+		return nil, &PagerError{
+			Op:  "AllocatePage",
+			Err: fmt.Errorf("unknown page type %d", pageType),
+		}
+	}
+
+	var pageID PageID
+	freeListHead, nextPageID := p.freeListHead, p.nextPageID
+	if p.freeListHead != 0 {
+		// The old page is only consulted for its free list link
+		freePage, err := p.readPageFromDisk(p.freeListHead)
+		if err != nil {
+			return nil, &PagerError{
+				Op:  "AllocatePage",
+				Err: fmt.Errorf("unable to read free list head: %w", err),
+			}
+		}
+		pageID = p.freeListHead
+		p.freeListHead = freePage.Header.NextPageID
+		p.dropPage(pageID)
+	} else {
+		pageID = p.nextPageID
+		p.nextPageID++
+	}
+	p.superblockDirty = true
+
+	page := NewPage(pageType)
+	page.Header.PageID = pageID
+	if err := p.writePage(page); err != nil {
+		p.freeListHead, p.nextPageID = freeListHead, nextPageID
+		return nil, err
+	}
+	if err := p.cachePage(page); err != nil {
+		return nil, err
+	}
+	return page, nil
 }
 
-// DeallocatePage marks a page as free for reuse
+// DeallocatePage marks a page as free for reuse by pushing it onto the free
+// list. The old body stays on disk until the page is reused unless
+// PagerConfig.SecureDeallocate is set, in which case it is zeroed
 func (p *Pager) DeallocatePage(pageID PageID) error {
-	// TODO: Implement page deallocation
+	p.mutex.Lock()
+	defer p.mutex.Unlock()
+
+	if p.readOnly {
+		return &PagerError{Op: "DeallocatePage", Err: ErrReadOnly}
+	}
+
+	page, err := p.readPage(pageID)
+	if err != nil {
+		return &PagerError{
+			Op:  "DeallocatePage",
+			Err: fmt.Errorf("unable to read page %d: %w", pageID, err),
+		}
+	}
+	if page.Header.PageType == PageTypeFree {
+		return &PagerError{
+			Op:  "DeallocatePage",
+			Err: fmt.Errorf("page %d is already free", pageID),
+		}
+	}
+	if page.pins > 0 {
+		return &PagerError{
+			Op:  "DeallocatePage",
+			Err: fmt.Errorf("page %d is pinned", pageID),
+		}
+	}
+
+	// Free pages are chained through NextPageID
+	if p.secureDeallocate {
+		clear(page.Body)
+		page.Header.FreeSpace = MaxBodySize
+	}
+	page.Header.PageType = PageTypeFree
+	page.Header.NextPageID = p.freeListHead
+	page.Header.PrevPageID = 0
+	page.Header.RecordCount = 0
+	if err := p.writePage(page); err != nil {
+		return err
+	}
+	p.freeListHead = pageID
+	p.superblockDirty = true
+	p.dropPage(pageID)
+
+	if pageID == p.nextPageID-1 {
+		return p.shrinkFreeTail()
+	}
 	return nil
 }
 
 // FlushPage forces a page to be written to disk
 func (p *Pager) FlushPage(pageID PageID) error {
-	// TODO: Implement page flushing
+	p.mutex.Lock()
+	defer p.mutex.Unlock()
+
+	page, ok := p.pageCache[pageID]
+	if !ok || !page.dirty {
+		return nil
+	}
+	if err := p.writePage(page); err != nil {
+		return err
+	}
+	if err := p.file.Sync(); err != nil {
+		return &PagerError{
+			Op:  "FlushPage",
+			Err: fmt.Errorf("unable to sync file: %w", err),
+		}
+	}
 	return nil
 }
 
-// FlushAll flushes all dirty pages to disk
+// FlushAll flushes all dirty pages to disk in PageID order
 func (p *Pager) FlushAll() error {
-	// TODO: Implement full cache flush
+	return p.FlushAllContext(context.Background())
+}
+
+// FlushAllContext is FlushAll with a context used to parent its trace span
+func (p *Pager) FlushAllContext(ctx context.Context) (err error) {
+	_, span := p.tracer.StartSpan(ctx, "pager.FlushAll")
+	defer func() { span.End(err) }()
+
+	p.mutex.Lock()
+	defer p.mutex.Unlock()
+
+	var dirty []*Page
+	for _, page := range p.pageCache {
+		if page.dirty {
+			dirty = append(dirty, page)
+		}
+	}
+	if len(dirty) > 0 {
+		if err := p.writePages("FlushAll", dirty); err != nil {
+			return err
+		}
+		if err := p.file.Sync(); err != nil {
+			return &PagerError{
+				Op:  "FlushAll",
+				Err: fmt.Errorf("unable to sync file: %w", err),
+			}
+		}
+	}
+
+	// The allocator state goes last so it never refers to unwritten pages
+	if p.superblockDirty {
+		if err := p.writeSuperblock(); err != nil {
+			return &PagerError{Op: "FlushAll", Err: err}
+		}
+	}
+	return nil
+}
+
+// ForEachPage calls fn on every page in the file after the superblock, in
+// PageID order, including free pages. Cached pages are passed as the cached
+// copy; others are read from disk without being cached, so a full pass does not
+// flush the cache's working set. The pager is not locked while fn runs, and the
+// walk stops at the first error
+func (p *Pager) ForEachPage(fn func(*Page) error) error {
+	p.mutex.RLock()
+	end := p.nextPageID
+	p.mutex.RUnlock()
+
+	for pageID := PageID(1); pageID < end; pageID++ {
+		p.mutex.RLock()
+		page, ok := p.pageCache[pageID]
+		var err error
+		if !ok {
+			page, err = p.readPageFromDisk(pageID)
+		}
+		p.mutex.RUnlock()
+		if err != nil {
+			return err
+		}
+		if err := fn(page); err != nil {
+			return err
+		}
+	}
 	return nil
 }
 
@@ -257,14 +1137,69 @@ func (p *Pager) GetPageCount() uint64 {
 
 // ValidatePage validates the integrity of a page using checksums
 func (p *Pager) ValidatePage(page *Page) error {
-	// TODO: Implement page validation
+	if len(page.Body) != MaxBodySize {
+		return fmt.Errorf("invalid body size: %d", len(page.Body))
+	}
+	if checksum := p.checksummer.Checksum(page.Body); checksum != page.Header.Checksum {
+		return fmt.Errorf("%w: stored %08x, computed %08x", ErrChecksumMismatch, page.Header.Checksum, checksum)
+	}
 	return nil
 }
 
+// MarkDirty flags a page as modified so it is written back on flush or eviction
+func (page *Page) MarkDirty() {
+	page.dirty = true
+}
+
+// MarkDirtyLSN flags a page as modified by the logged change with the given
+// LSN, advancing its PageLSN. The first such change since the page was clean
+// becomes its recLSN
+func (page *Page) MarkDirtyLSN(lsn uint64) {
+	if !page.dirty || page.recLSN == 0 {
+		page.recLSN = lsn
+	}
+	page.dirty = true
+	page.Header.PageLSN = max(page.Header.PageLSN, lsn)
+}
+
+// IsDirty reports whether a page has unflushed modifications
+func (page *Page) IsDirty() bool {
+	return page.dirty
+}
+
+// RecLSN returns the LSN of the first logged change that dirtied the page
+// since it was last written, or 0 if there is none
+func (page *Page) RecLSN() uint64 {
+	return page.recLSN
+}
+
+func (page *Page) markClean() {
+	page.dirty = false
+	page.recLSN = 0
+}
+
+// DirtyPageTable returns the recLSN of every cached dirty page that has one.
+// The smallest of them is the earliest LSN redo could need after a crash
+func (p *Pager) DirtyPageTable() map[PageID]uint64 {
+	p.mutex.RLock()
+	defer p.mutex.RUnlock()
+
+	table := make(map[PageID]uint64)
+	for pageID, page := range p.pageCache {
+		if page.dirty && page.recLSN != 0 {
+			table[pageID] = page.recLSN
+		}
+	}
+	return table
+}
+
 // NewPage creates a new page with the given type
 func NewPage(pageType PageType) *Page {
 	return &Page{
-		Header: PageHeader{},
+		Header: PageHeader{
+			PageType:  pageType,
+			FreeSpace: MaxBodySize,
+		},
 		Body:   make([]byte, MaxBodySize),
 		Footer: PageFooter{},
 		dirty:  false,
@@ -280,3 +1215,7 @@ type PagerError struct {
 func (e *PagerError) Error() string {
 	return e.Op + ": " + e.Err.Error()
 }
+
+func (e *PagerError) Unwrap() error {
+	return e.Err
+}
@@ -1,6 +1,13 @@
 package engine
 
 import (
+	"bytes"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
 	"testing"
 )
 
@@ -11,9 +18,9 @@ var TestConfigurations PagerConfig = PagerConfig{
 }
 
 func TestPager(t *testing.T) {
-	pager, err := NewPager(TestConfigurations)
+	pager, err := NewMemoryPager(TestConfigurations)
 	if err != nil {
-		t.Errorf(`NewPager(TestConfigurations) got %q wanted nil`, err)
+		t.Errorf(`NewMemoryPager(TestConfigurations) got %q wanted nil`, err)
 	}
 
 	if pager.file.Name() != TestConfigurations.FilePath {
@@ -31,3 +38,868 @@ func TestCreatePage(t *testing.T) {
 		t.Errorf(`NewPage(page_type) is nil`)
 	}
 }
+
+func TestNewPagerRejectsInvalidConfig(t *testing.T) {
+	tests := []struct {
+		name   string
+		config PagerConfig
+		want   string
+	}{
+		{"zero cache", PagerConfig{}, "MaxCacheSize must be positive"},
+		{"negative cache", PagerConfig{MaxCacheSize: -1}, "MaxCacheSize must be positive"},
+		{"adaptive cap below cache", PagerConfig{MaxCacheSize: 10, AdaptiveCache: true, AdaptiveCacheCap: 5}, "AdaptiveCacheCap 5"},
+		{"negative readahead", PagerConfig{MaxCacheSize: 10, Readahead: -1}, "Readahead cannot be negative"},
+		{"negative access decay", PagerConfig{MaxCacheSize: 10, TrackAccess: true, AccessDecay: -1}, "AccessDecay cannot be negative"},
+		{"unknown checksum", PagerConfig{MaxCacheSize: 10, Checksum: 99}, "unknown checksum algorithm"},
+		{"unknown codec", PagerConfig{MaxCacheSize: 10, Compression: map[PageType]Compression{PageTypeData: 9}}, "unknown compression codec"},
+		{"unknown page type", PagerConfig{MaxCacheSize: 10, Compression: map[PageType]Compression{42: CompressionFlate}}, "unknown page type"},
+		{"read-only secure deallocate", PagerConfig{MaxCacheSize: 10, ReadOnly: true, SecureDeallocate: true}, "SecureDeallocate"},
+		{"read-only WAL", PagerConfig{MaxCacheSize: 10, ReadOnly: true, WAL: newTestWAL(t)}, "WAL"},
+	}
+	for _, test := range tests {
+		test.config.FilePath = filepath.Join(t.TempDir(), "test.db")
+		pager, err := NewPager(test.config)
+		var pagerErr *PagerError
+		if !errors.As(err, &pagerErr) || pagerErr.Op != "NewPager" {
+			if pager != nil {
+				pager.Close()
+			}
+			t.Errorf(`NewPager() with %s got %v wanted a NewPager error`, test.name, err)
+			continue
+		}
+		if !strings.Contains(err.Error(), test.want) {
+			t.Errorf(`NewPager() with %s got %q; want it to mention %q`, test.name, err, test.want)
+		}
+		if _, err := os.Stat(test.config.FilePath); !os.IsNotExist(err) {
+			t.Errorf(`NewPager() with %s created %s`, test.name, test.config.FilePath)
+		}
+		if _, err := NewMemoryPager(test.config); err == nil {
+			t.Errorf(`NewMemoryPager() with %s got nil wanted error`, test.name)
+		}
+	}
+}
+
+func TestMemoryPagerRoundTrip(t *testing.T) {
+	pager, err := NewMemoryPager(PagerConfig{MaxCacheSize: 2})
+	if err != nil {
+		t.Fatalf(`NewMemoryPager() got %q wanted nil`, err)
+	}
+	defer pager.Close()
+
+	var pageIDs []PageID
+	for i := 0; i < 5; i++ {
+		page, err := pager.AllocatePage(PageTypeData)
+		if err != nil {
+			t.Fatalf(`AllocatePage() got %q wanted nil`, err)
+		}
+		page.Body[0] = byte(i + 1)
+		if err := pager.WritePage(page); err != nil {
+			t.Fatalf(`WritePage() got %q wanted nil`, err)
+		}
+		pageIDs = append(pageIDs, page.Header.PageID)
+	}
+	if got := pager.GetPageCount(); got > 2 {
+		t.Errorf(`cached pages = %d; want at most MaxCacheSize 2`, got)
+	}
+
+	// Every page has been evicted at least once, so these come from memory
+	for i, pageID := range pageIDs {
+		page, err := pager.ReadPage(pageID)
+		if err != nil {
+			t.Fatalf(`ReadPage(%d) got %q wanted nil`, pageID, err)
+		}
+		if page.Body[0] != byte(i+1) {
+			t.Errorf(`page %d body[0] = %d; want %d`, pageID, page.Body[0], i+1)
+		}
+	}
+
+	if err := pager.DeallocatePage(pageIDs[2]); err != nil {
+		t.Fatalf(`DeallocatePage() got %q wanted nil`, err)
+	}
+	page, err := pager.AllocatePage(PageTypeIndex)
+	if err != nil {
+		t.Fatalf(`AllocatePage() got %q wanted nil`, err)
+	}
+	if page.Header.PageID != pageIDs[2] {
+		t.Errorf(`AllocatePage() after free = %d; want reuse of %d`, page.Header.PageID, pageIDs[2])
+	}
+}
+
+// newTestPager opens an in-memory pager that is closed when the test ends
+func newTestPager(t *testing.T) *Pager {
+	t.Helper()
+	pager, err := NewMemoryPager(PagerConfig{MaxCacheSize: 100})
+	if err != nil {
+		t.Fatalf(`NewMemoryPager() got %q wanted nil`, err)
+	}
+	t.Cleanup(func() { pager.Close() })
+	return pager
+}
+
+// countingFile records the writes reaching a pageFile
+type countingFile struct {
+	pageFile
+	writes       int
+	bytesWritten int
+}
+
+func (f *countingFile) WriteAt(buffer []byte, offset int64) (int, error) {
+	f.writes++
+	f.bytesWritten += len(buffer)
+	return f.pageFile.WriteAt(buffer, offset)
+}
+
+// countWrites wraps a pager's file so the test can observe its writes
+func countWrites(pager *Pager) *countingFile {
+	counter := &countingFile{pageFile: pager.file}
+	pager.file = counter
+	return counter
+}
+
+func TestWritePageRange(t *testing.T) {
+	for _, subPage := range []bool{true, false} {
+		pager, err := NewMemoryPager(PagerConfig{MaxCacheSize: 10, SubPageWrites: subPage})
+		if err != nil {
+			t.Fatalf(`NewMemoryPager() got %q wanted nil`, err)
+		}
+		page, err := pager.AllocatePage(PageTypeData)
+		if err != nil {
+			t.Fatalf(`AllocatePage() got %q wanted nil`, err)
+		}
+
+		counter := countWrites(pager)
+		copy(page.Body[100:], "patched")
+		if err := pager.WritePageRange(page, 100, 7); err != nil {
+			t.Fatalf(`WritePageRange() got %q wanted nil`, err)
+		}
+		if subPage && counter.bytesWritten >= PageSize {
+			t.Errorf(`sub-page write wrote %d bytes; want less than a page`, counter.bytesWritten)
+		}
+		if !subPage && counter.bytesWritten != PageSize {
+			t.Errorf(`fallback write wrote %d bytes; want a full page`, counter.bytesWritten)
+		}
+
+		read, err := pager.readPageFromDisk(page.Header.PageID)
+		if err != nil {
+			t.Fatalf(`readPageFromDisk() got %q wanted nil`, err)
+		}
+		if got := string(read.Body[100:107]); got != "patched" {
+			t.Errorf(`body[100:107] = %q; want "patched"`, got)
+		}
+		pager.Close()
+	}
+}
+
+func TestWritePagesCoalescesContiguousPages(t *testing.T) {
+	newPagerWithPages := func() (*Pager, []*Page) {
+		pager, err := NewMemoryPager(PagerConfig{MaxCacheSize: 20})
+		if err != nil {
+			t.Fatalf(`NewMemoryPager() got %q wanted nil`, err)
+		}
+		var pages []*Page
+		for i := 0; i < 10; i++ {
+			page, err := pager.AllocatePage(PageTypeData)
+			if err != nil {
+				t.Fatalf(`AllocatePage() got %q wanted nil`, err)
+			}
+			page.Body[0] = byte(i + 1)
+			pages = append(pages, page)
+		}
+		return pager, pages
+	}
+
+	batched, batchedPages := newPagerWithPages()
+	defer batched.Close()
+	batchedCounter := countWrites(batched)
+	// Order must not matter
+	shuffled := []*Page{batchedPages[9], batchedPages[0]}
+	shuffled = append(shuffled, batchedPages[1:9]...)
+	if err := batched.WritePages(shuffled); err != nil {
+		t.Fatalf(`WritePages() got %q wanted nil`, err)
+	}
+
+	single, singlePages := newPagerWithPages()
+	defer single.Close()
+	singleCounter := countWrites(single)
+	for _, page := range singlePages {
+		if err := single.WritePage(page); err != nil {
+			t.Fatalf(`WritePage() got %q wanted nil`, err)
+		}
+	}
+
+	if batchedCounter.writes != 1 {
+		t.Errorf(`WritePages() issued %d writes; want 1`, batchedCounter.writes)
+	}
+	if singleCounter.writes != 10 {
+		t.Errorf(`WritePage() x10 issued %d writes; want 10`, singleCounter.writes)
+	}
+	batchedData := batched.file.(*countingFile).pageFile.(*memFile).data
+	singleData := single.file.(*countingFile).pageFile.(*memFile).data
+	if !bytes.Equal(batchedData, singleData) {
+		t.Errorf(`WritePages() produced different bytes than individual writes`)
+	}
+}
+
+func TestWritePagesIdentifiesFailedPage(t *testing.T) {
+	// The fourth write is the batch; it persists one and a half pages
+	pager, err := NewMemoryPager(PagerConfig{
+		MaxCacheSize: 10,
+		Faults:       &FaultConfig{TornWriteN: 4, TornWriteBytes: PageSize + PageSize/2},
+	})
+	if err != nil {
+		t.Fatalf(`NewMemoryPager() got %q wanted nil`, err)
+	}
+	defer pager.Close()
+
+	var pages []*Page
+	for i := 0; i < 3; i++ {
+		page, err := pager.AllocatePage(PageTypeData)
+		if err != nil {
+			t.Fatalf(`AllocatePage() got %q wanted nil`, err)
+		}
+		pages = append(pages, page)
+	}
+
+	err = pager.WritePages(pages)
+	if !errors.Is(err, ErrInjectedFault) || !strings.Contains(err.Error(), fmt.Sprintf("page %d", pages[1].Header.PageID)) {
+		t.Errorf(`WritePages() got %v; want an injected fault naming page %d`, err, pages[1].Header.PageID)
+	}
+}
+
+func TestAllocateRecycledPageIsZeroed(t *testing.T) {
+	pager := newTestPager(t)
+
+	page, err := pager.AllocatePage(PageTypeData)
+	if err != nil {
+		t.Fatalf(`AllocatePage() got %q wanted nil`, err)
+	}
+	neighbor, err := pager.AllocatePage(PageTypeData)
+	if err != nil {
+		t.Fatalf(`AllocatePage() got %q wanted nil`, err)
+	}
+	for i := range page.Body {
+		page.Body[i] = 0xAA
+	}
+	page.Header.NextPageID = neighbor.Header.PageID
+	page.Header.PrevPageID = neighbor.Header.PageID
+	page.Header.RecordCount = 9
+	page.Header.FreeSpace = 1
+	page.Footer.PageIntegrity = 0xDEADBEEF
+	if err := pager.WritePage(page); err != nil {
+		t.Fatalf(`WritePage() got %q wanted nil`, err)
+	}
+	if err := pager.DeallocatePage(page.Header.PageID); err != nil {
+		t.Fatalf(`DeallocatePage() got %q wanted nil`, err)
+	}
+
+	recycled, err := pager.AllocatePage(PageTypeIndex)
+	if err != nil {
+		t.Fatalf(`AllocatePage() got %q wanted nil`, err)
+	}
+	if recycled.Header.PageID != page.Header.PageID {
+		t.Fatalf(`AllocatePage() = %d; want recycled page %d`, recycled.Header.PageID, page.Header.PageID)
+	}
+
+	onDisk, err := pager.readPageFromDisk(recycled.Header.PageID)
+	if err != nil {
+		t.Fatalf(`readPageFromDisk() got %q wanted nil`, err)
+	}
+	for _, got := range []*Page{recycled, onDisk} {
+		if !bytes.Equal(got.Body, make([]byte, MaxBodySize)) {
+			t.Errorf(`recycled body is not all zero`)
+		}
+		want := PageHeader{
+			PageID:    recycled.Header.PageID,
+			FreeSpace: MaxBodySize,
+			Checksum:  got.Header.Checksum,
+			PageType:  PageTypeIndex,
+		}
+		if got.Header != want {
+			t.Errorf(`recycled header = %+v; want %+v`, got.Header, want)
+		}
+		if got.Footer.PageIntegrity == 0xDEADBEEF {
+			t.Errorf(`recycled footer kept the old page's PageIntegrity`)
+		}
+		if got.Footer.Checksum != 0 && got.Footer.Checksum != got.Header.Checksum {
+			t.Errorf(`recycled footer checksum = %08x; want 0 or header checksum %08x`, got.Footer.Checksum, got.Header.Checksum)
+		}
+	}
+}
+
+func TestSecureDeallocateScrubsBody(t *testing.T) {
+	for _, secure := range []bool{true, false} {
+		pager, err := NewMemoryPager(PagerConfig{MaxCacheSize: 10, SecureDeallocate: secure})
+		if err != nil {
+			t.Fatalf(`NewMemoryPager() got %q wanted nil`, err)
+		}
+		page, err := pager.AllocatePage(PageTypeData)
+		if err != nil {
+			t.Fatalf(`AllocatePage() got %q wanted nil`, err)
+		}
+		// Keep a live page after it so the freed page is not truncated away
+		if _, err := pager.AllocatePage(PageTypeData); err != nil {
+			t.Fatalf(`AllocatePage() got %q wanted nil`, err)
+		}
+		secret := []byte("credit card 4111-1111-1111-1111")
+		if _, err := page.InsertRecord(secret); err != nil {
+			t.Fatalf(`InsertRecord() got %q wanted nil`, err)
+		}
+		if err := pager.WritePage(page); err != nil {
+			t.Fatalf(`WritePage() got %q wanted nil`, err)
+		}
+		if err := pager.DeallocatePage(page.Header.PageID); err != nil {
+			t.Fatalf(`DeallocatePage() got %q wanted nil`, err)
+		}
+
+		raw := make([]byte, MaxBodySize)
+		pager.file.ReadAt(raw, int64(page.Header.PageID)*PageSize+HeaderSize)
+		leaked := bytes.Contains(raw, secret)
+		if secure && !bytes.Equal(raw, make([]byte, MaxBodySize)) {
+			t.Errorf(`body after secure deallocation is not all zero`)
+		}
+		if !secure && !leaked {
+			t.Errorf(`body after plain deallocation was rewritten; want it left in place`)
+		}
+		pager.Close()
+	}
+}
+
+func TestDeallocateTrailingPagesTruncatesFile(t *testing.T) {
+	pager := newTestPager(t)
+	for i := 0; i < 8; i++ {
+		if _, err := pager.AllocatePage(PageTypeData); err != nil {
+			t.Fatalf(`AllocatePage() got %q wanted nil`, err)
+		}
+	}
+
+	// Free a page in the middle, then the last three in mixed order
+	for _, pageID := range []PageID{3, 7, 8, 6} {
+		if err := pager.DeallocatePage(pageID); err != nil {
+			t.Fatalf(`DeallocatePage(%d) got %q wanted nil`, pageID, err)
+		}
+	}
+	size, err := pager.file.Size()
+	if err != nil {
+		t.Fatalf(`Size() got %q wanted nil`, err)
+	}
+	if size != 6*PageSize {
+		t.Errorf(`file size = %d; want %d`, size, 6*PageSize)
+	}
+
+	// The middle page is still on the free list and is reused first
+	page, err := pager.AllocatePage(PageTypeData)
+	if err != nil {
+		t.Fatalf(`AllocatePage() got %q wanted nil`, err)
+	}
+	if page.Header.PageID != 3 {
+		t.Errorf(`AllocatePage() = page %d; want recycled page 3`, page.Header.PageID)
+	}
+	page, err = pager.AllocatePage(PageTypeData)
+	if err != nil {
+		t.Fatalf(`AllocatePage() got %q wanted nil`, err)
+	}
+	if page.Header.PageID != 6 {
+		t.Errorf(`AllocatePage() = page %d; want new page 6`, page.Header.PageID)
+	}
+
+	// Freeing everything shrinks the file back to just the superblock
+	for _, pageID := range []PageID{1, 2, 3, 4, 5, 6} {
+		if err := pager.DeallocatePage(pageID); err != nil {
+			t.Fatalf(`DeallocatePage(%d) got %q wanted nil`, pageID, err)
+		}
+	}
+	if size, _ := pager.file.Size(); size != PageSize {
+		t.Errorf(`file size = %d; want %d`, size, PageSize)
+	}
+}
+
+func TestFreePages(t *testing.T) {
+	pager := newTestPager(t)
+	for i := 0; i < 5; i++ {
+		if _, err := pager.AllocatePage(PageTypeData); err != nil {
+			t.Fatalf(`AllocatePage() got %q wanted nil`, err)
+		}
+	}
+
+	free, err := pager.FreePages()
+	if err != nil {
+		t.Fatalf(`FreePages() got %q wanted nil`, err)
+	}
+	if len(free) != 0 {
+		t.Errorf(`FreePages() before deallocating = %v; want none`, free)
+	}
+
+	for _, pageID := range []PageID{2, 4} {
+		if err := pager.DeallocatePage(pageID); err != nil {
+			t.Fatalf(`DeallocatePage(%d) got %q wanted nil`, pageID, err)
+		}
+	}
+	free, err = pager.FreePages()
+	if err != nil {
+		t.Fatalf(`FreePages() got %q wanted nil`, err)
+	}
+	if want := []PageID{4, 2}; !slices.Equal(free, want) {
+		t.Errorf(`FreePages() = %v; want %v`, free, want)
+	}
+}
+
+func TestRecLSN(t *testing.T) {
+	pager := newTestPager(t)
+	page, err := pager.AllocatePage(PageTypeData)
+	if err != nil {
+		t.Fatalf(`AllocatePage() got %q wanted nil`, err)
+	}
+	if page.RecLSN() != 0 {
+		t.Errorf(`RecLSN() of a clean page = %d; want 0`, page.RecLSN())
+	}
+
+	// Only the first change after the page was clean sets its recLSN
+	page.MarkDirtyLSN(10)
+	page.MarkDirtyLSN(12)
+	if page.RecLSN() != 10 {
+		t.Errorf(`RecLSN() = %d; want 10`, page.RecLSN())
+	}
+	if page.Header.PageLSN != 12 {
+		t.Errorf(`PageLSN = %d; want 12`, page.Header.PageLSN)
+	}
+	if table := pager.DirtyPageTable(); len(table) != 1 || table[page.Header.PageID] != 10 {
+		t.Errorf(`DirtyPageTable() = %v; want map[%d:10]`, table, page.Header.PageID)
+	}
+
+	if err := pager.FlushAll(); err != nil {
+		t.Fatalf(`FlushAll() got %q wanted nil`, err)
+	}
+	if page.IsDirty() || page.RecLSN() != 0 {
+		t.Errorf(`after flush (dirty %t, RecLSN %d); want (false, 0)`, page.IsDirty(), page.RecLSN())
+	}
+	if table := pager.DirtyPageTable(); len(table) != 0 {
+		t.Errorf(`DirtyPageTable() after flush = %v; want empty`, table)
+	}
+
+	page.MarkDirtyLSN(15)
+	if page.RecLSN() != 15 {
+		t.Errorf(`RecLSN() after redirtying = %d; want 15`, page.RecLSN())
+	}
+}
+
+// spyLog records the LSNs a pager asks it to flush to, and how many page
+// writes had reached the file at the time
+type spyLog struct {
+	counter       *countingFile
+	flushedTo     []uint64
+	writesAtFlush []int
+}
+
+func (l *spyLog) FlushTo(lsn uint64) error {
+	l.flushedTo = append(l.flushedTo, lsn)
+	l.writesAtFlush = append(l.writesAtFlush, l.counter.writes)
+	return nil
+}
+
+func TestFlushPageFlushesLogFirst(t *testing.T) {
+	spy := &spyLog{}
+	pager, err := NewMemoryPager(PagerConfig{MaxCacheSize: 10, WAL: spy})
+	if err != nil {
+		t.Fatalf(`NewMemoryPager() got %q wanted nil`, err)
+	}
+	defer pager.Close()
+
+	page, err := pager.AllocatePage(PageTypeData)
+	if err != nil {
+		t.Fatalf(`AllocatePage() got %q wanted nil`, err)
+	}
+	if len(spy.flushedTo) != 0 {
+		t.Errorf(`allocating a page without a PageLSN flushed the log to %v`, spy.flushedTo)
+	}
+
+	spy.counter = countWrites(pager)
+	page.Body[0] = 1
+	page.MarkDirtyLSN(7)
+	if err := pager.FlushPage(page.Header.PageID); err != nil {
+		t.Fatalf(`FlushPage() got %q wanted nil`, err)
+	}
+	if !slices.Equal(spy.flushedTo, []uint64{7}) {
+		t.Errorf(`log flushed to %v; want [7]`, spy.flushedTo)
+	}
+	if !slices.Equal(spy.writesAtFlush, []int{0}) {
+		t.Errorf(`page writes before the log flush = %v; want [0]`, spy.writesAtFlush)
+	}
+	if spy.counter.writes != 1 {
+		t.Errorf(`FlushPage() made %d writes; want 1`, spy.counter.writes)
+	}
+}
+
+func FuzzParseHeader(f *testing.F) {
+	image, err := encodePage(NewPage(PageTypeData), CompressionNone, crc32cChecksummer{})
+	if err != nil {
+		f.Fatalf(`encodePage() got %q wanted nil`, err)
+	}
+	f.Add(image[:HeaderSize])
+	f.Add(image[:HeaderSize-1])
+	f.Add([]byte{})
+	f.Fuzz(func(t *testing.T, buffer []byte) {
+		header, err := parseHeader(buffer)
+		if len(buffer) < HeaderSize {
+			if err == nil {
+				t.Errorf(`parseHeader() of %d bytes got nil wanted error`, len(buffer))
+			}
+			return
+		}
+		if err != nil {
+			return
+		}
+
+		// Whatever parses must serialize back to the same header bytes
+		reencoded := make([]byte, HeaderSize)
+		serializeHeader(reencoded, header)
+		again, err := parseHeader(reencoded)
+		if err != nil || again != header {
+			t.Errorf(`parseHeader() of reserialized header = (%+v, %v); want (%+v, nil)`, again, err, header)
+		}
+	})
+}
+
+func FuzzParseFooter(f *testing.F) {
+	image, err := encodePage(NewPage(PageTypeData), CompressionNone, crc32cChecksummer{})
+	if err != nil {
+		f.Fatalf(`encodePage() got %q wanted nil`, err)
+	}
+	f.Add(image)
+	f.Add(image[:PageSize-1])
+	f.Add([]byte{})
+	f.Fuzz(func(t *testing.T, buffer []byte) {
+		_, err := parseFooter(buffer)
+		if len(buffer) < PageSize && err == nil {
+			t.Errorf(`parseFooter() of %d bytes got nil wanted error`, len(buffer))
+		}
+	})
+}
+
+func TestReadPageRejectsUnknownPageType(t *testing.T) {
+	pager := newTestPager(t)
+	page, err := pager.AllocatePage(PageTypeData)
+	if err != nil {
+		t.Fatalf(`AllocatePage() got %q wanted nil`, err)
+	}
+	pageID := page.Header.PageID
+	pager.dropPage(pageID)
+
+	// Only the type byte changes, so the body checksum still matches
+	pager.file.WriteAt([]byte{0xEE}, int64(pageID)*PageSize+36)
+	if _, err := pager.ReadPage(pageID); !errors.Is(err, ErrInvalidHeader) {
+		t.Errorf(`ReadPage() of a page with type 0xee got %v wanted %q`, err, ErrInvalidHeader)
+	}
+
+	if _, err := pager.AllocatePage(PageType(0xEE)); err == nil {
+		t.Errorf(`AllocatePage(0xee) got nil wanted error`)
+	}
+}
+
+func TestParseHeaderRejectsMalformedHeaders(t *testing.T) {
+	valid := NewPage(PageTypeData)
+	valid.Header.PageID = 1
+	buffer := make([]byte, HeaderSize)
+	serializeHeader(buffer, valid.Header)
+	if _, err := parseHeader(buffer); err != nil {
+		t.Fatalf(`parseHeader() of a valid header got %q wanted nil`, err)
+	}
+
+	for name, header := range map[string][]byte{
+		"short buffer": buffer[:HeaderSize-1],
+		"free space past body": func() []byte {
+			header := valid.Header
+			header.FreeSpace = MaxBodySize + 1
+			corrupt := make([]byte, HeaderSize)
+			serializeHeader(corrupt, header)
+			return corrupt
+		}(),
+		"slots overlapping free space": func() []byte {
+			header := valid.Header
+			header.RecordCount = 1
+			corrupt := make([]byte, HeaderSize)
+			serializeHeader(corrupt, header)
+			return corrupt
+		}(),
+	} {
+		if _, err := parseHeader(header); !errors.Is(err, ErrInvalidHeader) {
+			t.Errorf(`parseHeader() with %s got %v wanted %q`, name, err, ErrInvalidHeader)
+		}
+	}
+}
+
+func TestReadPageDetectsTornHeader(t *testing.T) {
+	pager := newTestPager(t)
+	page, err := pager.AllocatePage(PageTypeData)
+	if err != nil {
+		t.Fatalf(`AllocatePage() got %q wanted nil`, err)
+	}
+	if _, err := page.InsertRecord([]byte("first generation")); err != nil {
+		t.Fatalf(`InsertRecord() got %q wanted nil`, err)
+	}
+	if err := pager.WritePage(page); err != nil {
+		t.Fatalf(`WritePage() got %q wanted nil`, err)
+	}
+	pageID := page.Header.PageID
+	pager.dropPage(pageID)
+
+	// Overwrite just the header checksum, as a write torn after the header
+	// of a newer version of the page would
+	pager.file.WriteAt([]byte{0x01, 0x02, 0x03, 0x04}, int64(pageID)*PageSize+32)
+	if _, err := pager.ReadPage(pageID); !errors.Is(err, ErrTornPage) {
+		t.Errorf(`ReadPage() with a torn header got %v wanted %q`, err, ErrTornPage)
+	}
+}
+
+func TestReadPageDetectsStaleHeaderField(t *testing.T) {
+	pager := newTestPager(t)
+	page, err := pager.AllocatePage(PageTypeData)
+	if err != nil {
+		t.Fatalf(`AllocatePage() got %q wanted nil`, err)
+	}
+	pageID := page.Header.PageID
+	pager.dropPage(pageID)
+
+	// Change NextPageID without touching the checksum or footer
+	pager.file.WriteAt([]byte{0x09}, int64(pageID)*PageSize+8)
+	if _, err := pager.ReadPage(pageID); !errors.Is(err, ErrTornPage) {
+		t.Errorf(`ReadPage() with a changed NextPageID got %v wanted %q`, err, ErrTornPage)
+	}
+}
+
+func TestWritePageWritesFooter(t *testing.T) {
+	pager := newTestPager(t)
+	page, err := pager.AllocatePage(PageTypeData)
+	if err != nil {
+		t.Fatalf(`AllocatePage() got %q wanted nil`, err)
+	}
+	if _, err := page.InsertRecord([]byte("footer")); err != nil {
+		t.Fatalf(`InsertRecord() got %q wanted nil`, err)
+	}
+	if err := pager.WritePage(page); err != nil {
+		t.Fatalf(`WritePage() got %q wanted nil`, err)
+	}
+
+	raw := make([]byte, PageSize)
+	pager.file.ReadAt(raw, int64(page.Header.PageID)*PageSize)
+	want := PageFooter{
+		Checksum:      page.Header.Checksum,
+		PageIntegrity: pageIntegrity(raw[:HeaderSize]),
+	}
+	if page.Footer != want {
+		t.Errorf(`footer after WritePage = %+v; want %+v`, page.Footer, want)
+	}
+	if !bytes.Equal(raw[HeaderSize+MaxBodySize+8:], make([]byte, FooterSize-8)) {
+		t.Errorf(`reserved footer bytes are not zero`)
+	}
+
+	read, err := pager.readPageFromDisk(page.Header.PageID)
+	if err != nil {
+		t.Fatalf(`readPageFromDisk() got %q wanted nil`, err)
+	}
+	if read.Footer != want {
+		t.Errorf(`footer read back = %+v; want %+v`, read.Footer, want)
+	}
+}
+
+func TestSerializePageRoundTrip(t *testing.T) {
+	page := NewPage(PageTypeData)
+	page.Header.PageID = 12
+	page.Header.NextPageID = 13
+	page.Header.PrevPageID = 11
+	page.Header.PageLSN = 99
+	for _, record := range []string{"alpha", "beta", "gamma"} {
+		if _, err := page.InsertRecord([]byte(record)); err != nil {
+			t.Fatalf(`InsertRecord() got %q wanted nil`, err)
+		}
+	}
+
+	buffer, err := SerializePage(page)
+	if err != nil {
+		t.Fatalf(`SerializePage() got %q wanted nil`, err)
+	}
+	if len(buffer) != PageSize {
+		t.Fatalf(`SerializePage() returned %d bytes; want %d`, len(buffer), PageSize)
+	}
+	decoded, err := DeserializePage(buffer)
+	if err != nil {
+		t.Fatalf(`DeserializePage() got %q wanted nil`, err)
+	}
+	if decoded.Header != page.Header {
+		t.Errorf(`decoded header = %+v; want %+v`, decoded.Header, page.Header)
+	}
+	if !bytes.Equal(decoded.Body, page.Body) {
+		t.Errorf(`decoded body differs from the original`)
+	}
+	if decoded.Footer != page.Footer {
+		t.Errorf(`decoded footer = %+v; want %+v`, decoded.Footer, page.Footer)
+	}
+
+	buffer[HeaderSize+10] ^= 0xFF
+	if _, err := DeserializePage(buffer); !errors.Is(err, ErrChecksumMismatch) {
+		t.Errorf(`DeserializePage() of a corrupted body got %v wanted %q`, err, ErrChecksumMismatch)
+	}
+	if _, err := DeserializePage(buffer[:PageSize-1]); err == nil {
+		t.Errorf(`DeserializePage() of a short buffer got nil wanted error`)
+	}
+}
+
+func TestWritePageDecodesWithDeserializePage(t *testing.T) {
+	pager := newTestPager(t)
+	page, err := pager.AllocatePage(PageTypeData)
+	if err != nil {
+		t.Fatalf(`AllocatePage() got %q wanted nil`, err)
+	}
+	if _, err := page.InsertRecord([]byte("one codec")); err != nil {
+		t.Fatalf(`InsertRecord() got %q wanted nil`, err)
+	}
+	page.MarkDirtyLSN(4)
+	if err := pager.WritePage(page); err != nil {
+		t.Fatalf(`WritePage() got %q wanted nil`, err)
+	}
+
+	raw := make([]byte, PageSize)
+	pager.file.ReadAt(raw, int64(page.Header.PageID)*PageSize)
+	decoded, err := DeserializePage(raw)
+	if err != nil {
+		t.Fatalf(`DeserializePage() got %q wanted nil`, err)
+	}
+	if decoded.Header != page.Header || decoded.Footer != page.Footer || !bytes.Equal(decoded.Body, page.Body) {
+		t.Errorf(`DeserializePage() of a written page = %+v; want %+v`, decoded.Header, page.Header)
+	}
+}
+
+func TestForEachPage(t *testing.T) {
+	pager, err := NewMemoryPager(PagerConfig{MaxCacheSize: 3})
+	if err != nil {
+		t.Fatalf(`NewMemoryPager() got %q wanted nil`, err)
+	}
+	defer pager.Close()
+	for i := 0; i < 8; i++ {
+		if _, err := pager.AllocatePage(PageTypeData); err != nil {
+			t.Fatalf(`AllocatePage() got %q wanted nil`, err)
+		}
+	}
+	if err := pager.DeallocatePage(4); err != nil {
+		t.Fatalf(`DeallocatePage() got %q wanted nil`, err)
+	}
+
+	var visited []PageID
+	err = pager.ForEachPage(func(page *Page) error {
+		visited = append(visited, page.Header.PageID)
+		return nil
+	})
+	if err != nil {
+		t.Fatalf(`ForEachPage() got %q wanted nil`, err)
+	}
+	if want := []PageID{1, 2, 3, 4, 5, 6, 7, 8}; !slices.Equal(visited, want) {
+		t.Errorf(`ForEachPage() visited %v; want %v`, visited, want)
+	}
+	if stats := pager.Stats(); stats.CachedPages > 3 {
+		t.Errorf(`ForEachPage() left %d pages cached; want at most 3`, stats.CachedPages)
+	}
+
+	stop := errors.New("stop")
+	visited = nil
+	err = pager.ForEachPage(func(page *Page) error {
+		visited = append(visited, page.Header.PageID)
+		if len(visited) == 2 {
+			return stop
+		}
+		return nil
+	})
+	if !errors.Is(err, stop) || len(visited) != 2 {
+		t.Errorf(`ForEachPage() after the callback failed = (%v, %d pages); want (%q, 2 pages)`, err, len(visited), stop)
+	}
+}
+
+func TestTruncate(t *testing.T) {
+	pager := newTestPager(t)
+	for i := 0; i < 4; i++ {
+		if _, err := pager.AllocatePage(PageTypeData); err != nil {
+			t.Fatalf(`AllocatePage() got %q wanted nil`, err)
+		}
+	}
+	if err := pager.DeallocatePage(3); err != nil {
+		t.Fatalf(`DeallocatePage(3) got %q wanted nil`, err)
+	}
+
+	// Free pages 5 and 6 left at the end of the file off the free list, as a
+	// crash between freeing them and shrinking the file would
+	free := NewPage(PageTypeFree)
+	for _, pageID := range []PageID{5, 6} {
+		free.Header.PageID = pageID
+		image, err := pager.encodePage(free)
+		if err != nil {
+			t.Fatalf(`encodePage() got %q wanted nil`, err)
+		}
+		if err := pager.writePageImage(pageID, image); err != nil {
+			t.Fatalf(`writePageImage() got %q wanted nil`, err)
+		}
+	}
+
+	if err := pager.Truncate(4); err == nil {
+		t.Errorf(`Truncate() over live page 4 got nil wanted error`)
+	}
+	if size, _ := pager.file.Size(); size != 7*PageSize {
+		t.Errorf(`file size after failed Truncate = %d; want %d`, size, 7*PageSize)
+	}
+
+	if err := pager.Truncate(5); err != nil {
+		t.Fatalf(`Truncate(5) got %q wanted nil`, err)
+	}
+	if size, _ := pager.file.Size(); size != 5*PageSize {
+		t.Errorf(`file size after Truncate(5) = %d; want %d`, size, 5*PageSize)
+	}
+	page, err := pager.AllocatePage(PageTypeData)
+	if err != nil {
+		t.Fatalf(`AllocatePage() got %q wanted nil`, err)
+	}
+	if page.Header.PageID != 3 {
+		t.Errorf(`AllocatePage() after Truncate = page %d; want recycled page 3`, page.Header.PageID)
+	}
+	page, err = pager.AllocatePage(PageTypeData)
+	if err != nil {
+		t.Fatalf(`AllocatePage() got %q wanted nil`, err)
+	}
+	if page.Header.PageID != 5 {
+		t.Errorf(`AllocatePage() after Truncate = page %d; want new page 5`, page.Header.PageID)
+	}
+}
+
+func TestGrowPreallocatesPages(t *testing.T) {
+	pager := newTestPager(t)
+	if _, err := pager.AllocatePage(PageTypeData); err != nil {
+		t.Fatalf(`AllocatePage() got %q wanted nil`, err)
+	}
+	if err := pager.Grow(100); err != nil {
+		t.Fatalf(`Grow() got %q wanted nil`, err)
+	}
+	grown, err := pager.file.Size()
+	if err != nil {
+		t.Fatalf(`Size() got %q wanted nil`, err)
+	}
+	if grown != 102*PageSize {
+		t.Errorf(`file size after Grow(100) = %d; want %d`, grown, 102*PageSize)
+	}
+
+	for want := PageID(2); want < 102; want++ {
+		page, err := pager.AllocatePage(PageTypeData)
+		if err != nil {
+			t.Fatalf(`AllocatePage() got %q wanted nil`, err)
+		}
+		if page.Header.PageID != want {
+			t.Fatalf(`AllocatePage() = page %d; want pre-grown page %d`, page.Header.PageID, want)
+		}
+	}
+	if size, _ := pager.file.Size(); size != grown {
+		t.Errorf(`file size after 100 allocations = %d; want %d`, size, grown)
+	}
+
+	page, err := pager.AllocatePage(PageTypeData)
+	if err != nil {
+		t.Fatalf(`AllocatePage() got %q wanted nil`, err)
+	}
+	if page.Header.PageID != 102 {
+		t.Errorf(`AllocatePage() past the grown region = page %d; want 102`, page.Header.PageID)
+	}
+}
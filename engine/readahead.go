@@ -0,0 +1,98 @@
+package engine
+
+// Readahead watches the gaps between the PageIDs of successive reads. Once
+// readaheadMinRun gaps in a row are the same, the reads are taken to be a
+// sequential or strided scan and the next pages along the stride are read
+// into the cache ahead of time, in one read per contiguous run. Each further
+// read that keeps to the stride doubles the number of pages read ahead, up to
+// PagerConfig.Readahead, and a read that breaks it stops readahead until a
+// new stride has been seen, so random access never triggers any
+const readaheadMinRun = 2
+
+// accessPattern tracks the stride of recent reads
+type accessPattern struct {
+	last   PageID
+	stride int64
+	// run counts the successive reads that kept to stride
+	run int
+}
+
+// observe records a read of pageID and returns the stride of the scan it
+// continues and how many pages to read ahead, or a depth of 0 if the recent
+// reads follow no pattern. Rereading the last page neither continues nor
+// breaks a scan
+func (a *accessPattern) observe(pageID PageID, maxDepth int) (int64, int) {
+	delta := int64(pageID) - int64(a.last)
+	if delta == 0 {
+		return a.stride, 0
+	}
+	if a.last != 0 && delta == a.stride {
+		a.run++
+	} else {
+		a.stride, a.run = delta, 1
+	}
+	a.last = pageID
+	if a.run < readaheadMinRun {
+		return a.stride, 0
+	}
+	return a.stride, min(maxDepth, 1<<min(a.run-readaheadMinRun, 30))
+}
+
+// readahead observes a read of pageID and, if it continues a scan, caches the
+// pages the scan will read next. Readahead is best effort: pages past the end
+// of the file are skipped and failed reads are ignored. The caller must hold
+// p.mutex
+func (p *Pager) readahead(pageID PageID) {
+	if p.readaheadMax <= 0 {
+		return
+	}
+	// Reading ahead more than half the cache would evict the scan's own pages
+	stride, depth := p.pattern.observe(pageID, min(p.readaheadMax, p.maxPages/2))
+	if depth == 0 {
+		return
+	}
+	fileSize, err := p.file.Size()
+	if err != nil {
+		return
+	}
+	end := PageID(fileSize / PageSize)
+
+	var targets []PageID
+	for i := 1; i <= depth; i++ {
+		target := int64(pageID) + stride*int64(i)
+		if target <= 0 || PageID(target) >= end {
+			break
+		}
+		if _, ok := p.pageCache[PageID(target)]; !ok {
+			targets = append(targets, PageID(target))
+		}
+	}
+
+	for start := 0; start < len(targets); {
+		run := 1
+		for start+run < len(targets) && targets[start+run] == targets[start+run-1]+1 {
+			run++
+		}
+		p.prefetch(targets[start], run)
+		start += run
+	}
+}
+
+// prefetch reads n contiguous pages from first into the cache with a single
+// read. The caller must hold p.mutex
+func (p *Pager) prefetch(first PageID, n int) {
+	buffer := make([]byte, n*PageSize)
+	if _, err := p.file.ReadAt(buffer, int64(first)*PageSize); err != nil {
+		return
+	}
+	for i := 0; i < n; i++ {
+		page, err := decodePage(buffer[i*PageSize:(i+1)*PageSize], p.checksummer)
+		if err != nil {
+			continue
+		}
+		if err := p.cachePage(page); err != nil {
+			return
+		}
+		p.prefetched++
+	}
+}
@@ -0,0 +1,85 @@
+package engine
+
+import (
+	"math/rand/v2"
+	"path/filepath"
+	"testing"
+)
+
+// newColdPager writes pages data pages to a file and reopens it with an
+// empty cache and readahead of up to depth pages
+func newColdPager(t *testing.T, pages, depth int) (*Pager, []PageID) {
+	path := filepath.Join(t.TempDir(), "test.db")
+	pager, err := NewPager(PagerConfig{FilePath: path, MaxCacheSize: 100})
+	if err != nil {
+		t.Fatalf(`NewPager() got %q wanted nil`, err)
+	}
+	var pageIDs []PageID
+	for i := 0; i < pages; i++ {
+		page, err := pager.AllocatePage(PageTypeData)
+		if err != nil {
+			t.Fatalf(`AllocatePage() got %q wanted nil`, err)
+		}
+		pageIDs = append(pageIDs, page.Header.PageID)
+	}
+	if err := pager.Close(); err != nil {
+		t.Fatalf(`Close() got %q wanted nil`, err)
+	}
+
+	pager, err = NewPager(PagerConfig{FilePath: path, MaxCacheSize: 100, Readahead: depth})
+	if err != nil {
+		t.Fatalf(`NewPager() got %q wanted nil`, err)
+	}
+	t.Cleanup(func() { pager.Close() })
+	return pager, pageIDs
+}
+
+func TestReadaheadFollowsScans(t *testing.T) {
+	tests := []struct {
+		name   string
+		stride int
+	}{
+		{"sequential", 1},
+		{"strided", 3},
+	}
+	for _, test := range tests {
+		pager, pageIDs := newColdPager(t, 64, 8)
+		for i := 0; i < len(pageIDs); i += test.stride {
+			if _, err := pager.ReadPage(pageIDs[i]); err != nil {
+				t.Fatalf(`ReadPage() got %q wanted nil`, err)
+			}
+		}
+		stats := pager.Stats()
+		if stats.Prefetched == 0 {
+			t.Errorf(`%s scan: Prefetched = 0; want readahead`, test.name)
+		}
+		// Only the reads before the scan was detected miss the cache
+		if stats.CacheMisses > readaheadMinRun+1 {
+			t.Errorf(`%s scan: %d cache misses; want at most %d`, test.name, stats.CacheMisses, readaheadMinRun+1)
+		}
+	}
+}
+
+func TestReadaheadIgnoresRandomReads(t *testing.T) {
+	pager, pageIDs := newColdPager(t, 64, 8)
+	rng := rand.New(rand.NewPCG(1, 2))
+	for i := 0; i < 200; i++ {
+		if _, err := pager.ReadPage(pageIDs[rng.IntN(len(pageIDs))]); err != nil {
+			t.Fatalf(`ReadPage() got %q wanted nil`, err)
+		}
+	}
+	if stats := pager.Stats(); stats.Prefetched != 0 {
+		t.Errorf(`random reads: Prefetched = %d; want 0`, stats.Prefetched)
+	}
+
+	// Without a Readahead depth a scan reads nothing ahead
+	pager, pageIDs = newColdPager(t, 16, 0)
+	for _, pageID := range pageIDs {
+		if _, err := pager.ReadPage(pageID); err != nil {
+			t.Fatalf(`ReadPage() got %q wanted nil`, err)
+		}
+	}
+	if stats := pager.Stats(); stats.Prefetched != 0 {
+		t.Errorf(`scan without readahead: Prefetched = %d; want 0`, stats.Prefetched)
+	}
+}
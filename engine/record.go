@@ -0,0 +1,179 @@
+package engine
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+)
+
+// Data pages use a slotted layout. The slot directory grows forward from the
+// start of the body, one slotSize entry per record holding its offset and
+// length, while record bytes are packed backward from the end of the body.
+// Header.RecordCount is the number of slots and Header.FreeSpace is the gap
+// between the end of the slot directory and the lowest record. A slot with a
+// zero offset is a tombstone: live records always sit past the directory.
+// Record lengths never exceed 12 bits, so the top bits of a slot's length
+// field hold flags describing how the record is stored
+const (
+	slotSize       = 4
+	slotLengthMask = 0x0fff
+
+	// slotFlagOverflow marks a record whose bytes live in an overflow chain;
+	// the slot holds an LOBLocator pointing at it
+	slotFlagOverflow uint16 = 0x8000
+	// slotFlagCompressed marks a record stored by compressRecord
+	slotFlagCompressed uint16 = 0x4000
+)
+
+// A compressed record is stored as its codec byte and uint32 uncompressed
+// length followed by the compressed bytes. Records longer than
+// maxCompressedRecord are stored as they are, so a damaged length can never
+// make decoding allocate more than that
+const (
+	compressedRecordHeader = 5
+	maxCompressedRecord    = 16 << 20
+)
+
+var (
+	ErrPageFull       = errors.New("not enough free space on page")
+	ErrRecordNotFound = errors.New("record not found")
+)
+
+// RID identifies a record by the page it lives on and its slot in that page
+type RID struct {
+	PageID PageID
+	Slot   uint16
+}
+
+func (rid RID) String() string {
+	return fmt.Sprintf("(%d:%d)", rid.PageID, rid.Slot)
+}
+
+// slot returns the offset, length and flags stored in a slot directory entry
+func (page *Page) slot(slot uint16) (uint16, uint16, uint16) {
+	entry := int(slot) * slotSize
+	offset := binary.LittleEndian.Uint16(page.Body[entry : entry+2])
+	length := binary.LittleEndian.Uint16(page.Body[entry+2 : entry+4])
+	return offset, length & slotLengthMask, length &^ slotLengthMask
+}
+
+func (page *Page) setSlot(slot uint16, offset uint16, length uint16, flags uint16) {
+	entry := int(slot) * slotSize
+	binary.LittleEndian.PutUint16(page.Body[entry:entry+2], offset)
+	binary.LittleEndian.PutUint16(page.Body[entry+2:entry+4], length|flags)
+}
+
+// InsertRecord appends a record to the page and returns its slot. The page's
+// key filter no longer counts as complete afterwards, see AddKey
+func (page *Page) InsertRecord(data []byte) (uint16, error) {
+	return page.insertRecord(data, 0)
+}
+
+// insertRecord is InsertRecord storing flags in the new slot
+func (page *Page) insertRecord(data []byte, flags uint16) (uint16, error) {
+	if len(data)+slotSize > int(page.Header.FreeSpace) {
+		return 0, ErrPageFull
+	}
+
+	slot := uint16(page.Header.RecordCount)
+	recordStart := int(page.Header.RecordCount)*slotSize + int(page.Header.FreeSpace)
+	offset := recordStart - len(data)
+	copy(page.Body[offset:recordStart], data)
+	page.setSlot(slot, uint16(offset), uint16(len(data)), flags)
+
+	page.Header.RecordCount++
+	page.Header.FreeSpace -= uint32(len(data) + slotSize)
+	page.dropKeyFilter()
+	page.dirty = true
+	return slot, nil
+}
+
+// Record returns the bytes of the live record in a slot. The returned slice
+// aliases the page body
+func (page *Page) Record(slot uint16) ([]byte, error) {
+	if uint32(slot) >= page.Header.RecordCount || (int(slot)+1)*slotSize > len(page.Body) {
+		return nil, ErrRecordNotFound
+	}
+	offset, length, _ := page.slot(slot)
+	if offset == 0 {
+		return nil, ErrRecordNotFound
+	}
+	if int(offset)+int(length) > len(page.Body) {
+		return nil, fmt.Errorf("slot %d points past the page body", slot)
+	}
+	return page.Body[offset : offset+length], nil
+}
+
+// recordFlags returns the flags stored with the live record in a slot
+func (page *Page) recordFlags(slot uint16) (uint16, error) {
+	if _, err := page.Record(slot); err != nil {
+		return 0, err
+	}
+	_, _, flags := page.slot(slot)
+	return flags, nil
+}
+
+// compressRecord returns data compressed with codec in the compressed record
+// format, or false if compressing would not make it smaller or data is longer
+// than maxCompressedRecord
+func compressRecord(data []byte, codec Compression) ([]byte, bool, error) {
+	if len(data) > maxCompressedRecord {
+		return nil, false, nil
+	}
+	compressed, err := compressBytes(data, codec)
+	if err != nil {
+		return nil, false, err
+	}
+	if compressedRecordHeader+len(compressed) >= len(data) {
+		return nil, false, nil
+	}
+	stored := make([]byte, compressedRecordHeader, compressedRecordHeader+len(compressed))
+	stored[0] = byte(codec)
+	binary.LittleEndian.PutUint32(stored[1:], uint32(len(data)))
+	return append(stored, compressed...), true, nil
+}
+
+// decompressRecord reverses compressRecord
+func decompressRecord(stored []byte) ([]byte, error) {
+	if len(stored) < compressedRecordHeader {
+		return nil, fmt.Errorf("compressed record is only %d bytes", len(stored))
+	}
+	codec := Compression(stored[0])
+	size := binary.LittleEndian.Uint32(stored[1:])
+	if size > maxCompressedRecord {
+		return nil, fmt.Errorf("compressed record claims %d bytes, more than the %d a record may compress", size, maxCompressedRecord)
+	}
+	data, err := decompressBytes(stored[compressedRecordHeader:], codec, int(size))
+	if err != nil {
+		return nil, fmt.Errorf("unable to decompress %s record: %w", codec, err)
+	}
+	return data, nil
+}
+
+// DeleteRecord tombstones the record in a slot and reclaims its bytes by
+// shifting the records packed below it up. The slot itself is kept so the
+// RIDs of the other records on the page stay valid. The page's key filter no
+// longer counts as complete afterwards, as it cannot forget the record
+func (page *Page) DeleteRecord(slot uint16) error {
+	if _, err := page.Record(slot); err != nil {
+		return err
+	}
+	offset, length, _ := page.slot(slot)
+
+	recordStart := int(page.Header.RecordCount)*slotSize + int(page.Header.FreeSpace)
+	copy(page.Body[recordStart+int(length):int(offset)+int(length)], page.Body[recordStart:offset])
+	clear(page.Body[recordStart : recordStart+int(length)])
+
+	for other := uint16(0); uint32(other) < page.Header.RecordCount; other++ {
+		otherOffset, otherLength, otherFlags := page.slot(other)
+		if otherOffset != 0 && otherOffset < offset {
+			page.setSlot(other, otherOffset+length, otherLength, otherFlags)
+		}
+	}
+	page.setSlot(slot, 0, 0, 0)
+
+	page.Header.FreeSpace += uint32(length)
+	page.dropKeyFilter()
+	page.dirty = true
+	return nil
+}
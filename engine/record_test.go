@@ -0,0 +1,104 @@
+package engine
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"testing"
+)
+
+func TestDeleteRecordReclaimsSpace(t *testing.T) {
+	page := NewPage(PageTypeData)
+	values := []string{"first", "second", "third"}
+	for _, value := range values {
+		if _, err := page.InsertRecord([]byte(value)); err != nil {
+			t.Fatalf(`InsertRecord(%q) got %q wanted nil`, value, err)
+		}
+	}
+	before := page.Header.FreeSpace
+
+	if err := page.DeleteRecord(1); err != nil {
+		t.Fatalf(`DeleteRecord(1) got %q wanted nil`, err)
+	}
+	if got := page.Header.FreeSpace; got != before+uint32(len("second")) {
+		t.Errorf(`FreeSpace = %d; want %d`, got, before+uint32(len("second")))
+	}
+	if _, err := page.Record(1); !errors.Is(err, ErrRecordNotFound) {
+		t.Errorf(`Record(1) after delete got %v wanted ErrRecordNotFound`, err)
+	}
+	if err := page.DeleteRecord(1); !errors.Is(err, ErrRecordNotFound) {
+		t.Errorf(`DeleteRecord(1) twice got %v wanted ErrRecordNotFound`, err)
+	}
+
+	// The surviving records keep their slots after the shift
+	for slot, want := range map[uint16]string{0: "first", 2: "third"} {
+		got, err := page.Record(slot)
+		if err != nil {
+			t.Fatalf(`Record(%d) got %q wanted nil`, slot, err)
+		}
+		if string(got) != want {
+			t.Errorf(`Record(%d) = %q; want %q`, slot, got, want)
+		}
+	}
+}
+
+func TestInsertRecordPageFull(t *testing.T) {
+	page := NewPage(PageTypeData)
+	if _, err := page.InsertRecord(make([]byte, MaxRecordSize)); err != nil {
+		t.Fatalf(`InsertRecord(MaxRecordSize) got %q wanted nil`, err)
+	}
+	if _, err := page.InsertRecord([]byte{1}); !errors.Is(err, ErrPageFull) {
+		t.Errorf(`InsertRecord() on a full page got %v wanted ErrPageFull`, err)
+	}
+}
+
+func TestDeleteRecordKeepsSlotFlags(t *testing.T) {
+	page := NewPage(PageTypeData)
+	if _, err := page.InsertRecord([]byte("plain")); err != nil {
+		t.Fatalf(`InsertRecord() got %q wanted nil`, err)
+	}
+	if _, err := page.insertRecord([]byte("flagged"), slotFlagOverflow); err != nil {
+		t.Fatalf(`insertRecord() got %q wanted nil`, err)
+	}
+	if err := page.DeleteRecord(0); err != nil {
+		t.Fatalf(`DeleteRecord(0) got %q wanted nil`, err)
+	}
+
+	// Shifting the flagged record must carry its flags along
+	got, err := page.Record(1)
+	if err != nil {
+		t.Fatalf(`Record(1) got %q wanted nil`, err)
+	}
+	if string(got) != "flagged" {
+		t.Errorf(`Record(1) = %q; want "flagged"`, got)
+	}
+	if flags, err := page.recordFlags(1); err != nil || flags != slotFlagOverflow {
+		t.Errorf(`recordFlags(1) = (%#x, %v); want (%#x, nil)`, flags, err, slotFlagOverflow)
+	}
+}
+
+func TestDecompressRecordChecksLength(t *testing.T) {
+	data := bytes.Repeat([]byte("compressible "), 100)
+	stored, ok, err := compressRecord(data, CompressionFlate)
+	if err != nil || !ok {
+		t.Fatalf(`compressRecord() = %v, %v; want it compressed`, ok, err)
+	}
+	if got, err := decompressRecord(stored); err != nil || !bytes.Equal(got, data) {
+		t.Fatalf(`decompressRecord() = %d bytes, %v; want the original record`, len(got), err)
+	}
+
+	for _, test := range []struct {
+		name string
+		size uint32
+	}{
+		{"huge length", ^uint32(0)},
+		{"stream runs past length", uint32(len(data) - 1)},
+		{"stream ends before length", uint32(len(data) + 1)},
+	} {
+		damaged := bytes.Clone(stored)
+		binary.LittleEndian.PutUint32(damaged[1:], test.size)
+		if _, err := decompressRecord(damaged); err == nil {
+			t.Errorf(`%s: decompressRecord() got nil wanted error`, test.name)
+		}
+	}
+}
@@ -0,0 +1,228 @@
+package engine
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"time"
+)
+
+// Recover brings the pager's file back to a consistent state from the WAL.
+// Write entries carry full before and after images of a page, so redo simply
+// rewrites the after image of every write belonging to a committed
+// transaction, in LSN order, which also repairs pages torn by a crash. Writes
+// of transactions that never committed are then undone in reverse LSN order
+// by restoring their before images.
+//
+// Redo stamps each image with its entry's LSN as the PageLSN, and skips any
+// entry whose page already carries that LSN or a later one, since the change
+// is already on disk. A page that cannot be read, such as one torn by a
+// crash, is always redone
+//
+// When the superblock records a checkpoint, everything logged before it is
+// already on disk except changes to the pages in its dirty page table: redo
+// starts at the oldest recLSN in that table, or after the checkpoint, and the
+// log is only read from the first write of the oldest transaction still
+// active at it.
+//
+// Options narrow what is recovered; see WithPageFilter
+func Recover(pager *Pager, wal *WriteAheadLog, opts ...RecoverOption) error {
+	var options recoverOptions
+	for _, opt := range opts {
+		opt(&options)
+	}
+	return pager.recover(wal, options, func(pageID PageID) (PageID, bool) {
+		return pageID, options.pageFilter == nil || options.pageFilter(pageID)
+	})
+}
+
+// RecoveryTarget is the point RecoverToPoint recovers to. A transaction counts
+// as committed only if its commit entry has an LSN of at most LSN and a
+// Timestamp no later than Time; a zero LSN or Time does not limit recovery
+type RecoveryTarget struct {
+	LSN  uint64
+	Time time.Time
+}
+
+// includes reports whether entry falls at or before the target
+func (target RecoveryTarget) includes(entry *WriteAheadLogEntry) bool {
+	if target.LSN != 0 && entry.LSN > target.LSN {
+		return false
+	}
+	return target.Time.IsZero() || entry.Timestamp <= target.Time.UnixNano()
+}
+
+// RecoverToPoint is Recover returning the file to its state at target: only
+// transactions that committed by then are redone, and every other write,
+// including those of transactions that straddle the target or began after it,
+// is undone. It reads the whole log, since a checkpoint taken after the target
+// says nothing about the state at it
+func RecoverToPoint(pager *Pager, wal *WriteAheadLog, target RecoveryTarget, opts ...RecoverOption) error {
+	return Recover(pager, wal, append(opts, func(options *recoverOptions) {
+		options.target = &target
+	})...)
+}
+
+// RecoverOption configures Recover
+type RecoverOption func(*recoverOptions)
+
+type recoverOptions struct {
+	pageFilter func(PageID) bool
+	target     *RecoveryTarget
+}
+
+// WithPageFilter limits redo and undo to the write entries of pages for which
+// filter returns true, so an operator can repair a localized corruption, such
+// as one table's pages, without touching the rest of the file. Commits still
+// come from the whole log
+func WithPageFilter(filter func(PageID) bool) RecoverOption {
+	return func(options *recoverOptions) {
+		options.pageFilter = filter
+	}
+}
+
+// OnlyPages is WithPageFilter for an explicit set of pages
+func OnlyPages(pageIDs ...PageID) RecoverOption {
+	set := make(map[PageID]bool, len(pageIDs))
+	for _, pageID := range pageIDs {
+		set[pageID] = true
+	}
+	return WithPageFilter(func(pageID PageID) bool { return set[pageID] })
+}
+
+// recover is Recover with options, limited to the write entries that local
+// maps to a page of this pager, which lets several pagers share one log with
+// namespaced PageIDs. local returns the pager's own PageID for an entry's
+// PageID, or false if the entry belongs to another file; the page images
+// themselves always carry the pager's own PageIDs. Commits are shared by
+// every file
+func (p *Pager) recover(wal *WriteAheadLog, options recoverOptions, local func(PageID) (PageID, bool)) error {
+	p.mutex.Lock()
+	defer p.mutex.Unlock()
+
+	var startLSN, redoAfter uint64
+	if options.target == nil {
+		var err error
+		if startLSN, redoAfter, err = p.recoveryStart(wal); err != nil {
+			return &PagerError{Op: "Recover", Err: err}
+		}
+	}
+	entries, err := wal.ReplayFrom(startLSN)
+	if err != nil {
+		return &PagerError{
+			Op:  "Recover",
+			Err: fmt.Errorf("unable to replay log: %w", err),
+		}
+	}
+
+	committed := make(map[uint64]bool)
+	for i := range entries {
+		entry := &entries[i]
+		if entry.Type == EntryTypeCommit && (options.target == nil || options.target.includes(entry)) {
+			committed[entry.TxnID] = true
+		}
+	}
+
+	// Redo committed writes
+	for i := range entries {
+		entry := &entries[i]
+		if entry.Type != EntryTypeWrite || !committed[entry.TxnID] || entry.LSN <= redoAfter {
+			continue
+		}
+		pageID, ok := local(entry.PageID)
+		if !ok {
+			continue
+		}
+		if current, err := p.readPageFromDisk(pageID); err == nil && current.Header.PageLSN >= entry.LSN {
+			continue
+		}
+		image, err := p.stampPageLSN(entry.NewData[:], entry.LSN)
+		if err != nil {
+			return &PagerError{
+				Op:  "Recover",
+				Err: fmt.Errorf("unable to redo LSN %d: %w", entry.LSN, err),
+			}
+		}
+		if err := p.writePageImage(pageID, image); err != nil {
+			return &PagerError{
+				Op:  "Recover",
+				Err: fmt.Errorf("unable to redo LSN %d: %w", entry.LSN, err),
+			}
+		}
+	}
+
+	// Undo uncommitted writes
+	for i := len(entries) - 1; i >= 0; i-- {
+		entry := &entries[i]
+		if entry.Type != EntryTypeWrite || committed[entry.TxnID] {
+			continue
+		}
+		pageID, ok := local(entry.PageID)
+		if !ok {
+			continue
+		}
+		if err := p.writePageImage(pageID, entry.OldData[:]); err != nil {
+			return &PagerError{
+				Op:  "Recover",
+				Err: fmt.Errorf("unable to undo LSN %d: %w", entry.LSN, err),
+			}
+		}
+	}
+
+	if err := p.file.Sync(); err != nil {
+		return &PagerError{
+			Op:  "Recover",
+			Err: fmt.Errorf("unable to sync file: %w", err),
+		}
+	}
+	return nil
+}
+
+// recoveryStart returns the LSN to start reading the log from and the LSN up
+// to which redo can be skipped, using the last checkpoint in the superblock.
+// The caller must hold p.mutex
+func (p *Pager) recoveryStart(wal *WriteAheadLog) (uint64, uint64, error) {
+	checkpointLSN := p.superblock.checkpointLSN
+	if checkpointLSN == 0 {
+		return 0, 0, nil
+	}
+
+	// A checkpoint in a segment sealed since leaves nothing in the live
+	// segment already on disk
+	first, err := readEntryAt(wal.File, 0)
+	if errors.Is(err, io.EOF) || err == nil && first.LSN > checkpointLSN {
+		return 0, 0, nil
+	}
+
+	checkpoint, err := readEntryAt(wal.File, p.superblock.checkpointOffset)
+	if err != nil {
+		return 0, 0, fmt.Errorf("unable to read checkpoint LSN %d: %w", checkpointLSN, err)
+	}
+	if checkpoint.Type != EntryTypeCheckpoint || checkpoint.LSN != checkpointLSN {
+		return 0, 0, fmt.Errorf("log entry at offset %d is not checkpoint LSN %d", p.superblock.checkpointOffset, checkpointLSN)
+	}
+	active, dirty, err := decodeCheckpoint(checkpoint)
+	if err != nil {
+		return 0, 0, err
+	}
+
+	redoAfter := checkpointLSN
+	for _, recLSN := range dirty {
+		redoAfter = min(redoAfter, recLSN-1)
+	}
+	startLSN := redoAfter + 1
+	for _, firstLSN := range active {
+		startLSN = min(startLSN, firstLSN)
+	}
+	return startLSN, redoAfter, nil
+}
+
+// stampPageLSN returns a page image re-encoded with its PageLSN set to lsn
+func (p *Pager) stampPageLSN(image []byte, lsn uint64) ([]byte, error) {
+	page, err := decodePage(image, p.checksummer)
+	if err != nil {
+		return nil, err
+	}
+	page.Header.PageLSN = lsn
+	return p.encodePage(page)
+}
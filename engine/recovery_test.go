@@ -0,0 +1,217 @@
+package engine
+
+import (
+	"testing"
+	"time"
+)
+
+func TestRecoverUndoesUncommittedWrites(t *testing.T) {
+	pager := newTestPager(t)
+	wal := newTestWAL(t)
+
+	page, err := pager.AllocatePage(PageTypeData)
+	if err != nil {
+		t.Fatalf(`AllocatePage() got %q wanted nil`, err)
+	}
+	before := clonePage(page)
+	page.Body[0] = 42
+	logPageWrite(t, pager, wal, 9, before, page)
+	if err := wal.Flush(); err != nil {
+		t.Fatalf(`Flush() got %q wanted nil`, err)
+	}
+	if err := pager.WritePage(page); err != nil {
+		t.Fatalf(`WritePage() got %q wanted nil`, err)
+	}
+
+	if err := Recover(pager, wal); err != nil {
+		t.Fatalf(`Recover() got %q wanted nil`, err)
+	}
+	restored, err := pager.ReadPage(page.Header.PageID)
+	if err != nil {
+		t.Fatalf(`ReadPage() got %q wanted nil`, err)
+	}
+	if restored.Body[0] != 0 {
+		t.Errorf(`body[0] after undo = %d; want 0`, restored.Body[0])
+	}
+}
+
+func TestRecoverSkipsRedoForNewerPages(t *testing.T) {
+	pager := newTestPager(t)
+	wal := newTestWAL(t)
+
+	page, err := pager.AllocatePage(PageTypeData)
+	if err != nil {
+		t.Fatalf(`AllocatePage() got %q wanted nil`, err)
+	}
+	before := clonePage(page)
+	page.Body[0] = 1
+	logPageWrite(t, pager, wal, 1, before, page)
+	if err := wal.Append(&WriteAheadLogEntry{TxnID: 1, Type: EntryTypeCommit}); err != nil {
+		t.Fatalf(`Append() got %q wanted nil`, err)
+	}
+	if err := wal.Flush(); err != nil {
+		t.Fatalf(`Flush() got %q wanted nil`, err)
+	}
+
+	// The page on disk already reflects a later change than the log entry
+	page.Body[0] = 7
+	page.Header.PageLSN = 5
+	if err := pager.WritePage(page); err != nil {
+		t.Fatalf(`WritePage() got %q wanted nil`, err)
+	}
+
+	counter := countWrites(pager)
+	if err := Recover(pager, wal); err != nil {
+		t.Fatalf(`Recover() got %q wanted nil`, err)
+	}
+	if counter.writes != 0 {
+		t.Errorf(`Recover() made %d writes; want 0`, counter.writes)
+	}
+	recovered, err := pager.ReadPage(page.Header.PageID)
+	if err != nil {
+		t.Fatalf(`ReadPage() got %q wanted nil`, err)
+	}
+	if recovered.Body[0] != 7 || recovered.Header.PageLSN != 5 {
+		t.Errorf(`page after recovery = (body[0] %d, PageLSN %d); want (7, 5)`, recovered.Body[0], recovered.Header.PageLSN)
+	}
+
+	// An older page is redone and stamped with the entry's LSN
+	page.Header.PageLSN = 0
+	if err := pager.WritePage(page); err != nil {
+		t.Fatalf(`WritePage() got %q wanted nil`, err)
+	}
+	if err := Recover(pager, wal); err != nil {
+		t.Fatalf(`Recover() got %q wanted nil`, err)
+	}
+	recovered, err = pager.ReadPage(page.Header.PageID)
+	if err != nil {
+		t.Fatalf(`ReadPage() got %q wanted nil`, err)
+	}
+	if recovered.Body[0] != 1 || recovered.Header.PageLSN != 1 {
+		t.Errorf(`page after redo = (body[0] %d, PageLSN %d); want (1, 1)`, recovered.Body[0], recovered.Header.PageLSN)
+	}
+}
+
+func TestRecoverWithPageFilter(t *testing.T) {
+	pager := newTestPager(t)
+	wal := newTestWAL(t)
+
+	pages := make([]*Page, 3)
+	for i := range pages {
+		page, err := pager.AllocatePage(PageTypeData)
+		if err != nil {
+			t.Fatalf(`AllocatePage() got %q wanted nil`, err)
+		}
+		pages[i] = page
+	}
+	if err := pager.FlushAll(); err != nil {
+		t.Fatalf(`FlushAll() got %q wanted nil`, err)
+	}
+
+	// Log a committed change to every page, none of which reaches the file
+	for i, page := range pages {
+		before := clonePage(page)
+		page.Body[0] = byte(i + 1)
+		logPageWrite(t, pager, wal, 1, before, page)
+		page.Body[0] = 0
+	}
+	if err := wal.Append(&WriteAheadLogEntry{TxnID: 1, Type: EntryTypeCommit}); err != nil {
+		t.Fatalf(`Append() got %q wanted nil`, err)
+	}
+	if err := wal.Flush(); err != nil {
+		t.Fatalf(`Flush() got %q wanted nil`, err)
+	}
+
+	target := pages[1].Header.PageID
+	counter := countWrites(pager)
+	if err := Recover(pager, wal, OnlyPages(target)); err != nil {
+		t.Fatalf(`Recover() got %q wanted nil`, err)
+	}
+	if counter.writes != 1 {
+		t.Errorf(`Recover() made %d writes; want 1`, counter.writes)
+	}
+	for i, page := range pages {
+		recovered, err := pager.ReadPage(page.Header.PageID)
+		if err != nil {
+			t.Fatalf(`ReadPage() got %q wanted nil`, err)
+		}
+		var want byte
+		if page.Header.PageID == target {
+			want = byte(i + 1)
+		}
+		if recovered.Body[0] != want {
+			t.Errorf(`page %d body[0] after filtered recovery = %d; want %d`, page.Header.PageID, recovered.Body[0], want)
+		}
+	}
+}
+
+func TestRecoverToPoint(t *testing.T) {
+	pager := newTestPager(t)
+	wal := newTestWAL(t)
+
+	p, err := pager.AllocatePage(PageTypeData)
+	if err != nil {
+		t.Fatalf(`AllocatePage() got %q wanted nil`, err)
+	}
+	q, err := pager.AllocatePage(PageTypeData)
+	if err != nil {
+		t.Fatalf(`AllocatePage() got %q wanted nil`, err)
+	}
+	write := func(txnID uint64, page *Page, value byte) {
+		before := clonePage(page)
+		page.Body[0] = value
+		logPageWrite(t, pager, wal, txnID, before, page)
+	}
+	commit := func(txnID uint64) {
+		if err := wal.Append(&WriteAheadLogEntry{TxnID: txnID, Type: EntryTypeCommit}); err != nil {
+			t.Fatalf(`Append() got %q wanted nil`, err)
+		}
+	}
+
+	// Transaction 2 straddles the commits of 1 and 3
+	write(1, p, 1) // LSN 1
+	commit(1)      // LSN 2
+	write(2, q, 5) // LSN 3
+	write(3, p, 2) // LSN 4
+	commit(3)      // LSN 5
+	commit(2)      // LSN 6
+	if err := wal.Flush(); err != nil {
+		t.Fatalf(`Flush() got %q wanted nil`, err)
+	}
+	// Every change has reached the file
+	if err := pager.WritePages([]*Page{p, q}); err != nil {
+		t.Fatalf(`WritePages() got %q wanted nil`, err)
+	}
+	entries, err := wal.Replay()
+	if err != nil {
+		t.Fatalf(`Replay() got %q wanted nil`, err)
+	}
+
+	tests := []struct {
+		name   string
+		target RecoveryTarget
+		p, q   byte
+	}{
+		{"between commits by LSN", RecoveryTarget{LSN: 3}, 1, 0},
+		{"after the later commit", RecoveryTarget{LSN: 5}, 2, 0},
+		{"between commits by time", RecoveryTarget{Time: time.Unix(0, entries[1].Timestamp)}, 1, 0},
+		{"end of log", RecoveryTarget{}, 2, 5},
+	}
+	for _, test := range tests {
+		if err := RecoverToPoint(pager, wal, test.target); err != nil {
+			t.Fatalf(`%s: RecoverToPoint() got %q wanted nil`, test.name, err)
+		}
+		for _, want := range []struct {
+			page  *Page
+			value byte
+		}{{p, test.p}, {q, test.q}} {
+			got, err := pager.ReadPage(want.page.Header.PageID)
+			if err != nil {
+				t.Fatalf(`ReadPage() got %q wanted nil`, err)
+			}
+			if got.Body[0] != want.value {
+				t.Errorf(`%s: page %d body[0] = %d; want %d`, test.name, want.page.Header.PageID, got.Body[0], want.value)
+			}
+		}
+	}
+}
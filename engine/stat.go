@@ -0,0 +1,40 @@
+package engine
+
+import "fmt"
+
+// PagerFileStat is a snapshot of file-level information about a pager
+type PagerFileStat struct {
+	FileSize int64
+	PageSize int
+	// PageCount is the number of pages in the file, including the superblock
+	// and free pages
+	PageCount uint64
+	FreePages uint64
+	// CachedPages is the number of pages currently held in the cache
+	CachedPages int
+}
+
+// Stat returns the size of the pager's file and counts of its pages
+func (p *Pager) Stat() (PagerFileStat, error) {
+	p.mutex.RLock()
+	defer p.mutex.RUnlock()
+
+	fileSize, err := p.file.Size()
+	if err != nil {
+		return PagerFileStat{}, &PagerError{
+			Op:  "Stat",
+			Err: fmt.Errorf("unable to get file info: %w", err),
+		}
+	}
+	free, err := p.freeListIDs()
+	if err != nil {
+		return PagerFileStat{}, &PagerError{Op: "Stat", Err: err}
+	}
+	return PagerFileStat{
+		FileSize:    fileSize,
+		PageSize:    PageSize,
+		PageCount:   uint64(pagesInFile(fileSize)),
+		FreePages:   uint64(len(free)),
+		CachedPages: len(p.pageCache),
+	}, nil
+}
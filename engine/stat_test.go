@@ -0,0 +1,37 @@
+package engine
+
+import "testing"
+
+func TestStat(t *testing.T) {
+	pager, err := NewMemoryPager(PagerConfig{MaxCacheSize: 4})
+	if err != nil {
+		t.Fatalf(`NewMemoryPager() got %q wanted nil`, err)
+	}
+	defer pager.Close()
+
+	for i := 0; i < 6; i++ {
+		if _, err := pager.AllocatePage(PageTypeData); err != nil {
+			t.Fatalf(`AllocatePage() got %q wanted nil`, err)
+		}
+	}
+	for _, pageID := range []PageID{2, 5} {
+		if err := pager.DeallocatePage(pageID); err != nil {
+			t.Fatalf(`DeallocatePage(%d) got %q wanted nil`, pageID, err)
+		}
+	}
+
+	stat, err := pager.Stat()
+	if err != nil {
+		t.Fatalf(`Stat() got %q wanted nil`, err)
+	}
+	want := PagerFileStat{
+		FileSize:    7 * PageSize,
+		PageSize:    PageSize,
+		PageCount:   7,
+		FreePages:   2,
+		CachedPages: 2,
+	}
+	if stat != want {
+		t.Errorf(`Stat() = %+v; want %+v`, stat, want)
+	}
+}
@@ -0,0 +1,210 @@
+package engine
+
+import (
+	"bytes"
+	"flag"
+	"fmt"
+	"math/rand/v2"
+	"sync"
+	"testing"
+	"time"
+)
+
+// The stress harness runs workers that randomly allocate, write, read and
+// deallocate pages on one shared pager. Each worker owns the pages it
+// allocated, so it can check every read against its own model of what it last
+// wrote. Workers write pages both as fresh objects and, like HeapFile, by
+// changing the *Page ReadPage returned and handing it to WritePage, relying on
+// the ownership rule documented on ReadPage. Run it under -race to catch
+// unsynchronized access, e.g.
+//
+//	go test -race -run TestPagerStress -stress.ops=20000
+var (
+	stressOps     = flag.Int("stress.ops", 2000, "operations per stress run")
+	stressWorkers = flag.Int("stress.workers", 8, "concurrent workers per stress run")
+	stressSeed    = flag.Uint64("stress.seed", 0, "seed for the stress run; 0 picks one from the clock")
+)
+
+func TestPagerStress(t *testing.T) {
+	ops := *stressOps
+	if testing.Short() {
+		ops = min(ops, 200)
+	}
+	seed := *stressSeed
+	if seed == 0 {
+		seed = uint64(time.Now().UnixNano())
+	}
+
+	err := runStress(seed, ops, *stressWorkers)
+	if err == nil {
+		return
+	}
+
+	// Keep the seed and halve the operation count for as long as the run still
+	// fails, to report a shorter run to reproduce. Scheduling is not
+	// deterministic, so the shorter run is a strong hint, not a guarantee
+	failingOps := ops
+	for candidate := ops / 2; candidate > 0; candidate /= 2 {
+		halved := runStress(seed, candidate, *stressWorkers)
+		if halved == nil {
+			break
+		}
+		failingOps, err = candidate, halved
+	}
+	t.Fatalf(`stress run failed: %v; still failed with %d of %d operations, reproduce with -stress.seed=%d -stress.ops=%d -stress.workers=%d`,
+		err, failingOps, ops, seed, failingOps, *stressWorkers)
+}
+
+// runStress runs ops operations spread over workers goroutines against a fresh
+// pager, then checks the invariants that must hold once they have all stopped
+func runStress(seed uint64, ops int, workers int) error {
+	// A small cache keeps eviction in play on every worker's path
+	pager, err := NewMemoryPager(PagerConfig{MaxCacheSize: 16})
+	if err != nil {
+		return err
+	}
+	defer pager.Close()
+
+	models := make([]map[PageID][]byte, workers)
+	errs := make([]error, workers)
+	var wg sync.WaitGroup
+	for worker := range workers {
+		models[worker] = make(map[PageID][]byte)
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			rng := rand.New(rand.NewPCG(seed, uint64(worker)))
+			share := ops / workers
+			if worker < ops%workers {
+				share++
+			}
+			errs[worker] = stressWorker(pager, rng, share, models[worker])
+		}()
+	}
+	wg.Wait()
+	for worker, err := range errs {
+		if err != nil {
+			return fmt.Errorf("worker %d: %w", worker, err)
+		}
+	}
+	return checkStressInvariants(pager, models)
+}
+
+// stressWorker performs ops random operations on the pages in model, which
+// maps each page the worker owns to the body it last wrote
+func stressWorker(pager *Pager, rng *rand.Rand, ops int, model map[PageID][]byte) error {
+	var owned []PageID
+	for op := range ops {
+		choice := rng.IntN(10)
+		if len(owned) == 0 {
+			choice = 0
+		}
+
+		switch {
+		case choice < 3:
+			page, err := pager.AllocatePage(PageTypeData)
+			if err != nil {
+				return fmt.Errorf("op %d: AllocatePage: %w", op, err)
+			}
+			pageID := page.Header.PageID
+			if _, ok := model[pageID]; ok {
+				return fmt.Errorf("op %d: AllocatePage returned page %d which is still live", op, pageID)
+			}
+			model[pageID] = make([]byte, MaxBodySize)
+			owned = append(owned, pageID)
+
+		case choice < 4:
+			pageID := owned[rng.IntN(len(owned))]
+			page := NewPage(PageTypeData)
+			page.Header.PageID = pageID
+			for i := range page.Body {
+				page.Body[i] = byte(rng.Uint32())
+			}
+			if err := pager.WritePage(page); err != nil {
+				return fmt.Errorf("op %d: WritePage(%d): %w", op, pageID, err)
+			}
+			model[pageID] = bytes.Clone(page.Body)
+
+		case choice < 6:
+			// Change the page ReadPage returned in place, as HeapFile does
+			pageID := owned[rng.IntN(len(owned))]
+			page, err := pager.ReadPage(pageID)
+			if err != nil {
+				return fmt.Errorf("op %d: ReadPage(%d): %w", op, pageID, err)
+			}
+			start := rng.IntN(MaxBodySize)
+			for i := start; i < min(start+64, MaxBodySize); i++ {
+				page.Body[i] = byte(rng.Uint32())
+			}
+			if err := pager.WritePage(page); err != nil {
+				return fmt.Errorf("op %d: WritePage(%d): %w", op, pageID, err)
+			}
+			model[pageID] = bytes.Clone(page.Body)
+
+		case choice < 9:
+			pageID := owned[rng.IntN(len(owned))]
+			page, err := pager.ReadPage(pageID)
+			if err != nil {
+				return fmt.Errorf("op %d: ReadPage(%d): %w", op, pageID, err)
+			}
+			if !bytes.Equal(page.Body, model[pageID]) {
+				return fmt.Errorf("op %d: page %d does not hold the last body written to it", op, pageID)
+			}
+
+		default:
+			i := rng.IntN(len(owned))
+			pageID := owned[i]
+			if err := pager.DeallocatePage(pageID); err != nil {
+				return fmt.Errorf("op %d: DeallocatePage(%d): %w", op, pageID, err)
+			}
+			delete(model, pageID)
+			owned[i] = owned[len(owned)-1]
+			owned = owned[:len(owned)-1]
+		}
+	}
+	return nil
+}
+
+// checkStressInvariants verifies that every live page reads back from disk
+// with a valid checksum and the body its owner last wrote, and that every
+// allocated PageID is accounted for exactly once as live or free
+func checkStressInvariants(pager *Pager, models []map[PageID][]byte) error {
+	if err := pager.FlushAll(); err != nil {
+		return fmt.Errorf("FlushAll: %w", err)
+	}
+
+	pager.mutex.Lock()
+	defer pager.mutex.Unlock()
+
+	owner := make(map[PageID]int)
+	for worker, model := range models {
+		for pageID, body := range model {
+			if other, ok := owner[pageID]; ok {
+				return fmt.Errorf("page %d is owned by workers %d and %d", pageID, other, worker)
+			}
+			owner[pageID] = worker
+
+			page, err := pager.readPageFromDisk(pageID)
+			if err != nil {
+				return fmt.Errorf("page %d: %w", pageID, err)
+			}
+			if !bytes.Equal(page.Body, body) {
+				return fmt.Errorf("page %d lost a write", pageID)
+			}
+		}
+	}
+
+	free, err := pager.freeListIDs()
+	if err != nil {
+		return err
+	}
+	for _, pageID := range free {
+		if worker, ok := owner[pageID]; ok {
+			return fmt.Errorf("page %d is on the free list but owned by worker %d", pageID, worker)
+		}
+	}
+	if want := int(pager.nextPageID) - 1; len(owner)+len(free) != want {
+		return fmt.Errorf("%d live and %d free pages; want %d in total", len(owner), len(free), want)
+	}
+	return nil
+}
@@ -0,0 +1,158 @@
+package engine
+
+import (
+	"bytes"
+	"encoding/binary"
+	"fmt"
+)
+
+// Page 0 of every file is the superblock: a metadata page recording how the
+// rest of the file is laid out. It is always checksummed with CRC32C so it can
+// be read before the file's own checksum algorithm is known
+const superblockVersion = 1
+
+var superblockMagic = [8]byte{'G', 'O', 'P', 'H', 'E', 'R', 'D', 'B'}
+
+// Byte offsets of the superblock fields within the page body
+const (
+	superblockMagicOffset    = 0
+	superblockVersionOffset  = 8
+	superblockChecksumOffset = 12
+	superblockNextPageOffset = 16
+	superblockFreeListOffset = 24
+	superblockCheckpointLSN  = 32
+	superblockCheckpointAt   = 40
+)
+
+type superblock struct {
+	version  uint32
+	checksum ChecksumAlgorithm
+	// nextPageID and freeListHead are the allocator state as of the last
+	// superblock write. Superblocks written before they were recorded hold 0
+	nextPageID   PageID
+	freeListHead PageID
+	// checkpointLSN is the LSN of the last completed checkpoint, or 0, and
+	// checkpointOffset is its offset in the log file
+	checkpointLSN    uint64
+	checkpointOffset int64
+}
+
+// loadSuperblock reads the superblock of an existing file, or writes one for a
+// new file, and configures the pager from it. Files written before the
+// superblock existed never used page 0; they keep working with CRC32C and get a
+// superblock installed the first time they are opened for writing
+func (p *Pager) loadSuperblock(config PagerConfig) error {
+	fileSize, err := p.file.Size()
+	if err != nil {
+		return fmt.Errorf("unable to get file info: %w", err)
+	}
+
+	buffer := make([]byte, PageSize)
+	if fileSize > 0 {
+		if _, err := p.file.ReadAt(buffer[:min(fileSize, PageSize)], 0); err != nil {
+			return fmt.Errorf("unable to read superblock: %w", err)
+		}
+	}
+
+	if bytes.Equal(buffer[HeaderSize:HeaderSize+len(superblockMagic)], superblockMagic[:]) {
+		sb, err := decodeSuperblock(buffer)
+		if err != nil {
+			return err
+		}
+		sb.nextPageID = max(sb.nextPageID, pagesInFile(fileSize))
+		return p.applySuperblock(sb)
+	}
+	if !bytes.Equal(buffer, make([]byte, PageSize)) {
+		return fmt.Errorf("page 0 is neither a superblock nor unused")
+	}
+
+	// Legacy files record no allocator state, so allocation resumes past the
+	// last page in the file
+	sb := superblock{
+		version:    superblockVersion,
+		checksum:   ChecksumCRC32C,
+		nextPageID: pagesInFile(fileSize),
+	}
+	if fileSize == 0 {
+		sb.checksum = config.Checksum
+	}
+	if err := p.applySuperblock(sb); err != nil {
+		return err
+	}
+	if p.readOnly {
+		return nil
+	}
+	return p.writeSuperblock()
+}
+
+// pagesInFile returns the first PageID at or past the end of a file of the
+// given size. A trailing partial page counts as a page so it is never reused.
+// Recorded allocator state can lag the file when the pager was not closed
+// cleanly, so it is never trusted below this
+func pagesInFile(fileSize int64) PageID {
+	return PageID((fileSize + PageSize - 1) / PageSize)
+}
+
+func (p *Pager) applySuperblock(sb superblock) error {
+	checksummer, err := sb.checksum.checksummer()
+	if err != nil {
+		return fmt.Errorf("superblock: %w", err)
+	}
+	p.superblock = sb
+	p.checksummer = checksummer
+	p.nextPageID = max(sb.nextPageID, 1)
+	p.freeListHead = sb.freeListHead
+	return nil
+}
+
+// writeSuperblock writes the pager's superblock, including its current
+// allocator state, to page 0 and syncs it. The caller must hold p.mutex or have
+// exclusive access to the pager
+func (p *Pager) writeSuperblock() error {
+	p.superblock.nextPageID = p.nextPageID
+	p.superblock.freeListHead = p.freeListHead
+
+	page := NewPage(PageTypeMetadata)
+	body := page.Body
+	copy(body[superblockMagicOffset:], superblockMagic[:])
+	binary.LittleEndian.PutUint32(body[superblockVersionOffset:], p.superblock.version)
+	body[superblockChecksumOffset] = byte(p.superblock.checksum)
+	binary.LittleEndian.PutUint64(body[superblockNextPageOffset:], uint64(p.superblock.nextPageID))
+	binary.LittleEndian.PutUint64(body[superblockFreeListOffset:], uint64(p.superblock.freeListHead))
+	binary.LittleEndian.PutUint64(body[superblockCheckpointLSN:], p.superblock.checkpointLSN)
+	binary.LittleEndian.PutUint64(body[superblockCheckpointAt:], uint64(p.superblock.checkpointOffset))
+
+	buffer, err := encodePage(page, CompressionNone, crc32cChecksummer{})
+	if err != nil {
+		return err
+	}
+	if _, err := p.file.WriteAt(buffer, 0); err != nil {
+		return fmt.Errorf("unable to write superblock: %w", err)
+	}
+	if err := p.file.Sync(); err != nil {
+		return fmt.Errorf("unable to sync superblock: %w", err)
+	}
+	p.superblockDirty = false
+	return nil
+}
+
+func decodeSuperblock(buffer []byte) (superblock, error) {
+	page, err := decodePage(buffer, crc32cChecksummer{})
+	if err != nil {
+		return superblock{}, fmt.Errorf("superblock: %w", err)
+	}
+	body := page.Body
+
+	sb := superblock{
+		version:          binary.LittleEndian.Uint32(body[superblockVersionOffset:]),
+		checksum:         ChecksumAlgorithm(body[superblockChecksumOffset]),
+		nextPageID:       PageID(binary.LittleEndian.Uint64(body[superblockNextPageOffset:])),
+		freeListHead:     PageID(binary.LittleEndian.Uint64(body[superblockFreeListOffset:])),
+		checkpointLSN:    binary.LittleEndian.Uint64(body[superblockCheckpointLSN:]),
+		checkpointOffset: int64(binary.LittleEndian.Uint64(body[superblockCheckpointAt:])),
+	}
+	if sb.version != superblockVersion {
+		return superblock{}, fmt.Errorf("superblock: unsupported version %d", sb.version)
+	}
+	return sb, nil
+}
@@ -0,0 +1,121 @@
+package engine
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestSuperblockInstalledOnLegacyFile(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "legacy.db")
+
+	// A file from before the superblock: page 0 unused, page 1 written
+	page := NewPage(PageTypeData)
+	page.Header.PageID = 1
+	image, err := encodePage(page, CompressionNone, crc32cChecksummer{})
+	if err != nil {
+		t.Fatalf(`encodePage() got %q wanted nil`, err)
+	}
+	legacy := append(make([]byte, PageSize), image...)
+	if err := os.WriteFile(path, legacy, 0644); err != nil {
+		t.Fatalf(`WriteFile() got %q wanted nil`, err)
+	}
+
+	pager, err := NewPager(PagerConfig{FilePath: path, MaxCacheSize: 10, Checksum: ChecksumXXHash})
+	if err != nil {
+		t.Fatalf(`NewPager() got %q wanted nil`, err)
+	}
+	defer pager.Close()
+	if pager.superblock.checksum != ChecksumCRC32C {
+		t.Errorf(`legacy file checksum = %s; want crc32c`, pager.superblock.checksum)
+	}
+	if _, err := pager.ReadPage(1); err != nil {
+		t.Errorf(`ReadPage(1) got %q wanted nil`, err)
+	}
+
+	buffer := make([]byte, PageSize)
+	pager.file.ReadAt(buffer, 0)
+	if _, err := decodeSuperblock(buffer); err != nil {
+		t.Errorf(`decodeSuperblock() got %q wanted nil`, err)
+	}
+}
+
+func TestUnrecognizedPageZeroRejected(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "garbage.db")
+	garbage := make([]byte, PageSize)
+	garbage[100] = 1
+	if err := os.WriteFile(path, garbage, 0644); err != nil {
+		t.Fatalf(`WriteFile() got %q wanted nil`, err)
+	}
+	if _, err := NewPager(PagerConfig{FilePath: path, MaxCacheSize: 10}); err == nil {
+		t.Errorf(`NewPager() on a file with garbage in page 0 got nil wanted error`)
+	}
+}
+
+func TestAllocationStateSurvivesReopen(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "reopen.db")
+	config := PagerConfig{FilePath: path, MaxCacheSize: 10}
+
+	pager, err := NewPager(config)
+	if err != nil {
+		t.Fatalf(`NewPager() got %q wanted nil`, err)
+	}
+	for i := 0; i < 5; i++ {
+		if _, err := pager.AllocatePage(PageTypeData); err != nil {
+			t.Fatalf(`AllocatePage() got %q wanted nil`, err)
+		}
+	}
+	if err := pager.DeallocatePage(2); err != nil {
+		t.Fatalf(`DeallocatePage() got %q wanted nil`, err)
+	}
+	if err := pager.Close(); err != nil {
+		t.Fatalf(`Close() got %q wanted nil`, err)
+	}
+
+	pager, err = NewPager(config)
+	if err != nil {
+		t.Fatalf(`NewPager() got %q wanted nil`, err)
+	}
+	defer pager.Close()
+	for _, want := range []PageID{2, 6} {
+		page, err := pager.AllocatePage(PageTypeData)
+		if err != nil {
+			t.Fatalf(`AllocatePage() got %q wanted nil`, err)
+		}
+		if page.Header.PageID != want {
+			t.Errorf(`AllocatePage() after reopen = page %d; want %d`, page.Header.PageID, want)
+		}
+	}
+}
+
+func TestLegacyFileAllocatesPastExistingPages(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "legacy.db")
+
+	// Pages 1 through 3 written by a pager predating the superblock
+	legacy := make([]byte, PageSize)
+	for pageID := PageID(1); pageID <= 3; pageID++ {
+		page := NewPage(PageTypeData)
+		page.Header.PageID = pageID
+		image, err := encodePage(page, CompressionNone, crc32cChecksummer{})
+		if err != nil {
+			t.Fatalf(`encodePage() got %q wanted nil`, err)
+		}
+		legacy = append(legacy, image...)
+	}
+	if err := os.WriteFile(path, legacy, 0644); err != nil {
+		t.Fatalf(`WriteFile() got %q wanted nil`, err)
+	}
+
+	pager, err := NewPager(PagerConfig{FilePath: path, MaxCacheSize: 10})
+	if err != nil {
+		t.Fatalf(`NewPager() got %q wanted nil`, err)
+	}
+	defer pager.Close()
+	page, err := pager.AllocatePage(PageTypeData)
+	if err != nil {
+		t.Fatalf(`AllocatePage() got %q wanted nil`, err)
+	}
+	if page.Header.PageID != 4 {
+		t.Errorf(`AllocatePage() on legacy file = page %d; want 4`, page.Header.PageID)
+	}
+}
@@ -0,0 +1,99 @@
+package engine
+
+import (
+	"fmt"
+	"path/filepath"
+)
+
+// FileID identifies one file of a multi-file database
+type FileID uint16
+
+// A database made of several files namespaces PageIDs by file: the top 16
+// bits of a global PageID hold the FileID and the rest the PageID within that
+// file. Each file's pager only ever sees its own local PageIDs, and the links
+// in page headers are local unless MovePage has linked a chain across files;
+// global PageIDs are used for references that can cross files, such as the
+// RIDs a Table hands out and the PageIDs of WAL entries shared by every file
+const (
+	fileIDShift    = 48
+	localPageIDMax = 1<<fileIDShift - 1
+)
+
+// DefaultTablespace is the file holding the catalog, and the tables created
+// without choosing another tablespace
+const DefaultTablespace FileID = 0
+
+// GlobalPageID returns the database-wide PageID of page pageID of file
+func GlobalPageID(file FileID, pageID PageID) PageID {
+	return PageID(file)<<fileIDShift | pageID&localPageIDMax
+}
+
+// SplitPageID splits a global PageID into its file and the PageID within it
+func SplitPageID(pageID PageID) (FileID, PageID) {
+	return FileID(pageID >> fileIDShift), pageID & localPageIDMax
+}
+
+// Tablespace is one file of a database, with its own pager
+type Tablespace struct {
+	ID   FileID
+	Path string
+	// Dedicated is set for a tablespace created by WithFile to hold a single
+	// table, which is deleted along with that table
+	Dedicated bool
+	pager     *Pager
+	// catalogRID is the tablespace's record in the catalog
+	catalogRID RID
+}
+
+// Pager returns the pager of the tablespace's file
+func (ts *Tablespace) Pager() *Pager {
+	return ts.pager
+}
+
+// openTablespace opens or creates the file of a tablespace, resolving a
+// relative path against the database directory
+func openTablespace(dir string, id FileID, path string, config PagerConfig) (*Tablespace, error) {
+	config.FilePath = resolvePath(dir, path)
+	pager, err := NewPager(config)
+	if err != nil {
+		return nil, &PagerError{
+			Op:  "OpenTablespace",
+			Err: fmt.Errorf("unable to open tablespace %d: %w", id, err),
+		}
+	}
+	pager.fileID = id
+	return &Tablespace{ID: id, Path: path, pager: pager}, nil
+}
+
+// A header link to a page in another file stores the target's local PageID
+// with the file bits set to the target's FileID XOR the linking page's own.
+// Links within a file are then plain local PageIDs, as a lone pager expects,
+// while a link from any file can still reach any other, including file 0
+
+// translateLink converts between a header link of a page of file and the
+// global PageID it points at. The encoding is its own inverse, so the same
+// call turns a link into a PageID and a PageID into a link
+func translateLink(file FileID, pageID PageID) PageID {
+	if pageID == 0 {
+		return 0
+	}
+	linkFile, local := SplitPageID(pageID)
+	return GlobalPageID(linkFile^file, local)
+}
+
+// resolvePath returns path, taken relative to dir unless it is absolute
+func resolvePath(dir, path string) string {
+	if filepath.IsAbs(path) {
+		return path
+	}
+	return filepath.Join(dir, path)
+}
+
+// recover runs recovery for the tablespace over a log shared by the whole
+// database, whose write entries carry global PageIDs
+func (ts *Tablespace) recover(wal *WriteAheadLog) error {
+	return ts.pager.recover(wal, recoverOptions{}, func(pageID PageID) (PageID, bool) {
+		file, local := SplitPageID(pageID)
+		return local, file == ts.ID
+	})
+}
@@ -0,0 +1,36 @@
+package engine
+
+import "context"
+
+// Tracer starts spans around storage operations. Implementations can bridge to
+// a distributed tracing system; the returned context carries the new span so
+// nested operations become its children
+type Tracer interface {
+	StartSpan(ctx context.Context, name string) (context.Context, Span)
+}
+
+// Span is a single traced operation
+type Span interface {
+	SetAttribute(key string, value any)
+	End(err error)
+}
+
+type noopTracer struct{}
+
+type noopSpan struct{}
+
+func (noopTracer) StartSpan(ctx context.Context, name string) (context.Context, Span) {
+	return ctx, noopSpan{}
+}
+
+func (noopSpan) SetAttribute(key string, value any) {}
+
+func (noopSpan) End(err error) {}
+
+// tracerOrNoop returns tracer, or a tracer that records nothing when it is nil
+func tracerOrNoop(tracer Tracer) Tracer {
+	if tracer == nil {
+		return noopTracer{}
+	}
+	return tracer
+}
@@ -0,0 +1,106 @@
+package engine
+
+import (
+	"context"
+	"path/filepath"
+	"sync"
+	"testing"
+)
+
+type capturedSpan struct {
+	name       string
+	attributes map[string]any
+	err        error
+	ended      bool
+}
+
+type capturingTracer struct {
+	mutex sync.Mutex
+	spans []*capturedSpan
+}
+
+func (c *capturingTracer) StartSpan(ctx context.Context, name string) (context.Context, Span) {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	span := &capturedSpan{name: name, attributes: make(map[string]any)}
+	c.spans = append(c.spans, span)
+	return ctx, span
+}
+
+func (s *capturedSpan) SetAttribute(key string, value any) {
+	s.attributes[key] = value
+}
+
+func (s *capturedSpan) End(err error) {
+	s.err = err
+	s.ended = true
+}
+
+func (c *capturingTracer) find(name string) []*capturedSpan {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	var found []*capturedSpan
+	for _, span := range c.spans {
+		if span.name == name {
+			found = append(found, span)
+		}
+	}
+	return found
+}
+
+func TestReadPageProducesSpan(t *testing.T) {
+	tracer := &capturingTracer{}
+	pager, err := NewPager(PagerConfig{
+		FilePath:     filepath.Join(t.TempDir(), "trace.db"),
+		MaxCacheSize: 10,
+		Tracer:       tracer,
+	})
+	if err != nil {
+		t.Fatalf(`NewPager() got %q wanted nil`, err)
+	}
+	defer pager.Close()
+
+	page, err := pager.AllocatePage(PageTypeData)
+	if err != nil {
+		t.Fatalf(`AllocatePage() got %q wanted nil`, err)
+	}
+	if _, err := pager.ReadPageContext(context.Background(), page.Header.PageID); err != nil {
+		t.Fatalf(`ReadPageContext() got %q wanted nil`, err)
+	}
+	if _, err := pager.ReadPage(99); err == nil {
+		t.Fatalf(`ReadPage(99) got nil wanted error`)
+	}
+
+	spans := tracer.find("pager.ReadPage")
+	if len(spans) != 2 {
+		t.Fatalf(`captured %d pager.ReadPage spans; want 2`, len(spans))
+	}
+	if !spans[0].ended || spans[0].err != nil {
+		t.Errorf(`first span ended=%v err=%v; want ended with nil error`, spans[0].ended, spans[0].err)
+	}
+	if got := spans[0].attributes["page.id"]; got != uint64(page.Header.PageID) {
+		t.Errorf(`span page.id = %v; want %d`, got, page.Header.PageID)
+	}
+	if spans[1].err == nil {
+		t.Errorf(`failed read span err = nil; want the read error`)
+	}
+}
+
+func TestWALFlushProducesSpan(t *testing.T) {
+	tracer := &capturingTracer{}
+	wal, err := NewWriteAheadLog(WriteAheadLogConfig{
+		FilePath: filepath.Join(t.TempDir(), "trace.wal"),
+		Tracer:   tracer,
+	})
+	if err != nil {
+		t.Fatalf(`NewWriteAheadLog() got %q wanted nil`, err)
+	}
+	defer wal.Close()
+
+	if err := wal.Flush(); err != nil {
+		t.Fatalf(`Flush() got %q wanted nil`, err)
+	}
+	if spans := tracer.find("wal.Flush"); len(spans) != 1 || !spans[0].ended {
+		t.Errorf(`captured %d ended wal.Flush spans; want 1`, len(spans))
+	}
+}